@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+const promptTemplateHeader = "X-Prompt-Template"
+
+// requestIDHeader carries the ID under which a decision can be labeled via
+// POST /feedback.
+const requestIDHeader = "X-Request-Id"
+
+// newRequestID returns a random 128-bit hex request ID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:]) // never fails on supported platforms
+	return hex.EncodeToString(b[:])
+}
+
+// analyzeHandler serves POST /analyze by running the liveness analysis on the
+// request body. Each decision gets a request ID, returned in X-Request-Id,
+// under which it is recorded in st (when configured) for later feedback.
+// A request may instead be queued on q, as with /analyze/async, depending
+// on its Prefer header and -analyze-mode; see negotiateAnalyzeMode.
+// Server-side failures are recorded in errs. The input is enriched by geo
+// before analysis.
+func analyzeHandler(svc *claude.ClaudeService, cfg *Config, tenants *tenantRegistry, geo *geoEnricher, q *jobQueue, st *store.JSONLStore, events *decisionEmitter, errs *errorLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var req analyzeRequest
+		if !decodeBody(w, r, &req, cfg.RejectUnknownFields) {
+			return
+		}
+		version, err := negotiateSchemaVersion(r.Header.Get(schemaVersionHeader), req.SchemaVersion)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set(schemaVersionHeader, version)
+		geo.enrich(r, &req.AnalyzeDataForLivenessInput)
+
+		w.Header().Add("Vary", "Prefer, Accept-Language")
+		mode, applied := negotiateAnalyzeMode(r, cfg.AnalyzeMode, cfg.AnalyzeModes)
+		if applied != "" {
+			w.Header().Set("Preference-Applied", applied)
+		}
+		if mode == modeAsync {
+			submitAnalysis(w, r, svc, cfg, tenants, q, st, events, errs, "/analyze", req)
+			return
+		}
+
+		requestID := newRequestID()
+		w.Header().Set(requestIDHeader, requestID)
+		traceID, _ := trace.FromContext(r.Context())
+		opts := tenants.forRequest(r).analyzeOptions(r, req.Verbosity, req.Language)
+		result, err := svc.AnalyzeDataForLivenessWithOptions(r.Context(), req.AnalyzeDataForLivenessInput, opts)
+		if err != nil {
+			log.Printf("Liveness analysis failed: request_id=%s: %v", requestID, err)
+			errs.record("/analyze", requestID, traceID, err)
+			writeAnalysisError(w, err)
+			return
+		}
+
+		log.Printf("Liveness analysis complete: request_id=%s is_likely_live=%t confidence=%v outcome=%s categories=%v template=%s", requestID, result.IsLikelyLive, result.Confidence, result.Outcome, result.Categories, result.PromptTemplate)
+		events.emit("/analyze", requestID, traceID, result, req.AnalyzeDataForLivenessInput)
+		if st != nil {
+			if err := st.SaveServed(context.WithoutCancel(r.Context()), requestID, result); err != nil {
+				log.Printf("Recording served decision %s failed: %v", requestID, err)
+			}
+		}
+		ttl := cfg.DecisionTTL.For(result)
+		if ttl > 0 {
+			w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(ttl.Seconds())))
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		writeJSON(w, http.StatusOK, versionedResponse(version, clientResult(result, req.AnalyzeDataForLivenessInput, cfg), int(ttl.Seconds()), requestID))
+	}
+}
+
+// analyzeRequest is the body accepted by POST /analyze.
+type analyzeRequest struct {
+	claude.AnalyzeDataForLivenessInput
+	// SchemaVersion selects the contract version; see negotiateSchemaVersion.
+	SchemaVersion string `json:"schema_version,omitempty"`
+	// Verbosity is terse, normal or detailed; empty uses -verbosity.
+	Verbosity string `json:"verbosity,omitempty"`
+	// Language is the BCP 47 tag of the language to write the reasoning
+	// in, overriding Accept-Language.
+	Language string `json:"language,omitempty"`
+	// CallbackURL, for requests run async, is where the completed job is
+	// POSTed; see callbackDispatcher.
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// analyzeResponse is the current-version body returned by POST /analyze.
+type analyzeResponse struct {
+	*claude.LivenessAnalysisResult
+	// DecisionTTLSeconds is how long the client may reuse this decision.
+	DecisionTTLSeconds int    `json:"decision_ttl_seconds"`
+	SchemaVersion      string `json:"schema_version"`
+	// RequestID identifies this decision for POST /feedback.
+	RequestID string `json:"request_id"`
+}
+
+// writeAnalysisError maps an AnalyzeDataForLiveness error to an HTTP response.
+func writeAnalysisError(w http.ResponseWriter, err error) {
+	var limited *claude.SessionRateLimitError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+	}
+	status, message := analysisErrorStatus(err)
+	writeError(w, status, message)
+}
+
+// analysisErrorStatus returns the HTTP status and client-facing message for
+// an AnalyzeDataForLiveness error.
+func analysisErrorStatus(err error) (int, string) {
+	var apiErr *claude.APIError
+	switch {
+	case errors.Is(err, claude.ErrNoData), errors.Is(err, claude.ErrInputTooDeep), errors.Is(err, claude.ErrInvalidImage),
+		errors.Is(err, claude.ErrPromptTemplateMissingKey):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, claude.ErrTooManyImages), errors.Is(err, claude.ErrImagesTooLarge):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, claude.ErrUnknownPromptTemplate), errors.Is(err, claude.ErrUnknownVerbosity):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, claude.ErrSessionRateLimited):
+		return http.StatusTooManyRequests, err.Error()
+	case errors.Is(err, claude.ErrStandbyMiss):
+		return http.StatusServiceUnavailable, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "liveness analysis timed out"
+	case errors.As(err, &apiErr), errors.Is(err, claude.ErrInvalidResponse), errors.Is(err, claude.ErrAmbiguousResponse):
+		return http.StatusBadGateway, "liveness analysis failed upstream"
+	default:
+		return http.StatusInternalServerError, "liveness analysis failed"
+	}
+}
+
+// clientResult returns the view of result, analyzed from input, that is
+// sent to clients. The decision and logs always use the precise value and
+// original reasoning; only this copy is masked.
+func clientResult(result *claude.LivenessAnalysisResult, input claude.AnalyzeDataForLivenessInput, cfg *Config) *claude.LivenessAnalysisResult {
+	if cfg.ConfidenceStep <= 0 && !cfg.OutputRedaction.enabled() {
+		return result
+	}
+	out := *result
+	if cfg.ConfidenceStep > 0 {
+		out.Confidence = roundToStep(result.Confidence, cfg.ConfidenceStep)
+		// The raw upstream response carries the unrounded confidence.
+		out.RawResponse = ""
+	}
+	if cfg.OutputRedaction.enabled() {
+		cfg.OutputRedaction.apply(&out, input)
+	}
+	return &out
+}
+
+// roundToStep rounds v to the nearest multiple of step, clamped to [0, 1].
+func roundToStep(v, step float64) float64 {
+	rounded := math.Round(v/step) * step
+	// Trim floating point noise such as 0.15000000000000002.
+	rounded = math.Round(rounded*1e9) / 1e9
+	return math.Max(0, math.Min(1, rounded))
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+func TestRoundToStep(t *testing.T) {
+	for _, tc := range []struct{ v, step, want float64 }{
+		{0.83, 0.05, 0.85},
+		{0.82, 0.05, 0.8},
+		{0.14, 0.1, 0.1},
+		{0.16, 0.1, 0.2},
+		{0.99, 0.25, 1},
+		{0.01, 0.25, 0},
+	} {
+		if got := roundToStep(tc.v, tc.step); got != tc.want {
+			t.Errorf("roundToStep(%v, %v) = %v, want %v", tc.v, tc.step, got, tc.want)
+		}
+	}
+}
+
+func TestAnalyzeRoundsOnlyClientConfidence(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.83, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	cfg.ConfidenceStep = 0.05
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	var events bytes.Buffer
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, st, newDecisionEmitter(&events, svc.PolicyVersion(), cfg.OutputRedaction), newErrorLog(cfg.LastErrors))
+
+	rec := post(h, "/analyze", analyzeBody, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	result := decodeResult(t, rec)
+	if result.Confidence != 0.85 {
+		t.Errorf("client confidence = %v, want 0.85", result.Confidence)
+	}
+	if result.RawResponse != "" {
+		t.Errorf("raw_response carries the unrounded confidence: %q", result.RawResponse)
+	}
+
+	var ev decisionEvent
+	if err := json.Unmarshal(events.Bytes(), &ev); err != nil {
+		t.Fatalf("decoding event %q: %v", events.String(), err)
+	}
+	if ev.Confidence != 0.83 {
+		t.Errorf("event confidence = %v, want 0.83", ev.Confidence)
+	}
+
+	requestID := rec.Header().Get(requestIDHeader)
+	served, err := st.Label(t.Context(), requestID, true)
+	if err != nil {
+		t.Fatalf("served decision not stored: %v", err)
+	}
+	if got := served.Result.Confidence; got != 0.83 {
+		t.Errorf("stored confidence = %v, want 0.83", got)
+	}
+}
+
+func TestStandbyServesStoredDecisions(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	cfg := testConfig()
+
+	// A decision made before failing over to standby...
+	primary := newTestService(t, stub, claude.WithStore(st))
+	if _, err := primary.AnalyzeDataForLiveness(t.Context(), mustInput(t, analyzeBody)); err != nil {
+		t.Fatalf("primary analysis: %v", err)
+	}
+
+	// ...is served by the standby, which never calls Claude.
+	standby := newTestService(t, stub, claude.WithStore(st), claude.WithStandby(true))
+	h := analyzeHandler(standby, cfg, newTestTenants(t, cfg, standby), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+	rec := post(h, "/analyze", analyzeBody, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stored input: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if result := decodeResult(t, rec); !result.IsLikelyLive || result.Confidence != 0.9 {
+		t.Errorf("stored input: result = %+v", result)
+	}
+
+	rec = post(h, "/analyze", `{"user_data": {"email": "other@example.com"}}`, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("unknown input: status = %d, want 503", rec.Code)
+	}
+	if _, err := standby.AnalyzeDataForLiveness(t.Context(), mustInput(t, `{"user_data": {"email": "other@example.com"}}`)); !errors.Is(err, claude.ErrStandbyMiss) {
+		t.Errorf("unknown input: error = %v, want ErrStandbyMiss", err)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want only the primary's", n)
+	}
+}
+
+func TestAnalyzeRejectsInputOverDepthLimit(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub, claude.WithMaxNestingDepth(3))
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+	rec := post(h, "/analyze", `{"technical_data": {"a": {"b": {"c": 1}}}}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("input at the limit: status = %d, body %s", rec.Code, rec.Body)
+	}
+	rec = post(h, "/analyze", `{"technical_data": {"a": {"b": {"c": {"d": 1}}}}}`, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("input over the limit: status = %d, want 422", rec.Code)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want 1", n)
+	}
+}
+
+func TestAnalyzePromptTemplateSelection(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub, claude.WithPromptTemplates(map[string]string{
+		"checkout": "You review checkout sessions for automated purchasing.",
+	}))
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, st, nil, newErrorLog(cfg.LastErrors))
+
+	for _, tc := range []struct{ header, want, instructions string }{
+		{"", claude.DefaultPromptTemplate, "You are a liveness verification analyst."},
+		{"checkout", "checkout", "You review checkout sessions for automated purchasing."},
+	} {
+		rec := post(h, "/analyze", analyzeBody, http.Header{promptTemplateHeader: {tc.header}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("template %q: status = %d, body %s", tc.header, rec.Code, rec.Body)
+		}
+		if got := decodeResult(t, rec).PromptTemplate; got != tc.want {
+			t.Errorf("template %q: result prompt_template = %q, want %q", tc.header, got, tc.want)
+		}
+		var req struct {
+			System string `json:"system"`
+		}
+		if err := json.Unmarshal([]byte(stub.lastBody()), &req); err != nil {
+			t.Fatalf("decoding Claude request: %v", err)
+		}
+		if !strings.HasPrefix(req.System, tc.instructions) {
+			t.Errorf("template %q: system prompt = %q", tc.header, req.System)
+		}
+		served, err := st.Label(t.Context(), rec.Header().Get(requestIDHeader), true)
+		if err != nil {
+			t.Fatalf("template %q: served decision not stored: %v", tc.header, err)
+		}
+		if got := served.Result.PromptTemplate; got != tc.want {
+			t.Errorf("template %q: stored prompt_template = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+
+	calls := stub.calls.Load()
+	rec := post(h, "/analyze", analyzeBody, http.Header{promptTemplateHeader: {"freeform"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown template: status = %d, want 400", rec.Code)
+	}
+	if stub.calls.Load() != calls {
+		t.Error("unknown template reached Claude")
+	}
+}
+
+func TestAnalyzeVerbosity(t *testing.T) {
+	reply := `{"is_likely_live": true, "confidence": 0.9, "reasoning": "Consistent signals.", "factors": ["captcha solved", "steady typing"]}`
+	stub := newClaudeStub(t, reply)
+	svc := newTestService(t, stub, claude.WithVerbosity(claude.VerbosityTerse))
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+	type sent struct {
+		MaxTokens int    `json:"max_tokens"`
+		System    string `json:"system"`
+	}
+	seen := make(map[string]sent)
+	for _, tc := range []struct {
+		verbosity, schema string
+		factors           bool
+	}{
+		{"", `"reasoning": "<one short sentence>"`, false}, // The configured default
+		{"terse", `"reasoning": "<one short sentence>"`, false},
+		{"normal", `"reasoning": "<short explanation>"`, false},
+		{"detailed", `"factors": [<each signal`, true},
+	} {
+		body := strings.Replace(analyzeBody, "{", `{"verbosity": "`+tc.verbosity+`", `, 1)
+		rec := post(h, "/analyze", body, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("verbosity %q: status = %d, body %s", tc.verbosity, rec.Code, rec.Body)
+		}
+		var req sent
+		if err := json.Unmarshal([]byte(stub.lastBody()), &req); err != nil {
+			t.Fatalf("decoding Claude request: %v", err)
+		}
+		if !strings.Contains(req.System, tc.schema) {
+			t.Errorf("verbosity %q: system prompt lacks %s:\n%s", tc.verbosity, tc.schema, req.System)
+		}
+		if got := decodeResult(t, rec).Factors; (len(got) > 0) != tc.factors {
+			t.Errorf("verbosity %q: factors = %q", tc.verbosity, got)
+		}
+		seen[tc.verbosity] = req
+	}
+	if terse, normal, detailed := seen["terse"].MaxTokens, seen["normal"].MaxTokens, seen["detailed"].MaxTokens; !(terse < normal && normal < detailed) {
+		t.Errorf("max_tokens terse %d, normal %d, detailed %d; want increasing", terse, normal, detailed)
+	}
+	if seen[""] != seen["terse"] {
+		t.Error("the default verbosity did not match terse")
+	}
+
+	if rec := post(h, "/analyze", strings.Replace(analyzeBody, "{", `{"verbosity": "chatty", `, 1), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown verbosity: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAnalyzeRejectsImagesOverLimits(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	// A 1x1 GIF, counted as 42 decoded bytes.
+	const gif = `{"media_type": "image/gif", "data": "R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"}`
+	svc := newTestService(t, stub, claude.WithImageLimits(2, 84))
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+	withImages := func(images ...string) string {
+		return strings.Replace(analyzeBody, "{", `{"images": [`+strings.Join(images, ", ")+`], `, 1)
+	}
+	if rec := post(h, "/analyze", withImages(gif, gif), nil); rec.Code != http.StatusOK {
+		t.Errorf("images within limits: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := post(h, "/analyze", withImages(gif, gif, gif), nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too many images: status = %d, want 413", rec.Code)
+	}
+	svc = newTestService(t, stub, claude.WithImageLimits(5, 84))
+	h = analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+	if rec := post(h, "/analyze", withImages(gif, gif, gif), nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("images over the byte limit: status = %d, want 413", rec.Code)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want 1", n)
+	}
+}
+
+func TestAnalyzeSessionLimit(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub, claude.WithSessionLimit(claude.SessionLimit{Max: 2, Window: time.Minute}))
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+	// Cached answers count toward the limit too.
+	for i := range 2 {
+		if rec := post(h, "/analyze", analyzeBody, nil); rec.Code != http.StatusOK {
+			t.Fatalf("analysis %d: status = %d, body %s", i+1, rec.Code, rec.Body)
+		}
+	}
+	rec := post(h, "/analyze", analyzeBody, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want the rest of the 1m window", got)
+	}
+
+	// Other sessions, and requests without one, are unaffected.
+	other := strings.Replace(analyzeBody, `"s1"`, `"s2"`, 1)
+	if rec := post(h, "/analyze", other, nil); rec.Code != http.StatusOK {
+		t.Errorf("other session: status = %d, want 200", rec.Code)
+	}
+	for range 3 {
+		if rec := post(h, "/analyze", `{"user_data": {"email": "user@example.com"}}`, nil); rec.Code != http.StatusOK {
+			t.Fatalf("session-less request: status = %d, want 200", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+// verifyAudit checks the record signatures of the result store at path
+// under key, reporting every line that is not validly signed, and returns
+// the process exit code: 0 if all records verify, 1 if any don't, 2 if the
+// check couldn't run.
+func verifyAudit(path, key string, w io.Writer) int {
+	if key == "" {
+		fmt.Fprintln(w, "MCP_AUDIT_SIGNING_KEY must be set to verify audit signatures")
+		return 2
+	}
+	verifier, err := store.ParseSigningKey(key)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
+	entries, err := store.VerifyFile(path, verifier)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 2
+	}
+	counts := make(map[store.AuditStatus]int)
+	for _, e := range entries {
+		counts[e.Status]++
+		if e.Status != store.AuditValid {
+			fmt.Fprintf(w, "line %d: %s\n", e.Line, e.Status)
+		}
+	}
+	fmt.Fprintf(w, "%d records: %d valid, %d tampered, %d chain broken, %d unsigned, %d corrupt\n", len(entries),
+		counts[store.AuditValid], counts[store.AuditTampered], counts[store.AuditChainBroken], counts[store.AuditUnsigned], counts[store.AuditCorrupt])
+	if counts[store.AuditValid] != len(entries) {
+		return 1
+	}
+	return 0
+}
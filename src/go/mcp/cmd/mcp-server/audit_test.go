@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+func TestVerifyAudit(t *testing.T) {
+	const key = "hmac:00112233445566778899aabbccddeeff"
+	signer, err := store.ParseSigningKey(key)
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	st, err := store.OpenJSONL(path, store.WithSigner(signer))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	for _, hash := range []string{"a", "b", "c"} {
+		if err := st.Save(t.Context(), hash, &claude.LivenessAnalysisResult{IsLikelyLive: true, Confidence: 0.9}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	st.Close(t.Context())
+
+	var out bytes.Buffer
+	if code := verifyAudit(path, key, &out); code != 0 {
+		t.Errorf("intact store: exit code %d, output %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "3 records: 3 valid, 0 tampered, 0 chain broken") {
+		t.Errorf("intact store: output %q", out.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading store: %v", err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	tampered := lines[0] + strings.Replace(lines[1], `"is_likely_live":true`, `"is_likely_live":false`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatalf("writing store: %v", err)
+	}
+	out.Reset()
+	if code := verifyAudit(path, key, &out); code != 1 {
+		t.Errorf("tampered store: exit code %d, want 1", code)
+	}
+	if !strings.Contains(out.String(), "line 2: tampered") {
+		t.Errorf("tampered store: output %q does not name line 2", out.String())
+	}
+
+	if code := verifyAudit(path, "", &out); code != 2 {
+		t.Errorf("without a key: exit code %d, want 2", code)
+	}
+}
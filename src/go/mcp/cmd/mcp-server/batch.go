@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+// batchRequest is the body accepted by POST /analyze/batch.
+type batchRequest struct {
+	Items []claude.AnalyzeDataForLivenessInput `json:"items"`
+}
+
+// batchItemResult is the outcome of one batch item. Exactly one of Result,
+// Error or Cancelled is set.
+type batchItemResult struct {
+	Index     int                            `json:"index"`
+	Result    *claude.LivenessAnalysisResult `json:"result,omitempty"`
+	Error     string                         `json:"error,omitempty"`
+	Cancelled bool                           `json:"cancelled,omitempty"`
+
+	err error // The analysis error behind Error
+}
+
+// batchResponse is the body returned by POST /analyze/batch.
+type batchResponse struct {
+	Results []batchItemResult `json:"results"`
+	// Cancelled reports that the batch stopped early; items that never
+	// completed are marked individually.
+	Cancelled bool `json:"cancelled"`
+}
+
+// batchHandler serves POST /analyze/batch, analyzing up to the tenant's
+// maximum batch size of inputs with at most cfg.BatchConcurrency in flight. If the request context
+// ends (client disconnect or time budget), in-flight analyses are cancelled,
+// no further items are started, and the results completed so far are
+// returned with the rest marked cancelled. Failed items are recorded in errs.
+func batchHandler(svc *claude.ClaudeService, cfg *Config, tenants *tenantRegistry, geo *geoEnricher, events *decisionEmitter, errs *errorLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		tenant := tenants.forRequest(r)
+		items, ok := decodeBatch(w, r, cfg, geo, tenant.MaxBatchSize)
+		if !ok {
+			return
+		}
+
+		ctx := r.Context()
+		results := runBatch(ctx, svc, items, tenant.analyzeOptions(r, "", ""), cfg.BatchConcurrency, nil)
+		resp := batchResponse{Results: results}
+		traceID, _ := trace.FromContext(ctx)
+		for i := range results {
+			if results[i].Cancelled {
+				resp.Cancelled = true
+			}
+			if results[i].err != nil {
+				errs.record("/analyze/batch", "", traceID, results[i].err)
+			}
+			if results[i].Result != nil {
+				events.emit("/analyze/batch", "", traceID, results[i].Result, items[i])
+				results[i].Result = clientResult(results[i].Result, items[i], cfg)
+			}
+		}
+		if resp.Cancelled {
+			log.Printf("Batch analysis cancelled: %v", context.Cause(ctx))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// decodeBatch reads a batch request body and checks it has at most maxSize
+// items, answering the request itself when it is unusable. The items are
+// enriched by geo.
+func decodeBatch(w http.ResponseWriter, r *http.Request, cfg *Config, geo *geoEnricher, maxSize int) ([]claude.AnalyzeDataForLivenessInput, bool) {
+	var req batchRequest
+	if !decodeBody(w, r, &req, cfg.RejectUnknownFields) {
+		return nil, false
+	}
+	if len(req.Items) == 0 {
+		writeError(w, http.StatusBadRequest, "items must not be empty")
+		return nil, false
+	}
+	if len(req.Items) > maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch of %d items exceeds the maximum of %d", len(req.Items), maxSize))
+		return nil, false
+	}
+	for i := range req.Items {
+		geo.enrich(r, &req.Items[i])
+	}
+	return req.Items, true
+}
+
+// runBatch analyzes items concurrently with opts and returns one result per item, in
+// input order. If onDone is non-nil it is called, possibly concurrently, with
+// each result as soon as it is known.
+func runBatch(ctx context.Context, svc *claude.ClaudeService, items []claude.AnalyzeDataForLivenessInput, opts claude.AnalyzeOptions, concurrency int, onDone func(batchItemResult)) []batchItemResult {
+	results := make([]batchItemResult, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		results[i].Index = i
+
+		// Wait for a worker slot, giving up once the batch is cancelled.
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i].Cancelled = true
+			if onDone != nil {
+				onDone(results[i])
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item claude.AnalyzeDataForLivenessInput) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = analyzeBatchItem(ctx, svc, i, item, opts)
+			if onDone != nil {
+				onDone(results[i])
+			}
+		}(i, item)
+	}
+	wg.Wait()
+	return results
+}
+
+func analyzeBatchItem(ctx context.Context, svc *claude.ClaudeService, index int, item claude.AnalyzeDataForLivenessInput, opts claude.AnalyzeOptions) batchItemResult {
+	result, err := svc.AnalyzeDataForLivenessWithOptions(ctx, item, opts)
+	switch {
+	case err == nil:
+		return batchItemResult{Index: index, Result: result}
+	case ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)):
+		return batchItemResult{Index: index, Cancelled: true}
+	default:
+		log.Printf("Batch item %d failed: %v", index, err)
+		return batchItemResult{Index: index, Error: err.Error(), err: err}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+// batchProgress is the data of the progress and done events of
+// POST /analyze/batch/stream.
+type batchProgress struct {
+	Total     int  `json:"total"`
+	Completed int  `json:"completed"`
+	Failed    int  `json:"failed"`
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// batchStreamHandler serves POST /analyze/batch/stream, which analyzes a
+// batch like POST /analyze/batch but streams it as server-sent events: an
+// "item" event with each result as it completes, in completion order, a
+// "progress" event every cfg.BatchStreamHeartbeat, and a final "done"
+// event. When the client disconnects the remaining items are cancelled.
+// Failed items are recorded in errs.
+func batchStreamHandler(svc *claude.ClaudeService, cfg *Config, tenants *tenantRegistry, geo *geoEnricher, events *decisionEmitter, errs *errorLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		tenant := tenants.forRequest(r)
+		items, ok := decodeBatch(w, r, cfg, geo, tenant.MaxBatchSize)
+		if !ok {
+			return
+		}
+
+		// The stream is bounded by the request's time budget rather than
+		// the server write timeout.
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			writeError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		completed := make(chan batchItemResult, len(items))
+		go func() {
+			runBatch(ctx, svc, items, tenant.analyzeOptions(r, "", ""), cfg.BatchConcurrency, func(res batchItemResult) { completed <- res })
+			close(completed)
+		}()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(event string, v interface{}) bool {
+			data, err := json.Marshal(v)
+			if err != nil {
+				log.Printf("Encoding batch %s event failed: %v", event, err)
+				return false
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		traceID, _ := trace.FromContext(ctx)
+		progress := batchProgress{Total: len(items)}
+		heartbeat := time.NewTicker(cfg.BatchStreamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case res, ok := <-completed:
+				if !ok {
+					if progress.Cancelled {
+						log.Printf("Batch stream cancelled: %v", context.Cause(ctx))
+					}
+					send("done", progress)
+					return
+				}
+				switch {
+				case res.Cancelled:
+					progress.Cancelled = true
+				case res.Error != "":
+					progress.Failed++
+					errs.record("/analyze/batch/stream", "", traceID, res.err)
+				}
+				progress.Completed++
+				if res.Result != nil {
+					events.emit("/analyze/batch/stream", "", traceID, res.Result, items[res.Index])
+					res.Result = clientResult(res.Result, items[res.Index], cfg)
+				}
+				if !send("item", res) {
+					// The client is gone; stop starting and running items.
+					cancel()
+				}
+			case <-heartbeat.C:
+				if !send("progress", progress) {
+					cancel()
+				}
+			}
+		}
+	}
+}
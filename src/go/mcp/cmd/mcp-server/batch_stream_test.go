@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamBatch posts body to the batch stream endpoint at srv.
+func streamBatch(t *testing.T, srv *httptest.Server, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return resp
+}
+
+func TestBatchStreamEmitsEveryItem(t *testing.T) {
+	// Later items answer sooner, so completion order differs from batch
+	// order; item 3 gets a reply that isn't a decision.
+	stub := newClaudeStubFunc(t, func(w http.ResponseWriter, body string, _ int64) {
+		for i, delay := range []time.Duration{80, 60, 40, 20, 0} {
+			if strings.Contains(body, fmt.Sprintf("user%d@", i)) {
+				time.Sleep(delay * time.Millisecond)
+				if i == 3 {
+					writeMessage(w, "I cannot decide.")
+					return
+				}
+			}
+		}
+		writeMessage(w, decision(true, 0.9, "Consistent signals."))
+	})
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	cfg.BatchConcurrency = 5
+	cfg.BatchStreamHeartbeat = 10 * time.Millisecond
+	srv := httptest.NewServer(batchStreamHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, newErrorLog(cfg.LastErrors)))
+	defer srv.Close()
+
+	const items = 5
+	body := bufio.NewReader(streamBatch(t, srv, batchBody(items)).Body)
+	seen := make(map[int]batchItemResult)
+	var order []int
+	var progress, done batchProgress
+	heartbeats := 0
+	for {
+		ev, err := readEvent(t, body)
+		if err != nil {
+			t.Fatalf("stream ended before done: %v", err)
+		}
+		if ev.name == "done" {
+			if err := json.Unmarshal([]byte(ev.data), &done); err != nil {
+				t.Fatalf("decoding done %q: %v", ev.data, err)
+			}
+			break
+		}
+		switch ev.name {
+		case "item":
+			var item batchItemResult
+			if err := json.Unmarshal([]byte(ev.data), &item); err != nil {
+				t.Fatalf("decoding item %q: %v", ev.data, err)
+			}
+			if _, dup := seen[item.Index]; dup {
+				t.Errorf("item %d emitted twice", item.Index)
+			}
+			seen[item.Index] = item
+			order = append(order, item.Index)
+		case "progress":
+			if err := json.Unmarshal([]byte(ev.data), &progress); err != nil {
+				t.Fatalf("decoding progress %q: %v", ev.data, err)
+			}
+			if progress.Total != items || progress.Completed > items {
+				t.Errorf("progress = %+v", progress)
+			}
+			heartbeats++
+		default:
+			t.Errorf("unexpected %q event", ev.name)
+		}
+	}
+
+	for i := range items {
+		item, ok := seen[i]
+		switch {
+		case !ok:
+			t.Errorf("item %d never emitted", i)
+		case i == 3 && (item.Error == "" || item.Result != nil):
+			t.Errorf("item 3 = %+v, want an error", item)
+		case i != 3 && (item.Result == nil || !item.Result.IsLikelyLive):
+			t.Errorf("item %d = %+v, want a live result", i, item)
+		}
+	}
+	if order[0] == 0 {
+		t.Errorf("completion order %v starts with the slowest item", order)
+	}
+	if done != (batchProgress{Total: items, Completed: items, Failed: 1}) {
+		t.Errorf("done = %+v", done)
+	}
+	if heartbeats == 0 {
+		t.Error("no progress heartbeat during the batch")
+	}
+	if _, err := readEvent(t, body); !errors.Is(err, io.EOF) {
+		t.Errorf("after done: %v, want EOF", err)
+	}
+}
+
+func TestBatchStreamCancelsOnDisconnect(t *testing.T) {
+	// The first call is answered at once; the rest hang until the test ends.
+	release := make(chan struct{})
+	stub := newClaudeStubFunc(t, func(w http.ResponseWriter, _ string, call int64) {
+		if call > 1 {
+			<-release
+		}
+		writeMessage(w, decision(true, 0.9, "Consistent signals."))
+	})
+	t.Cleanup(func() { close(release) })
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	cfg.BatchConcurrency = 2
+	finished := make(chan struct{})
+	h := batchStreamHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, newErrorLog(cfg.LastErrors))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(finished)
+		h(w, r)
+	}))
+	defer srv.Close()
+
+	resp := streamBatch(t, srv, batchBody(6))
+	ev, err := readEvent(t, bufio.NewReader(resp.Body))
+	if err != nil || ev.name != "item" {
+		t.Fatalf("first event = %+v, %v; want an item", ev, err)
+	}
+	waitForCalls(t, stub, 3)
+	resp.Body.Close()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running after the client disconnected")
+	}
+	// The items in flight are given up upstream, not left running.
+	stub.waitCancelled(t, 2)
+	stub.waitCancelled(t, 3)
+	if n := stub.calls.Load(); n != 3 {
+		t.Errorf("Claude calls = %d, want no items started after the disconnect", n)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// batchBody returns a batch of n distinct items.
+func batchBody(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"user_data": {"email": "user%d@example.com"}}`, i)
+	}
+	return `{"items": [` + strings.Join(items, ", ") + `]}`
+}
+
+// waitForCalls waits until stub has been called n times.
+func waitForCalls(t *testing.T, stub *claudeStub, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for stub.calls.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Claude calls = %d, want %d", stub.calls.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBatchCancelledMidway(t *testing.T) {
+	// The first call is answered at once; the rest hang until the test ends.
+	release := make(chan struct{})
+	stub := newClaudeStubFunc(t, func(w http.ResponseWriter, _ string, call int64) {
+		if call > 1 {
+			<-release
+		}
+		writeMessage(w, decision(true, 0.9, "Consistent signals."))
+	})
+	t.Cleanup(func() { close(release) })
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	cfg.BatchConcurrency = 2
+	h := batchHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, newErrorLog(cfg.LastErrors))
+
+	const items = 6
+	ctx, cancel := context.WithCancel(t.Context())
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/analyze/batch", strings.NewReader(batchBody(items)))
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, req)
+	}()
+
+	// One item completed and two are in flight.
+	waitForCalls(t, stub, 3)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch did not return after cancellation")
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body, err)
+	}
+	if !resp.Cancelled || len(resp.Results) != items {
+		t.Fatalf("response = %+v, want %d results and cancelled", resp, items)
+	}
+	var completed, cancelled int
+	for i, r := range resp.Results {
+		if r.Index != i {
+			t.Errorf("result %d has index %d", i, r.Index)
+		}
+		switch {
+		case r.Result != nil && !r.Cancelled:
+			completed++
+		case r.Cancelled && r.Result == nil && r.Error == "":
+			cancelled++
+		default:
+			t.Errorf("result %d = %+v, want completed or cancelled", i, r)
+		}
+	}
+	if completed != 1 || cancelled != items-1 {
+		t.Errorf("completed = %d, cancelled = %d; want 1 and %d", completed, cancelled, items-1)
+	}
+	// The calls in flight are given up upstream too.
+	stub.waitCancelled(t, 2)
+	stub.waitCancelled(t, 3)
+	time.Sleep(20 * time.Millisecond)
+	if n := stub.calls.Load(); n != 3 {
+		t.Errorf("Claude calls = %d; none should start after cancellation", n)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// errCallbacksDisabled is returned for a callback URL when no callback
+// hosts are configured.
+var errCallbacksDisabled = errors.New("callbacks are not enabled")
+
+// CallbackConfig configures delivery of completed async jobs to the
+// callback_url they were submitted with.
+type CallbackConfig struct {
+	// Hosts are the hostnames callback URLs may point at; empty disables
+	// callbacks.
+	Hosts   []string
+	Timeout time.Duration // Per delivery
+	// BatchSize, when above 1, groups results for the same callback URL
+	// into one POST of up to BatchSize results, sent once full or
+	// FlushInterval after its first result, whichever comes first.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// callbackTarget is where a job's result is delivered. Deliveries are
+// signed with the secret of the partner that submitted the job.
+type callbackTarget struct {
+	URL     string
+	Partner string
+}
+
+// callbackBatchBody is the body of a batched delivery.
+type callbackBatchBody struct {
+	Results []jobView `json:"results"`
+}
+
+// pendingBatch collects results for one target until it is sent.
+type pendingBatch struct {
+	views []jobView
+	timer *time.Timer
+}
+
+// callbackDispatcher POSTs completed jobs to their callback URLs: each as
+// its own jobView body, or, with batching, grouped into a callbackBatchBody.
+// Deliveries to a partner's URL carry X-Timestamp and X-Signature computed
+// as for signed requests, over the whole body. Redirects are not followed.
+// Failed deliveries are logged and not retried; the job stays pollable.
+type callbackDispatcher struct {
+	cfg     CallbackConfig
+	hosts   map[string]struct{}
+	secrets map[string]string
+	client  *http.Client
+
+	delivered *metrics.Counter
+	failed    *metrics.Counter
+
+	mu      sync.Mutex
+	pending map[callbackTarget]*pendingBatch
+	closed  bool
+	wg      sync.WaitGroup // In-flight deliveries
+}
+
+// newCallbackDispatcher returns a dispatcher for cfg, or nil, which
+// rejects every callback URL, when cfg.Hosts is empty.
+func newCallbackDispatcher(cfg CallbackConfig, secrets map[string]string, registry *metrics.Registry) *callbackDispatcher {
+	if len(cfg.Hosts) == 0 {
+		return nil
+	}
+	d := &callbackDispatcher{
+		cfg:     cfg,
+		hosts:   make(map[string]struct{}, len(cfg.Hosts)),
+		secrets: secrets,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect could point anywhere, bypassing the host allowlist,
+			// so it is not followed; the 3xx counts as a failed delivery.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		delivered: registry.NewCounter("mcp_callback_deliveries_total", "Callback POSTs answered with a 2xx status."),
+		failed:    registry.NewCounter("mcp_callback_failures_total", "Callback POSTs that failed or were answered with a non-2xx status."),
+		pending:   make(map[callbackTarget]*pendingBatch),
+	}
+	for _, h := range cfg.Hosts {
+		d.hosts[h] = struct{}{}
+	}
+	return d
+}
+
+// validate checks that raw is an http or https URL on an allowed host.
+func (d *callbackDispatcher) validate(raw string) error {
+	if d == nil {
+		return errCallbacksDisabled
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("callback_url must be an absolute http or https URL")
+	}
+	if _, ok := d.hosts[u.Hostname()]; !ok {
+		return fmt.Errorf("callback host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// enqueue schedules delivery of v to target.
+func (d *callbackDispatcher) enqueue(target callbackTarget, v jobView) {
+	if d.cfg.BatchSize <= 1 {
+		d.send(target, v)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		// Shutting down: nothing would flush a new batch.
+		d.send(target, callbackBatchBody{Results: []jobView{v}})
+		return
+	}
+	b := d.pending[target]
+	if b == nil {
+		b = &pendingBatch{}
+		b.timer = time.AfterFunc(d.cfg.FlushInterval, func() { d.flush(target, b) })
+		d.pending[target] = b
+	}
+	b.views = append(b.views, v)
+	if len(b.views) >= d.cfg.BatchSize {
+		b.timer.Stop()
+		delete(d.pending, target)
+		d.send(target, callbackBatchBody{Results: b.views})
+	}
+}
+
+// flush sends b once its window elapses, unless it was already sent.
+func (d *callbackDispatcher) flush(target callbackTarget, b *pendingBatch) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending[target] != b {
+		return
+	}
+	delete(d.pending, target)
+	d.send(target, callbackBatchBody{Results: b.views})
+}
+
+// send delivers body to target in the background.
+func (d *callbackDispatcher) send(target callbackTarget, body any) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		if err := d.deliver(target, body); err != nil {
+			d.failed.Inc()
+			log.Printf("Callback to %s failed: %v", target.URL, err)
+			return
+		}
+		d.delivered.Inc()
+	}()
+}
+
+func (d *callbackDispatcher) deliver(target callbackTarget, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret, ok := d.secrets[target.Partner]; ok {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(partnerIDHeader, target.Partner)
+		req.Header.Set(timestampHeader, ts)
+		req.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(signPayload(secret, ts, data)))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Close sends the pending batches and waits for in-flight deliveries or
+// ctx, whichever comes first.
+func (d *callbackDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	for target, b := range d.pending {
+		b.timer.Stop()
+		delete(d.pending, target)
+		d.send(target, callbackBatchBody{Results: b.views})
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
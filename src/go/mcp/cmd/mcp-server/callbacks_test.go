@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// callbackDelivery is one POST a callbackReceiver got.
+type callbackDelivery struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// callbackReceiver records the callbacks POSTed to it.
+type callbackReceiver struct {
+	*httptest.Server
+	deliveries chan callbackDelivery
+}
+
+func newCallbackReceiver(t *testing.T) *callbackReceiver {
+	t.Helper()
+	r := &callbackReceiver{deliveries: make(chan callbackDelivery, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.deliveries <- callbackDelivery{path: req.URL.Path, header: req.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// next returns the next delivery, failing the test if none arrives.
+func (r *callbackReceiver) next(t *testing.T) callbackDelivery {
+	t.Helper()
+	select {
+	case d := <-r.deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback delivered")
+		return callbackDelivery{}
+	}
+}
+
+// expectNone fails the test if a delivery arrives within d.
+func (r *callbackReceiver) expectNone(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case got := <-r.deliveries:
+		t.Fatalf("unexpected callback to %s: %s", got.path, got.body)
+	case <-time.After(d):
+	}
+}
+
+// batchIDs decodes a batched delivery and returns its job IDs.
+func batchIDs(t *testing.T, d callbackDelivery) []string {
+	t.Helper()
+	var body callbackBatchBody
+	if err := json.Unmarshal(d.body, &body); err != nil || body.Results == nil {
+		t.Fatalf("decoding batch %s: %v", d.body, err)
+	}
+	var ids []string
+	for _, v := range body.Results {
+		ids = append(ids, v.JobID)
+	}
+	return ids
+}
+
+func testCallbacks(batchSize int, flush time.Duration, secrets map[string]string) *callbackDispatcher {
+	return newCallbackDispatcher(CallbackConfig{
+		Hosts:         []string{"127.0.0.1"},
+		Timeout:       5 * time.Second,
+		BatchSize:     batchSize,
+		FlushInterval: flush,
+	}, secrets, metrics.NewRegistry())
+}
+
+func TestCallbackURLValidation(t *testing.T) {
+	d := testCallbacks(0, 0, nil)
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{"http://127.0.0.1:8080/hook", true},
+		{"https://127.0.0.1/hook", true},
+		{"ftp://127.0.0.1/hook", false},
+		{"/hook", false},
+		{"http://evil.example/hook", false},
+		{"http://127.0.0.1.evil.example/hook", false},
+	} {
+		if err := d.validate(tc.url); (err == nil) != tc.ok {
+			t.Errorf("validate(%q) = %v, want ok %t", tc.url, err, tc.ok)
+		}
+	}
+	var disabled *callbackDispatcher
+	if err := disabled.validate("http://127.0.0.1/hook"); err != errCallbacksDisabled {
+		t.Errorf("without hosts: validate error = %v, want errCallbacksDisabled", err)
+	}
+}
+
+func TestCallbacksDeliveredIndividually(t *testing.T) {
+	receiver := newCallbackReceiver(t)
+	callbacks := testCallbacks(0, 0, nil)
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	q := newJobQueue(cfg.AsyncMaxJobs, 5*time.Second, cfg.AsyncRetention, callbacks)
+	h := asyncAnalyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, q, nil, nil, newErrorLog(cfg.LastErrors))
+
+	ids := make(map[string]bool)
+	for i := range 3 {
+		body := strings.Replace(analyzeBody, `"s1"`, `"s`+string(rune('a'+i))+`"`, 1)
+		body = strings.Replace(body, "{", `{"callback_url": "`+receiver.URL+`/hook", `, 1)
+		ids[jobID(t, post(h, "/analyze/async", body, nil))] = true
+	}
+	for range 3 {
+		d := receiver.next(t)
+		var v jobView
+		if err := json.Unmarshal(d.body, &v); err != nil {
+			t.Fatalf("decoding delivery %s: %v", d.body, err)
+		}
+		if d.path != "/hook" || !ids[v.JobID] || v.Status != JobDone || v.Result == nil || !v.Result.IsLikelyLive {
+			t.Errorf("delivery to %s: %s", d.path, d.body)
+		}
+		delete(ids, v.JobID)
+	}
+	receiver.expectNone(t, 50*time.Millisecond)
+	if err := q.Close(t.Context()); err != nil {
+		t.Fatalf("closing jobs: %v", err)
+	}
+	if err := callbacks.Close(t.Context()); err != nil {
+		t.Fatalf("closing callbacks: %v", err)
+	}
+	if v := callbacks.delivered.Value(); v != 3 {
+		t.Errorf("delivered = %v, want 3", v)
+	}
+
+	// A disallowed callback URL is refused at submission.
+	body := strings.Replace(analyzeBody, "{", `{"callback_url": "http://evil.example/hook", `, 1)
+	if rec := post(h, "/analyze/async", body, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("disallowed callback host: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCallbacksBatched(t *testing.T) {
+	receiver := newCallbackReceiver(t)
+	secrets := map[string]string{"bank": "bank-secret"}
+	callbacks := testCallbacks(3, 100*time.Millisecond, secrets)
+	url := receiver.URL + "/hook"
+	bank := callbackTarget{URL: url, Partner: "bank"}
+	anon := callbackTarget{URL: url}
+
+	// A full batch goes out at once, signed for its partner.
+	for _, id := range []string{"b1", "b2", "b3", "b4"} {
+		callbacks.enqueue(bank, jobView{JobID: id, Status: JobDone})
+	}
+	callbacks.enqueue(anon, jobView{JobID: "a1", Status: JobDone})
+	d := receiver.next(t)
+	if ids := batchIDs(t, d); !slices.Equal(ids, []string{"b1", "b2", "b3"}) {
+		t.Errorf("first batch = %v, want the first three bank results", ids)
+	}
+	if err := verifySignature(secrets, time.Minute, time.Now(), d.header, d.body); err != nil {
+		t.Errorf("batch signature: %v", err)
+	}
+
+	// The rest wait for the window, grouped per partner.
+	remaining := map[string][]string{}
+	for range 2 {
+		d := receiver.next(t)
+		remaining[d.header.Get(partnerIDHeader)] = batchIDs(t, d)
+		if d.header.Get(partnerIDHeader) == "" && d.header.Get(signatureHeader) != "" {
+			t.Error("delivery without a partner is signed")
+		}
+	}
+	if !slices.Equal(remaining["bank"], []string{"b4"}) || !slices.Equal(remaining[""], []string{"a1"}) {
+		t.Errorf("flushed batches = %v, want [b4] for bank and [a1] unsigned", remaining)
+	}
+	receiver.expectNone(t, 150*time.Millisecond)
+
+	// Close sends what is still pending without waiting for the window.
+	slow := testCallbacks(10, time.Hour, nil)
+	slow.enqueue(anon, jobView{JobID: "c1", Status: JobDone})
+	slow.enqueue(anon, jobView{JobID: "c2", Status: JobFailed})
+	receiver.expectNone(t, 50*time.Millisecond)
+	if err := slow.Close(t.Context()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if ids := batchIDs(t, receiver.next(t)); !slices.Equal(ids, []string{"c1", "c2"}) {
+		t.Errorf("batch flushed at close = %v, want [c1 c2]", ids)
+	}
+}
+
+func TestCallbackRedirectNotFollowed(t *testing.T) {
+	elsewhere := newCallbackReceiver(t)
+	redirector := httptest.NewServer(http.RedirectHandler(elsewhere.URL+"/stolen", http.StatusTemporaryRedirect))
+	t.Cleanup(redirector.Close)
+	callbacks := testCallbacks(0, 0, nil)
+
+	callbacks.enqueue(callbackTarget{URL: redirector.URL + "/hook"}, jobView{JobID: "j1", Status: JobDone})
+	if err := callbacks.Close(t.Context()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	elsewhere.expectNone(t, 50*time.Millisecond)
+	if f, d := callbacks.failed.Value(), callbacks.delivered.Value(); f != 1 || d != 0 {
+		t.Errorf("failed = %v, delivered = %v; want the redirect counted as a failure", f, d)
+	}
+}
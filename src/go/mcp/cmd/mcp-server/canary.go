@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// canaryUpdate is the body of PUT /admin/canary.
+type canaryUpdate struct {
+	Percent *float64 `json:"percent"`
+}
+
+// canaryHandler reports the canary routing on GET and changes the canary
+// percentage on PUT, without a restart.
+func canaryHandler(svc *claude.ClaudeService, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, svc.Canary())
+		case http.MethodPut:
+			var req canaryUpdate
+			if !decodeBody(w, r, &req, cfg.RejectUnknownFields) {
+				return
+			}
+			if req.Percent == nil {
+				writeError(w, http.StatusBadRequest, "percent is required")
+				return
+			}
+			if err := svc.SetCanaryPercent(*req.Percent); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			status := svc.Canary()
+			log.Printf("Canary routing set to %v%% of requests to %s", status.Percent, status.Model)
+			writeJSON(w, http.StatusOK, status)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
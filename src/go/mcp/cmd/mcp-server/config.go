@@ -0,0 +1,810 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+// Config holds the server configuration, populated from command-line flags
+// and environment variables.
+type Config struct {
+	ShutdownTimeout     time.Duration
+	HTTPShutdownTimeout time.Duration
+
+	// MaxRequestTimeout caps the per-request budget a client may ask for
+	// with X-Timeout-Ms, and is the budget used when the header is absent.
+	MaxRequestTimeout time.Duration
+
+	ClaudeAPIKey  string
+	ClaudeBaseURL string
+	Model         string
+
+	// CanaryModel, when set, serves CanaryPercent (0-100) of requests in
+	// place of Model. The percentage can be changed at runtime through
+	// /admin/canary.
+	CanaryModel   string
+	CanaryPercent float64
+	// ShadowModel, when set, is also sent ShadowSampleRate (0-1) of
+	// requests in the background to measure its agreement with the served
+	// decisions.
+	ShadowModel      string
+	ShadowSampleRate float64
+	// HedgeDelay and HedgeDeadlineFraction set when a slow Claude call is
+	// sent a second time; both zero disables hedging. HedgeMaxInFlight
+	// bounds the hedged calls running at once.
+	HedgeDelay            time.Duration
+	HedgeDeadlineFraction float64
+	HedgeMaxInFlight      int
+
+	// ModelPricing overrides the built-in per-model prices used for cost
+	// estimates. ModelsRefreshInterval controls how often the Models API is
+	// re-queried after the startup warmup; zero disables refreshing.
+	ModelPricing          map[string]claude.ModelPricing
+	ModelsRefreshInterval time.Duration
+
+	// RiskMapping derives risk_score from confidence.
+	RiskMapping claude.RiskMapping
+	// IncludeRuleScore adds rule_score and triggered_rules to every result.
+	IncludeRuleScore bool
+
+	// ParseRetries is how many times an unparseable Claude decision is
+	// re-requested with a stricter instruction.
+	ParseRetries int
+
+	// Stream makes Claude calls use the streaming API; StreamFallback
+	// retries a stream that fails mid-way once without streaming.
+	Stream         bool
+	StreamFallback bool
+
+	// ResponseWriteTimeout bounds each write of a response to a client.
+	ResponseWriteTimeout time.Duration
+	// LogDebug enables debug logging, e.g. of responses abandoned because
+	// the client went away.
+	LogDebug bool
+
+	// ClaudeTimeout bounds each Claude call; ModelTimeouts overrides it by
+	// model name or prefix.
+	ClaudeTimeout time.Duration
+	ModelTimeouts map[string]time.Duration
+	// AnalysisTimeout bounds a whole analysis, across the retries of its
+	// Claude calls.
+	AnalysisTimeout time.Duration
+
+	// SpendCap limits estimated Claude spend per period; a zero CapUSD
+	// disables it.
+	SpendCap claude.SpendCap
+
+	// WarmupGrace is the longest the server serves rule-only decisions on
+	// startup while the Claude connection warms up; zero disables the grace
+	// window.
+	WarmupGrace time.Duration
+
+	// RetryPolicies holds the backoff policy for each retryable Claude
+	// error class.
+	RetryPolicies map[claude.ErrorClass]claude.BackoffPolicy
+
+	// DecisionThreshold and DecisionMargin decide when a confidence is
+	// decisive enough to report a live or not_live outcome.
+	DecisionThreshold float64
+	DecisionMargin    float64
+
+	// SLO is the latency objective tracked for synchronous analyses.
+	SLO SLOConfig
+	// LoadShed rejects a share of analysis requests under overload.
+	LoadShed LoadShedConfig
+
+	// DecisionEvents is where structured decision events are written:
+	// "stdout", "stderr", a file path, or empty to disable them.
+	DecisionEvents string
+
+	// IdempotencyTTL is how long responses are kept for replay to requests
+	// repeating an Idempotency-Key; zero disables idempotency handling.
+	// IdempotencyWait bounds how long a concurrent repeat waits for the
+	// first request to finish.
+	IdempotencyTTL  time.Duration
+	IdempotencyWait time.Duration
+
+	// PartnerSecrets, read from MCP_PARTNER_SECRETS, maps partner IDs to
+	// the HMAC secrets their analysis requests must be signed with; empty
+	// disables signature checks. SignatureMaxSkew bounds timestamp drift.
+	PartnerSecrets   map[string]string
+	SignatureMaxSkew time.Duration
+
+	// HysteresisWindow, HysteresisSwing and HysteresisSessionKey configure
+	// per-session decision hysteresis; a zero window disables it.
+	HysteresisWindow     time.Duration
+	HysteresisSwing      float64
+	HysteresisSessionKey string
+
+	// TenantConfig is a JSON file of per-tenant overrides keyed by partner
+	// ID, reloadable through POST /admin/reload.
+	TenantConfig string
+
+	// GeoIPDatabases are MaxMind DB files, such as a Country and an ASN
+	// database, used to add the client's location to technical_data.
+	// They are reloadable through POST /admin/reload; a missing file is
+	// skipped. GeoIPClientIPHeader names a header carrying the client IP,
+	// for deployments behind a proxy; empty uses the connection's address.
+	// The header's hops are read from the right, skipping those within
+	// GeoIPTrustedProxies, so a client can't choose its address by sending
+	// the header itself; see geoEnricher.clientAddr.
+	GeoIPDatabases      []string
+	GeoIPClientIPHeader string
+	GeoIPTrustedProxies []netip.Prefix
+
+	// SessionOverrides force the decision for sessions on the allow and
+	// deny lists; Precedence settles sessions on both.
+	SessionOverrides claude.SessionOverrides
+	// SessionLimit caps analyses per session per window; a zero Max
+	// disables it.
+	SessionLimit claude.SessionLimit
+
+	// FeedbackMinLabels is how many labeled decisions are needed before
+	// an accuracy is reported.
+	FeedbackMinLabels int
+
+	// MaxImages and MaxImageBytes bound the images attached to a request.
+	MaxImages     int
+	MaxImageBytes int
+
+	// NestedJSONKeys lists technical_data keys whose values may arrive as
+	// string-encoded JSON and are decoded, up to NestedJSONDepth layers.
+	NestedJSONKeys  []string
+	NestedJSONDepth int
+
+	// HistoryQueryLimits bounds query strings on GET /history.
+	HistoryQueryLimits QueryLimits
+
+	// AdminToken, read from MCP_ADMIN_TOKEN, is the bearer token required by
+	// operator endpoints such as /stats. Empty leaves them open.
+	AdminToken string
+	// StatsStreamInterval is how often /stats/stream pushes a snapshot.
+	StatsStreamInterval time.Duration
+	// LastErrors is how many recent analysis failures /admin/last-error
+	// keeps.
+	LastErrors int
+
+	// AsyncMaxJobs caps pending /analyze/async jobs; AsyncRetention is how
+	// long a completed job stays pollable. AsyncDrainTimeout is how long
+	// shutdown waits for pending jobs before cancelling them.
+	AsyncMaxJobs      int
+	AsyncRetention    time.Duration
+	AsyncDrainTimeout time.Duration
+	// Callbacks configures delivery of async jobs to their callback_url.
+	Callbacks CallbackConfig
+	// AnalyzeMode is how POST /analyze runs a request that states no
+	// preference; AnalyzeModes are the modes a Prefer header may select.
+	AnalyzeMode  analyzeMode
+	AnalyzeModes []analyzeMode
+
+	// MaxBatchSize and BatchConcurrency bound POST /analyze/batch.
+	MaxBatchSize     int
+	BatchConcurrency int
+	// BatchStreamHeartbeat is how often POST /analyze/batch/stream reports
+	// progress.
+	BatchStreamHeartbeat time.Duration
+
+	// ConfidenceStep rounds the confidence reported to clients to the nearest
+	// multiple of this value (e.g. 0.05). Zero disables rounding.
+	ConfidenceStep float64
+	// OutputRedaction masks sensitive values in the reasoning and factors
+	// sent to clients.
+	OutputRedaction OutputRedaction
+
+	// DecisionTTL controls how long clients may reuse a decision.
+	DecisionTTL DecisionTTLConfig
+
+	// OutboundAllowlist, when non-empty, is the exhaustive list of
+	// "section.key" input names that may be sent to Claude, plus "images"
+	// to let attached images through.
+	OutboundAllowlist []string
+
+	// Categories is the set of tags Claude may attach to a decision.
+	Categories []string
+
+	// MaxNestingDepth bounds how deeply input maps may nest.
+	MaxNestingDepth int
+
+	// PromptTemplates are the named analysis instructions requests may
+	// select with X-Prompt-Template, loaded from PromptTemplateDir.
+	PromptTemplateDir string
+	PromptTemplates   map[string]string
+	// PromptMissingKeys decides how templates render input keys a request
+	// doesn't include.
+	PromptMissingKeys claude.MissingKeyPolicy
+
+	// Strict turns off every tolerant behavior; see strictToggles. Each
+	// toggle can still be set explicitly to override it.
+	Strict bool
+	// Verbosity is the reasoning detail for requests that don't choose one.
+	Verbosity claude.Verbosity
+	// Languages are the reasoning languages clients may request with
+	// Accept-Language or the language field; DefaultLanguage is used
+	// otherwise.
+	Languages       []string
+	DefaultLanguage string
+	// RejectEmptyReasoning fails Claude decisions without a reasoning
+	// instead of synthesizing one.
+	RejectEmptyReasoning bool
+	// RejectUnknownCategories fails Claude decisions tagged with a
+	// category outside Categories instead of dropping the tag.
+	RejectUnknownCategories bool
+	// RejectExtraFields fails Claude decisions with fields beyond the
+	// decision schema instead of passing them through as extra.
+	RejectExtraFields bool
+	// RejectUnknownFields fails requests with JSON fields the API doesn't
+	// define instead of ignoring them.
+	RejectUnknownFields bool
+
+	// CacheTTL is how long decisions are cached; zero disables the cache.
+	// CacheTTLJitter spreads each entry's TTL by up to ± this fraction.
+	CacheTTL       time.Duration
+	CacheTTLJitter float64
+	// CacheSalt is mixed into cache and store keys; change it to bust them.
+	CacheSalt string
+
+	// StorePath is the JSONL file decisions are recorded in; empty disables
+	// the store.
+	StorePath string
+	// StoreStrict refuses to start on a store file with a corrupted line
+	// instead of skipping it.
+	StoreStrict bool
+	// AuditSigner, from MCP_AUDIT_SIGNING_KEY, signs each stored record;
+	// nil leaves records unsigned.
+	AuditSigner store.Signer
+
+	// Standby serves only cached or stored decisions and never calls Claude.
+	Standby bool
+}
+
+// SLOConfig is a latency service level objective: Objective of requests
+// complete within Target, measured over Window.
+type SLOConfig struct {
+	Target    time.Duration
+	Objective float64
+	Window    time.Duration
+}
+
+// loadConfig parses args with the flags bound on fs, and the environment,
+// into a Config.
+func loadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := &Config{}
+
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "Overall deadline for graceful shutdown")
+	fs.DurationVar(&cfg.HTTPShutdownTimeout, "http-shutdown-timeout", 15*time.Second, "Time allowed for in-flight HTTP requests to drain on shutdown")
+	fs.DurationVar(&cfg.MaxRequestTimeout, "max-request-timeout", 9*time.Second, "Maximum per-request time budget; also the default when X-Timeout-Ms is absent")
+	fs.StringVar(&cfg.Model, "model", claude.DefaultModel, "Claude model used for analysis")
+	fs.BoolVar(&cfg.IncludeRuleScore, "include-rule-score", false, "Include the local rules' rule_score and triggered_rules in every result, even when Claude decided")
+	riskMapping := fs.String("risk-mapping", "linear", "How risk_score (0-100) is derived from confidence: linear for round((1 - confidence) * 100), or confidence:risk points interpolated linearly, e.g. 0:100,0.5:70,0.8:20,1:0")
+	modelPricing := fs.String("model-pricing", "", "Per-model price overrides in USD per million tokens, as model=input:output[,model=input:output]")
+	fs.DurationVar(&cfg.ModelsRefreshInterval, "models-refresh-interval", time.Hour, "How often to refresh the model catalog from the Models API; 0 disables")
+	fs.DurationVar(&cfg.ClaudeTimeout, "claude-timeout", claude.DefaultRequestTimeout, "Timeout for each Claude call to a model without its own -model-timeouts entry")
+	fs.DurationVar(&cfg.AnalysisTimeout, "analysis-timeout", claude.DefaultAnalysisTimeout, "Overall budget for one analysis across its Claude call retries; each call is still bounded by -claude-timeout or -model-timeouts")
+	modelTimeouts := fs.String("model-timeouts", "", "Per-model Claude call timeouts, as model=duration[,model=duration]; keys may be model name prefixes")
+	fs.Float64Var(&cfg.DecisionTTL.HighConfidence, "decision-ttl-high-confidence", 0.8, "Confidence at or above which a live decision (or at or below 1 minus which a not-live decision) is considered decisive for client caching")
+	fs.DurationVar(&cfg.DecisionTTL.Live, "decision-ttl-live", 10*time.Minute, "Client cache lifetime for decisive live decisions")
+	fs.DurationVar(&cfg.DecisionTTL.NotLive, "decision-ttl-not-live", 5*time.Minute, "Client cache lifetime for decisive not-live decisions")
+	fs.DurationVar(&cfg.DecisionTTL.Uncertain, "decision-ttl-uncertain", 0, "Client cache lifetime for decisions below the high-confidence threshold")
+	retryFlags := make(map[claude.ErrorClass]*string)
+	for _, class := range []claude.ErrorClass{claude.ClassRateLimited, claude.ClassOverloaded, claude.ClassServerError, claude.ClassUnavailable} {
+		name := "retry-" + strings.ReplaceAll(string(class), "_", "-")
+		retryFlags[class] = fs.String(name, formatBackoff(claude.DefaultRetryPolicies[class]), "Retry policy for "+string(class)+" Claude errors, as retries:initial:max (e.g. 2:1s:5s)")
+	}
+	fs.Float64Var(&cfg.SpendCap.CapUSD, "spend-cap-usd", 0, "Estimated Claude spend per period after which only rule-only decisions are served; 0 disables")
+	fs.Float64Var(&cfg.SpendCap.DowngradeAt, "spend-downgrade-at", 0.8, "Fraction of the spend cap after which requests use the cheapest model")
+	spendPeriod := fs.String("spend-period", string(claude.SpendDaily), "Spend cap period: daily or monthly (UTC)")
+	fs.StringVar(&cfg.TenantConfig, "tenant-config", "", "JSON file mapping partner IDs to model, threshold, prompt template and batch size overrides")
+	geoIPDatabases := fs.String("geoip-db", "", "Comma-separated MaxMind DB (.mmdb) files used to add the client's country and ASN to technical_data; empty disables")
+	fs.StringVar(&cfg.GeoIPClientIPHeader, "geoip-client-ip-header", "", "Header carrying the client IP for GeoIP enrichment (e.g. X-Forwarded-For), which the proxy in front must append to; the rightmost address outside -geoip-trusted-proxies is used. Empty uses the connection's address")
+	geoIPTrustedProxies := fs.String("geoip-trusted-proxies", "", "Comma-separated CIDRs of proxies whose hops in -geoip-client-ip-header are skipped when finding the client IP")
+	fs.DurationVar(&cfg.ResponseWriteTimeout, "response-write-timeout", 5*time.Second, "Deadline for each write of a response; slower clients are disconnected")
+	fs.BoolVar(&cfg.LogDebug, "log-debug", false, "Enable debug logging")
+	fs.IntVar(&cfg.ParseRetries, "parse-retries", 1, "Times to re-request a Claude decision that can't be parsed, with a stricter JSON-only instruction")
+	fs.BoolVar(&cfg.Stream, "stream", false, "Call Claude with the streaming Messages API")
+	fs.BoolVar(&cfg.StreamFallback, "stream-fallback", true, "With -stream, retry once without streaming when a stream ends in an error event")
+	fs.StringVar(&cfg.CanaryModel, "canary-model", "", "Candidate Claude model served to -canary-percent of requests")
+	fs.Float64Var(&cfg.CanaryPercent, "canary-percent", 0, "Percentage (0-100) of requests routed to -canary-model, chosen by a hash of the request")
+	fs.StringVar(&cfg.ShadowModel, "shadow-model", "", "Candidate Claude model evaluated in the background on -shadow-sample-rate of requests, without serving its decisions")
+	fs.Float64Var(&cfg.ShadowSampleRate, "shadow-sample-rate", 0.1, "Fraction (0-1) of requests also evaluated by -shadow-model, chosen by a hash of the request")
+	fs.DurationVar(&cfg.HedgeDelay, "hedge-delay", 0, "Send a second, hedged Claude request when the first hasn't answered after this long, taking whichever answers first; 0 disables")
+	fs.Float64Var(&cfg.HedgeDeadlineFraction, "hedge-deadline-fraction", 0, "Hedge a Claude request once this fraction (0-1) of its remaining deadline has passed, if sooner than -hedge-delay; 0 disables")
+	fs.IntVar(&cfg.HedgeMaxInFlight, "hedge-max-in-flight", claude.DefaultHedgeMaxInFlight, "Maximum hedged Claude requests running at once; a slow request finding them all busy isn't hedged")
+	fs.StringVar(&cfg.SpendCap.DowngradeModel, "spend-downgrade-model", "", "Model used once the downgrade threshold is crossed; empty picks the cheapest known model")
+	fs.DurationVar(&cfg.WarmupGrace, "warmup-grace", 0, "Serve rule-only decisions for up to this long on startup while Claude warms up; 0 disables")
+	fs.Float64Var(&cfg.DecisionThreshold, "decision-threshold", claude.DefaultDecisionThreshold, "Confidence separating live from not_live outcomes")
+	fs.Float64Var(&cfg.DecisionMargin, "decision-margin", 0, "Minimum distance from the decision threshold for a live or not_live outcome; closer confidences are uncertain")
+	fs.DurationVar(&cfg.SLO.Target, "slo-latency-target", 2*time.Second, "Latency an analysis must complete within to count toward the SLO")
+	fs.Float64Var(&cfg.SLO.Objective, "slo-objective", 0.95, "Fraction of analyses that must meet -slo-latency-target")
+	fs.DurationVar(&cfg.SLO.Window, "slo-window", time.Hour, "Rolling window over which SLO compliance is measured")
+	fs.IntVar(&cfg.LoadShed.SoftLimit, "shed-soft-limit", 0, "Analysis requests in flight above which new ones start being shed with 503; 0 disables load shedding")
+	fs.IntVar(&cfg.LoadShed.HardLimit, "shed-hard-limit", 200, "Analysis requests in flight at which every new one is shed")
+	fs.Float64Var(&cfg.LoadShed.Aggressiveness, "shed-aggressiveness", 1, "Multiplier on the shedding probability between -shed-soft-limit and -shed-hard-limit; above 1 sheds harder earlier")
+	fs.StringVar(&cfg.DecisionEvents, "decision-events", "", "Write a JSON event per decision to stdout, stderr or the given file, separate from the log; empty disables")
+	fs.DurationVar(&cfg.IdempotencyTTL, "idempotency-ttl", 10*time.Minute, "How long responses are replayed for requests repeating an Idempotency-Key; 0 disables")
+	fs.DurationVar(&cfg.IdempotencyWait, "idempotency-wait", 10*time.Second, "How long a request waits for a concurrent request with the same Idempotency-Key before getting 409")
+	fs.DurationVar(&cfg.SignatureMaxSkew, "signature-max-skew", 5*time.Minute, "Maximum difference between a signed request's X-Timestamp and the server clock")
+	fs.DurationVar(&cfg.HysteresisWindow, "hysteresis-window", 0, "How long a session's decisive outcome resists being reversed by borderline queries; 0 disables hysteresis")
+	fs.Float64Var(&cfg.HysteresisSwing, "hysteresis-swing", 0.1, "How far beyond the opposite decision boundary a confidence must be to reverse a session's outcome within the hysteresis window")
+	fs.StringVar(&cfg.HysteresisSessionKey, "hysteresis-session-key", claude.DefaultSessionKey, "session_data field identifying the session for hysteresis")
+	allowSessions := fs.String("allow-sessions", "", "Comma-separated session IDs always decided live, without consulting Claude")
+	denySessions := fs.String("deny-sessions", "", "Comma-separated session IDs always decided not live, without consulting Claude")
+	precedence := fs.String("override-precedence", string(claude.DenyWins), "Which list wins for a session on both -allow-sessions and -deny-sessions: deny or allow")
+	fs.StringVar(&cfg.SessionOverrides.SessionKey, "override-session-key", claude.DefaultSessionKey, "session_data field matched against -allow-sessions and -deny-sessions")
+	fs.IntVar(&cfg.SessionLimit.Max, "session-limit", 0, "Maximum analyses of one session per -session-limit-window, beyond which requests get 429; 0 disables")
+	fs.DurationVar(&cfg.SessionLimit.Window, "session-limit-window", time.Minute, "Window over which -session-limit is counted")
+	fs.StringVar(&cfg.SessionLimit.SessionKey, "session-limit-key", claude.DefaultSessionKey, "session_data field identifying the session for -session-limit")
+	missingSession := fs.String("session-limit-missing", string(claude.MissingSessionBypass), "How -session-limit treats requests without a session ID: bypass (not limited) or shared (limited as one session)")
+	missingKeys := fs.String("prompt-missing-keys", string(claude.MissingKeyEmpty), "How prompt templates render references to input keys a request lacks: empty, skip (leave out the paragraph) or error")
+	verbosity := fs.String("verbosity", string(claude.VerbosityNormal), "Default reasoning detail: terse, normal or detailed")
+	languages := fs.String("languages", claude.DefaultLanguage, "Comma-separated BCP 47 tags of the languages reasoning may be requested in")
+	fs.StringVar(&cfg.DefaultLanguage, "default-language", claude.DefaultLanguage, "Reasoning language for requests that ask for none of -languages")
+	fs.IntVar(&cfg.MaxImages, "max-images", claude.DefaultMaxImages, "Maximum number of images per analysis request; 0 disables the limit")
+	fs.IntVar(&cfg.MaxImageBytes, "max-image-bytes", claude.DefaultMaxImageBytes, "Maximum total decoded image bytes per analysis request; 0 disables the limit")
+	nestedJSONKeys := fs.String("nested-json-keys", "", "Comma-separated technical_data keys whose string-encoded JSON values are decoded before analysis")
+	fs.IntVar(&cfg.NestedJSONDepth, "nested-json-depth", claude.DefaultNestedJSONDepth, "Maximum layers of string-encoded JSON decoded for -nested-json-keys")
+	fs.IntVar(&cfg.FeedbackMinLabels, "feedback-min-labels", 30, "Labeled decisions required before /feedback and mcp_feedback_accuracy report an accuracy")
+	fs.IntVar(&cfg.HistoryQueryLimits.MaxParams, "history-max-query-params", 10, "Maximum number of query parameters accepted by /history")
+	fs.IntVar(&cfg.HistoryQueryLimits.MaxValueBytes, "history-max-query-value-bytes", 256, "Maximum length of a /history query parameter name or value")
+	fs.DurationVar(&cfg.StatsStreamInterval, "stats-stream-interval", 5*time.Second, "How often /stats/stream pushes a stats snapshot")
+	fs.IntVar(&cfg.LastErrors, "last-errors", 20, "Number of recent analysis failures kept for /admin/last-error")
+	fs.IntVar(&cfg.AsyncMaxJobs, "async-max-jobs", 100, "Maximum number of in-flight /analyze/async jobs; further submissions get 429")
+	fs.DurationVar(&cfg.AsyncRetention, "async-retention", 5*time.Minute, "How long a completed async job's result stays pollable")
+	fs.DurationVar(&cfg.AsyncDrainTimeout, "async-drain-timeout", 10*time.Second, "How long shutdown waits for pending async jobs to complete before cancelling them; 0 waits up to -shutdown-timeout")
+	callbackHosts := fs.String("callback-hosts", "", "Comma-separated hostnames async requests' callback_url may point at; empty disables callbacks")
+	fs.DurationVar(&cfg.Callbacks.Timeout, "callback-timeout", 10*time.Second, "Timeout for each callback delivery")
+	fs.IntVar(&cfg.Callbacks.BatchSize, "callback-batch-size", 0, "Maximum results grouped into one POST to the same callback URL; 0 or 1 delivers each result on its own")
+	fs.DurationVar(&cfg.Callbacks.FlushInterval, "callback-flush-interval", time.Second, "How long a callback batch collects results after its first before it is sent")
+	defaultMode := fs.String("analyze-mode", string(modeSync), "How POST /analyze runs requests without a Prefer header: sync or async")
+	allowedModes := fs.String("analyze-modes", "sync,async", "Comma-separated modes POST /analyze requests may select with Prefer: respond-async (async) or Prefer: wait (sync)")
+	fs.IntVar(&cfg.MaxBatchSize, "max-batch-size", 50, "Maximum number of items in a batch analysis request")
+	fs.IntVar(&cfg.BatchConcurrency, "batch-concurrency", 4, "Maximum number of batch items analyzed concurrently")
+	fs.DurationVar(&cfg.BatchStreamHeartbeat, "batch-stream-heartbeat", 2*time.Second, "Interval between progress events on streamed batch analyses")
+	redactOutputKeys := fs.String("redact-output-keys", "", "Comma-separated input keys whose values are masked wherever the reasoning or factors sent to clients repeat them")
+	redactOutputPatterns := fs.String("redact-output-patterns", "", "Comma-separated PII patterns (email, ip) masked in the reasoning and factors sent to clients")
+	fs.Float64Var(&cfg.ConfidenceStep, "confidence-step", 0, "Round client-facing confidence to this step (e.g. 0.05); 0 disables")
+	outboundAllowlist := fs.String("outbound-allowlist", "", "Comma-separated section.key names (e.g. technical_data.captcha_solved), or images, that may be sent to Claude; empty sends all input")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", 0, "How long to cache decisions for identical input; 0 disables caching")
+	fs.Float64Var(&cfg.CacheTTLJitter, "cache-ttl-jitter", 0.1, "Fraction by which each cache entry's TTL is randomly spread (e.g. 0.1 for ±10%)")
+	fs.StringVar(&cfg.CacheSalt, "cache-salt", "", "Salt mixed into cache and store keys; change it to invalidate cached decisions")
+	fs.StringVar(&cfg.StorePath, "store-path", "", "JSONL file to record decisions in; empty disables the result store")
+	fs.BoolVar(&cfg.StoreStrict, "store-strict", false, "Fail to start when the result store has a corrupted line instead of skipping it")
+	fs.BoolVar(&cfg.Standby, "standby", false, "Serve only cached or stored decisions without calling Claude")
+	fs.IntVar(&cfg.MaxNestingDepth, "max-nesting-depth", claude.DefaultMaxNestingDepth, "Maximum nesting depth of input maps; deeper payloads are rejected with 422")
+	fs.StringVar(&cfg.PromptTemplateDir, "prompt-template-dir", "", "Directory of <name>.txt prompt templates selectable per request with X-Prompt-Template")
+	fs.BoolVar(&cfg.RejectEmptyReasoning, "reject-empty-reasoning", false, "Reject Claude decisions with an empty reasoning instead of synthesizing one")
+	fs.BoolVar(&cfg.RejectUnknownCategories, "reject-unknown-categories", false, "Reject Claude decisions tagged with a category outside -categories instead of dropping the tag")
+	fs.BoolVar(&cfg.RejectExtraFields, "reject-extra-fields", false, "Reject Claude decisions containing fields beyond the decision schema instead of returning them as extra")
+	fs.BoolVar(&cfg.RejectUnknownFields, "reject-unknown-fields", false, "Reject requests containing JSON fields the API doesn't define instead of ignoring them")
+	fs.BoolVar(&cfg.Strict, "strict", false, "Turn off all tolerant behaviors: implies -reject-empty-reasoning, -reject-unknown-categories, -reject-extra-fields, -reject-unknown-fields and -store-strict unless they are set explicitly")
+	categories := fs.String("categories", strings.Join(claude.DefaultCategories, ","), "Comma-separated category tags Claude may attach to a decision")
+	configPath := fs.String("config", "", "YAML file of flag settings, as written by -dump-config; command-line flags take precedence")
+	dump := fs.Bool("dump-config", false, "Print the effective configuration as a commented YAML file and exit")
+	verifyAuditPath := fs.String("verify-audit", "", "Check the record signatures of the given result store file against MCP_AUDIT_SIGNING_KEY, report tampered entries and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *configPath != "" {
+		if err := applyConfigFile(fs, *configPath); err != nil {
+			return nil, err
+		}
+	}
+	if *dump {
+		if err := dumpConfig(fs, os.Stdout); err != nil {
+			return nil, err
+		}
+		os.Exit(0)
+	}
+	if *verifyAuditPath != "" {
+		os.Exit(verifyAudit(*verifyAuditPath, os.Getenv("MCP_AUDIT_SIGNING_KEY"), os.Stdout))
+	}
+	if cfg.Strict {
+		applyStrict(fs, cfg)
+	}
+
+	cfg.Categories = splitList(*categories)
+	cfg.SpendCap.Period = claude.SpendPeriod(*spendPeriod)
+	timeouts, err := parseModelTimeouts(*modelTimeouts)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ModelTimeouts = timeouts
+	pricing, err := parseModelPricing(*modelPricing)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ModelPricing = pricing
+	if cfg.RiskMapping, err = parseRiskMapping(*riskMapping); err != nil {
+		return nil, err
+	}
+	for _, v := range splitList(*geoIPTrustedProxies) {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("-geoip-trusted-proxies: %w", err)
+		}
+		cfg.GeoIPTrustedProxies = append(cfg.GeoIPTrustedProxies, prefix.Masked())
+	}
+	cfg.RetryPolicies = make(map[claude.ErrorClass]claude.BackoffPolicy, len(retryFlags))
+	for class, v := range retryFlags {
+		policy, err := parseBackoff(*v)
+		if err != nil {
+			return nil, fmt.Errorf("retry policy for %s: %w", class, err)
+		}
+		cfg.RetryPolicies[class] = policy
+	}
+
+	cfg.OutboundAllowlist = splitList(*outboundAllowlist)
+	cfg.AnalyzeMode = analyzeMode(*defaultMode)
+	for _, m := range splitList(*allowedModes) {
+		cfg.AnalyzeModes = append(cfg.AnalyzeModes, analyzeMode(m))
+	}
+	cfg.NestedJSONKeys = splitList(*nestedJSONKeys)
+	cfg.GeoIPDatabases = splitList(*geoIPDatabases)
+	cfg.Callbacks.Hosts = splitList(*callbackHosts)
+	cfg.OutputRedaction = OutputRedaction{Keys: splitList(*redactOutputKeys), Patterns: splitList(*redactOutputPatterns)}
+	cfg.Verbosity = claude.Verbosity(*verbosity)
+	cfg.Languages = splitList(*languages)
+	cfg.PromptMissingKeys = claude.MissingKeyPolicy(*missingKeys)
+	cfg.SessionOverrides.Allow = splitList(*allowSessions)
+	cfg.SessionOverrides.Deny = splitList(*denySessions)
+	cfg.SessionOverrides.Precedence = claude.OverridePrecedence(*precedence)
+	cfg.SessionLimit.Missing = claude.MissingSessionPolicy(*missingSession)
+
+	if cfg.PromptTemplateDir != "" {
+		cfg.PromptTemplates, err = loadPromptTemplates(cfg.PromptTemplateDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.ClaudeAPIKey = os.Getenv("ANTHROPIC_API_KEY")
+	cfg.ClaudeBaseURL = os.Getenv("ANTHROPIC_BASE_URL")
+	cfg.AdminToken = os.Getenv("MCP_ADMIN_TOKEN")
+	secrets, err := parsePartnerSecrets(os.Getenv("MCP_PARTNER_SECRETS"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.PartnerSecrets = secrets
+	if key := os.Getenv("MCP_AUDIT_SIGNING_KEY"); key != "" {
+		if cfg.AuditSigner, err = store.ParseSigningKey(key); err != nil {
+			return nil, err
+		}
+		if !store.CanSign(cfg.AuditSigner) {
+			return nil, errors.New("MCP_AUDIT_SIGNING_KEY holds only a public key, which cannot sign records")
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.ClaudeAPIKey == "" {
+		return errors.New("ANTHROPIC_API_KEY must be set")
+	}
+	for _, key := range c.OutboundAllowlist {
+		if key == "images" {
+			continue
+		}
+		if section, name, ok := strings.Cut(key, "."); !ok || name == "" ||
+			(section != "user_data" && section != "session_data" && section != "technical_data") {
+			return fmt.Errorf("outbound-allowlist entry %q must be images or of the form user_data|session_data|technical_data.<key>", key)
+		}
+	}
+	if c.Model == "" {
+		return errors.New("model must not be empty")
+	}
+	if err := claude.ValidateCanaryPercent(c.CanaryPercent); err != nil {
+		return err
+	}
+	if c.CanaryPercent > 0 && c.CanaryModel == "" {
+		return errors.New("canary-percent requires canary-model")
+	}
+	if err := claude.ValidateShadowRate(c.ShadowSampleRate); err != nil {
+		return err
+	}
+	if c.HedgeDelay < 0 {
+		return errors.New("hedge-delay must not be negative")
+	}
+	if c.HedgeMaxInFlight < 1 {
+		return errors.New("hedge-max-in-flight must be at least 1")
+	}
+	if err := claude.ValidateHedgeFraction(c.HedgeDeadlineFraction); err != nil {
+		return err
+	}
+	if err := c.RiskMapping.Validate(); err != nil {
+		return fmt.Errorf("risk-mapping: %w", err)
+	}
+	if c.SpendCap.CapUSD < 0 {
+		return errors.New("spend-cap-usd must not be negative")
+	}
+	if c.SpendCap.DowngradeAt <= 0 || c.SpendCap.DowngradeAt > 1 {
+		return fmt.Errorf("spend-downgrade-at must be in (0, 1], got %v", c.SpendCap.DowngradeAt)
+	}
+	if c.SpendCap.Period != claude.SpendDaily && c.SpendCap.Period != claude.SpendMonthly {
+		return fmt.Errorf("spend-period must be daily or monthly, got %q", c.SpendCap.Period)
+	}
+	if c.WarmupGrace < 0 {
+		return errors.New("warmup-grace must not be negative")
+	}
+	if c.ModelsRefreshInterval < 0 {
+		return errors.New("models-refresh-interval must not be negative")
+	}
+	if c.MaxNestingDepth < 1 {
+		return errors.New("max-nesting-depth must be at least 1")
+	}
+	if len(c.Categories) == 0 {
+		return errors.New("categories must list at least one tag")
+	}
+	if c.MaxRequestTimeout <= 0 {
+		return errors.New("max-request-timeout must be positive")
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("cache-ttl must not be negative")
+	}
+	if c.CacheTTLJitter < 0 || c.CacheTTLJitter >= 1 {
+		return fmt.Errorf("cache-ttl-jitter must be in [0, 1), got %v", c.CacheTTLJitter)
+	}
+	if err := c.DecisionTTL.validate(); err != nil {
+		return err
+	}
+	if err := claude.ValidateDecisionMargin(c.DecisionThreshold, c.DecisionMargin); err != nil {
+		return err
+	}
+	if c.SLO.Target <= 0 || c.SLO.Window <= 0 {
+		return errors.New("slo-latency-target and slo-window must be positive")
+	}
+	if c.SLO.Objective <= 0 || c.SLO.Objective >= 1 {
+		return fmt.Errorf("slo-objective must be between 0 and 1 exclusive, got %v", c.SLO.Objective)
+	}
+	if c.LoadShed.SoftLimit < 0 {
+		return errors.New("shed-soft-limit must not be negative")
+	}
+	if c.LoadShed.SoftLimit > 0 && (c.LoadShed.HardLimit <= c.LoadShed.SoftLimit || c.LoadShed.Aggressiveness <= 0) {
+		return errors.New("shed-hard-limit must exceed shed-soft-limit and shed-aggressiveness must be positive")
+	}
+	if c.IdempotencyTTL < 0 || c.IdempotencyWait <= 0 {
+		return errors.New("idempotency-ttl must not be negative and idempotency-wait must be positive")
+	}
+	if c.SignatureMaxSkew <= 0 {
+		return errors.New("signature-max-skew must be positive")
+	}
+	if c.HysteresisWindow < 0 || c.HysteresisSwing < 0 {
+		return errors.New("hysteresis-window and hysteresis-swing must not be negative")
+	}
+	if _, err := claude.ParseMissingKeyPolicy(string(c.PromptMissingKeys)); err != nil {
+		return err
+	}
+	if _, err := claude.ParseOverridePrecedence(string(c.SessionOverrides.Precedence)); err != nil {
+		return err
+	}
+	if c.SessionLimit.Max < 0 || c.SessionLimit.Window <= 0 {
+		return errors.New("session-limit must not be negative and session-limit-window must be positive")
+	}
+	if _, err := claude.ParseMissingSessionPolicy(string(c.SessionLimit.Missing)); err != nil {
+		return err
+	}
+	if c.ParseRetries < 0 {
+		return errors.New("parse-retries must not be negative")
+	}
+	if c.ResponseWriteTimeout <= 0 {
+		return errors.New("response-write-timeout must be positive")
+	}
+	if c.ClaudeTimeout <= 0 {
+		return errors.New("claude-timeout must be positive")
+	}
+	if c.AnalysisTimeout <= 0 {
+		return errors.New("analysis-timeout must be positive")
+	}
+	if v, err := claude.ParseVerbosity(string(c.Verbosity)); err != nil || v == "" {
+		return fmt.Errorf("verbosity must be terse, normal or detailed, got %q", c.Verbosity)
+	}
+	for _, tag := range c.Languages {
+		if err := claude.ValidateLanguageTag(tag); err != nil {
+			return fmt.Errorf("languages: %w", err)
+		}
+	}
+	if !slices.ContainsFunc(c.Languages, func(tag string) bool { return strings.EqualFold(tag, c.DefaultLanguage) }) {
+		return fmt.Errorf("default-language %q must be one of languages", c.DefaultLanguage)
+	}
+	if c.NestedJSONDepth < 1 {
+		return errors.New("nested-json-depth must be at least 1")
+	}
+	if c.FeedbackMinLabels < 0 {
+		return errors.New("feedback-min-labels must not be negative")
+	}
+	if c.HistoryQueryLimits.MaxParams < 1 || c.HistoryQueryLimits.MaxValueBytes < 1 {
+		return errors.New("history-max-query-params and history-max-query-value-bytes must be at least 1")
+	}
+	if c.StatsStreamInterval <= 0 {
+		return errors.New("stats-stream-interval must be positive")
+	}
+	if c.LastErrors < 1 {
+		return errors.New("last-errors must be at least 1")
+	}
+	if c.AsyncMaxJobs < 1 || c.AsyncRetention <= 0 || c.AsyncDrainTimeout < 0 {
+		return errors.New("async-max-jobs must be at least 1, async-retention positive and async-drain-timeout not negative")
+	}
+	if c.Callbacks.Timeout <= 0 || c.Callbacks.BatchSize < 0 {
+		return errors.New("callback-timeout must be positive and callback-batch-size not negative")
+	}
+	if c.Callbacks.BatchSize > 1 && c.Callbacks.FlushInterval <= 0 {
+		return errors.New("callback-flush-interval must be positive when batching callbacks")
+	}
+	for _, m := range append([]analyzeMode{c.AnalyzeMode}, c.AnalyzeModes...) {
+		if m != modeSync && m != modeAsync {
+			return fmt.Errorf("unknown analyze mode %q (want sync or async)", m)
+		}
+	}
+	if !slices.Contains(c.AnalyzeModes, c.AnalyzeMode) {
+		return fmt.Errorf("analyze-mode %s must be one of analyze-modes", c.AnalyzeMode)
+	}
+	if c.MaxBatchSize < 1 || c.BatchConcurrency < 1 {
+		return errors.New("max-batch-size and batch-concurrency must be at least 1")
+	}
+	if c.BatchStreamHeartbeat <= 0 {
+		return errors.New("batch-stream-heartbeat must be positive")
+	}
+	if c.ConfidenceStep < 0 || c.ConfidenceStep > 1 {
+		return fmt.Errorf("confidence-step must be between 0 and 1, got %v", c.ConfidenceStep)
+	}
+	if err := c.OutputRedaction.validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadPromptTemplates reads every <name>.txt file in dir as a named prompt
+// template.
+func loadPromptTemplates(dir string) (map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("listing prompt templates: %w", err)
+	}
+	templates := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading prompt template: %w", err)
+		}
+		text := strings.TrimSpace(string(data))
+		if text == "" {
+			return nil, fmt.Errorf("prompt template %s is empty", path)
+		}
+		templates[strings.TrimSuffix(filepath.Base(path), ".txt")] = text
+	}
+	return templates, nil
+}
+
+// parseModelTimeouts parses the -model-timeouts flag value.
+func parseModelTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range splitList(s) {
+		model, v, ok := strings.Cut(entry, "=")
+		if !ok || model == "" {
+			return nil, fmt.Errorf("model-timeouts entry %q must be of the form model=duration", entry)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("model-timeouts entry %q has an invalid duration", entry)
+		}
+		timeouts[model] = d
+	}
+	return timeouts, nil
+}
+
+// parseRiskMapping parses the -risk-mapping flag value.
+func parseRiskMapping(s string) (claude.RiskMapping, error) {
+	if s == "linear" {
+		return claude.DefaultRiskMapping, nil
+	}
+	var m claude.RiskMapping
+	for _, entry := range splitList(s) {
+		conf, risk, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("risk-mapping entry %q must be of the form confidence:risk", entry)
+		}
+		c, err := strconv.ParseFloat(conf, 64)
+		if err != nil {
+			return nil, fmt.Errorf("risk-mapping entry %q has an invalid confidence", entry)
+		}
+		r, err := strconv.ParseFloat(risk, 64)
+		if err != nil {
+			return nil, fmt.Errorf("risk-mapping entry %q has an invalid risk", entry)
+		}
+		m = append(m, claude.RiskPoint{Confidence: c, Risk: r})
+	}
+	return m, nil
+}
+
+// parseModelPricing parses the -model-pricing flag value.
+func parseModelPricing(s string) (map[string]claude.ModelPricing, error) {
+	pricing := make(map[string]claude.ModelPricing)
+	for _, entry := range splitList(s) {
+		model, prices, ok := strings.Cut(entry, "=")
+		in, out, ok2 := strings.Cut(prices, ":")
+		if !ok || !ok2 || model == "" {
+			return nil, fmt.Errorf("model-pricing entry %q must be of the form model=input:output", entry)
+		}
+		input, err := strconv.ParseFloat(in, 64)
+		if err != nil || input < 0 {
+			return nil, fmt.Errorf("model-pricing entry %q has an invalid input price", entry)
+		}
+		output, err := strconv.ParseFloat(out, 64)
+		if err != nil || output < 0 {
+			return nil, fmt.Errorf("model-pricing entry %q has an invalid output price", entry)
+		}
+		pricing[model] = claude.ModelPricing{InputPerMTok: input, OutputPerMTok: output}
+	}
+	return pricing, nil
+}
+
+// parseBackoff parses a retries:initial:max retry policy flag value.
+func parseBackoff(s string) (claude.BackoffPolicy, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return claude.BackoffPolicy{}, fmt.Errorf("%q must be of the form retries:initial:max", s)
+	}
+	retries, err := strconv.Atoi(parts[0])
+	if err != nil || retries < 0 {
+		return claude.BackoffPolicy{}, fmt.Errorf("%q has an invalid retry count", s)
+	}
+	initial, err := time.ParseDuration(parts[1])
+	if err != nil || initial < 0 {
+		return claude.BackoffPolicy{}, fmt.Errorf("%q has an invalid initial delay", s)
+	}
+	maxDelay, err := time.ParseDuration(parts[2])
+	if err != nil || maxDelay < initial {
+		return claude.BackoffPolicy{}, fmt.Errorf("%q has an invalid maximum delay", s)
+	}
+	return claude.BackoffPolicy{MaxRetries: retries, Initial: initial, Max: maxDelay}, nil
+}
+
+func formatBackoff(p claude.BackoffPolicy) string {
+	return fmt.Sprintf("%d:%s:%s", p.MaxRetries, p.Initial, p.Max)
+}
+
+// strictToggles maps each tolerant behavior's flag to the field that turns
+// it off. -strict sets every field whose flag was not given explicitly.
+func strictToggles(cfg *Config) map[string]*bool {
+	return map[string]*bool{
+		"reject-empty-reasoning":    &cfg.RejectEmptyReasoning,
+		"reject-unknown-categories": &cfg.RejectUnknownCategories,
+		"reject-extra-fields":       &cfg.RejectExtraFields,
+		"reject-unknown-fields":     &cfg.RejectUnknownFields,
+		"store-strict":              &cfg.StoreStrict,
+	}
+}
+
+func applyStrict(fs *flag.FlagSet, cfg *Config) {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, toggle := range strictToggles(cfg) {
+		if !explicit[name] {
+			*toggle = true
+		}
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
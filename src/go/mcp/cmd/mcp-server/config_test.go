@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// parseConfig loads a Config from args on a fresh flag set.
+func parseConfig(t *testing.T, args ...string) *Config {
+	t.Helper()
+	cfg, _ := parseConfigFlags(t, args...)
+	return cfg
+}
+
+// parseConfigFlags is parseConfig, also returning the flag set.
+func parseConfigFlags(t *testing.T, args ...string) (*Config, *flag.FlagSet) {
+	t.Helper()
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	fs := flag.NewFlagSet("mcp-server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		t.Fatalf("loadConfig(%q): %v", args, err)
+	}
+	return cfg, fs
+}
+
+func TestStrictSetsTogglesUnlessExplicit(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want map[string]bool
+	}{
+		{nil, map[string]bool{"reject-empty-reasoning": false, "reject-unknown-categories": false, "reject-extra-fields": false, "reject-unknown-fields": false, "store-strict": false}},
+		{[]string{"-strict"}, map[string]bool{"reject-empty-reasoning": true, "reject-unknown-categories": true, "reject-extra-fields": true, "reject-unknown-fields": true, "store-strict": true}},
+		{[]string{"-strict", "-reject-extra-fields=false"}, map[string]bool{"reject-empty-reasoning": true, "reject-unknown-categories": true, "reject-extra-fields": false, "reject-unknown-fields": true, "store-strict": true}},
+		{[]string{"-strict", "-store-strict=false"}, map[string]bool{"reject-empty-reasoning": true, "reject-unknown-categories": true, "reject-extra-fields": true, "reject-unknown-fields": true, "store-strict": false}},
+		{[]string{"-reject-unknown-fields"}, map[string]bool{"reject-empty-reasoning": false, "reject-unknown-categories": false, "reject-extra-fields": false, "reject-unknown-fields": true, "store-strict": false}},
+		{[]string{"-store-strict"}, map[string]bool{"reject-empty-reasoning": false, "reject-unknown-categories": false, "reject-extra-fields": false, "reject-unknown-fields": false, "store-strict": true}},
+	} {
+		cfg := parseConfig(t, tc.args...)
+		toggles := strictToggles(cfg)
+		if len(toggles) != len(tc.want) {
+			t.Fatalf("strictToggles has %d entries, want %d", len(toggles), len(tc.want))
+		}
+		for name, want := range tc.want {
+			if got := *toggles[name]; got != want {
+				t.Errorf("%q: %s = %t, want %t", tc.args, name, got, want)
+			}
+		}
+	}
+}
+
+func TestStrictRejectsWhatLenientTolerates(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, reply string
+	}{
+		{"unknown request field", `{"user_data": {"email": "user@example.com"}, "extra": 1}`, decision(true, 0.9, "Consistent signals.")},
+		{"empty reasoning", analyzeBody, decision(true, 0.9, "")},
+		{"extra decision field", analyzeBody, `{"is_likely_live": true, "confidence": 0.9, "reasoning": "Consistent signals.", "notes": "x"}`},
+		{"unknown category", analyzeBody, `{"is_likely_live": false, "confidence": 0.2, "reasoning": "Scripted input.", "categories": ["made_up"]}`},
+	} {
+		for _, strict := range []bool{false, true} {
+			var args []string
+			if strict {
+				args = []string{"-strict"}
+			}
+			cfg := parseConfig(t, args...)
+			stub := newClaudeStub(t, tc.reply)
+			svc := newTestService(t, stub,
+				claude.WithParseRetries(0),
+				claude.WithRejectEmptyReasoning(cfg.RejectEmptyReasoning),
+				claude.WithRejectUnknownCategories(cfg.RejectUnknownCategories),
+				claude.WithRejectExtraFields(cfg.RejectExtraFields))
+			h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+			rec := post(h, "/analyze", tc.body, nil)
+			if ok := rec.Code == http.StatusOK; ok == strict {
+				t.Errorf("%s, strict %t: status = %d, body %s", tc.name, strict, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+// derivedConfigFields maps the Config fields that are not bound directly
+// to a flag to the flags or environment variables they are parsed from.
+var derivedConfigFields = map[string][]string{
+	"ClaudeAPIKey":                {"ANTHROPIC_API_KEY"},
+	"ClaudeBaseURL":               {"ANTHROPIC_BASE_URL"},
+	"AdminToken":                  {"MCP_ADMIN_TOKEN"},
+	"PartnerSecrets":              {"MCP_PARTNER_SECRETS"},
+	"AuditSigner":                 {"MCP_AUDIT_SIGNING_KEY"},
+	"ModelPricing":                {"model-pricing"},
+	"RiskMapping":                 {"risk-mapping"},
+	"ModelTimeouts":               {"model-timeouts"},
+	"SpendCap.Period":             {"spend-period"},
+	"RetryPolicies":               {"retry-rate-limited", "retry-overloaded", "retry-server-error", "retry-unavailable"},
+	"GeoIPDatabases":              {"geoip-db"},
+	"GeoIPTrustedProxies":         {"geoip-trusted-proxies"},
+	"SessionOverrides.Allow":      {"allow-sessions"},
+	"SessionOverrides.Deny":       {"deny-sessions"},
+	"SessionOverrides.Precedence": {"override-precedence"},
+	"SessionLimit.Missing":        {"session-limit-missing"},
+	"NestedJSONKeys":              {"nested-json-keys"},
+	"Callbacks.Hosts":             {"callback-hosts"},
+	"AnalyzeMode":                 {"analyze-mode"},
+	"AnalyzeModes":                {"analyze-modes"},
+	"OutputRedaction.Keys":        {"redact-output-keys"},
+	"OutputRedaction.Patterns":    {"redact-output-patterns"},
+	"OutboundAllowlist":           {"outbound-allowlist"},
+	"Categories":                  {"categories"},
+	"PromptTemplates":             {"prompt-template-dir"},
+	"PromptMissingKeys":           {"prompt-missing-keys"},
+	"Verbosity":                   {"verbosity"},
+	"Languages":                   {"languages"},
+}
+
+func TestDumpConfigCoversEveryField(t *testing.T) {
+	cfg, fs := parseConfigFlags(t)
+	var dump bytes.Buffer
+	if err := dumpConfig(fs, &dump); err != nil {
+		t.Fatalf("dumpConfig: %v", err)
+	}
+	dumped := func(name string) bool {
+		if strings.ToUpper(name) == name {
+			return strings.Contains(dump.String(), "#   "+name+": ")
+		}
+		return strings.Contains(dump.String(), "\n"+name+": ")
+	}
+
+	// Flags bound with fs.XxxVar point at their Config field.
+	bound := make(map[uintptr]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if configFileFlags[f.Name] {
+			return
+		}
+		if !dumped(f.Name) {
+			t.Errorf("flag -%s missing from the dump", f.Name)
+		}
+		if v := reflect.ValueOf(f.Value); v.Kind() == reflect.Pointer {
+			bound[v.Pointer()] = f.Name
+		}
+	})
+
+	seen := make(map[string]bool)
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := range v.NumField() {
+			field, path := v.Field(i), prefix+v.Type().Field(i).Name
+			if sources, ok := derivedConfigFields[path]; ok {
+				seen[path] = true
+				for _, name := range sources {
+					if !dumped(name) {
+						t.Errorf("Config.%s: its source %s is missing from the dump", path, name)
+					}
+				}
+				continue
+			}
+			if field.Kind() == reflect.Struct {
+				walk(path+".", field)
+				continue
+			}
+			if _, ok := bound[field.Addr().Pointer()]; !ok {
+				t.Errorf("Config.%s is set by no flag; bind one or list its source in derivedConfigFields", path)
+			}
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	for path := range derivedConfigFields {
+		if !seen[path] {
+			t.Errorf("derivedConfigFields lists %s, which is not a Config field", path)
+		}
+	}
+}
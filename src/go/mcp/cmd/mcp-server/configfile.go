@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envSettings are the settings read from the environment rather than flags
+// because they are secrets; the config dump lists them for completeness.
+var envSettings = []struct{ name, usage string }{
+	{"ANTHROPIC_API_KEY", "Claude API key (required)"},
+	{"ANTHROPIC_BASE_URL", "Overrides the Anthropic API base URL"},
+	{"MCP_ADMIN_TOKEN", "Bearer token guarding the operator endpoints; empty leaves them open"},
+	{"MCP_PARTNER_SECRETS", "Comma-separated partner=secret pairs; when set, analysis requests must be HMAC-signed"},
+	{"MCP_AUDIT_SIGNING_KEY", "hmac:<hex> or ed25519:<hex seed> key signing each stored record"},
+}
+
+// configFileFlags are the flags that manage the config file itself, or run
+// one-off modes, and so don't belong in it.
+var configFileFlags = map[string]bool{"config": true, "dump-config": true, "verify-audit": true}
+
+// dumpConfig writes every flag as a commented YAML config file loadable
+// with -config. Each entry holds the flag's current value, with its
+// default noted when the two differ.
+func dumpConfig(fs *flag.FlagSet, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# mcp-server configuration. Load with -config <file>; flags given on the")
+	fmt.Fprintln(bw, "# command line take precedence over this file.")
+	fmt.Fprintln(bw, "#")
+	fmt.Fprintln(bw, "# Secrets are read from the environment only:")
+	for _, env := range envSettings {
+		fmt.Fprintf(bw, "#   %s: %s\n", env.name, env.usage)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if configFileFlags[f.Name] {
+			return
+		}
+		fmt.Fprintf(bw, "\n# %s", f.Usage)
+		if v := f.Value.String(); v != f.DefValue {
+			fmt.Fprintf(bw, " (default %s)", yamlScalar(f.DefValue))
+		}
+		fmt.Fprintf(bw, "\n%s: %s\n", f.Name, yamlScalar(f.Value.String()))
+	})
+	return bw.Flush()
+}
+
+// yamlScalar renders s as a YAML scalar, quoting it unless it is plainly
+// safe.
+func yamlScalar(s string) string {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, ":#,[]{}&*!|>'\"%@`\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// applyConfigFile sets the flags listed in the YAML config file at path,
+// skipping those given explicitly on the command line. Only the flat
+// "name: value" form written by dumpConfig is understood.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening config file: %w", err)
+	}
+	defer f.Close()
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return fmt.Errorf("config file %s line %d: expected name: value", path, line)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return fmt.Errorf("config file %s line %d: malformed quoted value", path, line)
+			}
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		if configFileFlags[name] || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s line %d: unknown setting %q", path, line, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file %s line %d: %s: %v", path, line, name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// DecisionTTLConfig maps a decision to how long clients may cache it.
+// Confidence is the likelihood that the user is live, so a live decision is
+// decisive at or above HighConfidence and a not-live decision at or below
+// 1-HighConfidence. Everything in between is treated as uncertain.
+type DecisionTTLConfig struct {
+	HighConfidence float64
+	Live           time.Duration
+	NotLive        time.Duration
+	Uncertain      time.Duration
+}
+
+// For returns the client cache lifetime for result.
+func (c DecisionTTLConfig) For(result *claude.LivenessAnalysisResult) time.Duration {
+	switch {
+	case result.IsLikelyLive && result.Confidence >= c.HighConfidence:
+		return c.Live
+	case !result.IsLikelyLive && result.Confidence <= 1-c.HighConfidence:
+		return c.NotLive
+	default:
+		return c.Uncertain
+	}
+}
+
+func (c DecisionTTLConfig) validate() error {
+	if c.HighConfidence < 0.5 || c.HighConfidence > 1 {
+		return fmt.Errorf("decision-ttl-high-confidence must be between 0.5 and 1, got %v", c.HighConfidence)
+	}
+	if c.Live < 0 || c.NotLive < 0 || c.Uncertain < 0 {
+		return errors.New("decision TTLs must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDecisionTTLByOutcomeAndConfidence(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		live         bool
+		confidence   float64
+		uncertain    time.Duration
+		cacheControl string
+		ttlSeconds   int
+	}{
+		{"decisive live", true, 0.9, 0, "private, max-age=600", 600},
+		{"decisive not live", false, 0.1, 0, "private, max-age=300", 300},
+		{"uncertain live", true, 0.6, 0, "no-store", 0},
+		{"uncertain not live", false, 0.3, 0, "no-store", 0},
+		{"uncertain with a TTL", true, 0.6, 30 * time.Second, "private, max-age=30", 30},
+		{"at the threshold", true, 0.8, 0, "private, max-age=600", 600},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := newClaudeStub(t, decision(tc.live, tc.confidence, "Signals."))
+			svc := newTestService(t, stub)
+			cfg := testConfig()
+			cfg.DecisionTTL.Uncertain = tc.uncertain
+			h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+			rec := post(h, "/analyze", analyzeBody, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tc.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tc.cacheControl)
+			}
+			var body analyzeResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if body.DecisionTTLSeconds != tc.ttlSeconds {
+				t.Errorf("decision_ttl_seconds = %d, want %d", body.DecisionTTLSeconds, tc.ttlSeconds)
+			}
+		})
+	}
+}
+
+func TestDecisionTTLConfigValidate(t *testing.T) {
+	valid := testConfig().DecisionTTL
+	if err := valid.validate(); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+	for name, c := range map[string]DecisionTTLConfig{
+		"threshold below 0.5": {HighConfidence: 0.4},
+		"threshold above 1":   {HighConfidence: 1.1},
+		"negative TTL":        {HighConfidence: 0.8, Uncertain: -time.Second},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%s: validate accepted %+v", name, c)
+		}
+	}
+}
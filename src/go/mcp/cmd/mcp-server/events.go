@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// decisionEvent is one line of the decision event stream. Input data and the
+// raw Claude response are never included, and the reasoning is masked as in
+// client responses.
+type decisionEvent struct {
+	EventType     string         `json:"event_type"` // Always "decision"
+	Time          time.Time      `json:"time"`
+	Endpoint      string         `json:"endpoint"`
+	RequestID     string         `json:"request_id,omitempty"`
+	TraceID       string         `json:"trace_id,omitempty"`
+	Outcome       claude.Outcome `json:"outcome"`
+	IsLikelyLive  bool           `json:"is_likely_live"`
+	Confidence    float64        `json:"confidence"`
+	Reasoning     string         `json:"reasoning,omitempty"`
+	Categories    []string       `json:"categories,omitempty"`
+	Model         string         `json:"model,omitempty"`
+	RuleOnly      bool           `json:"rule_only,omitempty"`
+	PolicyVersion string         `json:"policy_version"`
+}
+
+// decisionEmitter writes one JSON decision event per line to its own stream,
+// separate from the operational log. A nil emitter discards events.
+type decisionEmitter struct {
+	policyVersion string
+	redaction     OutputRedaction
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// openDecisionEmitter returns an emitter for dest: "" disables events,
+// "stdout" and "stderr" select those streams, and anything else is a file
+// path appended to. Reasoning is masked under redaction.
+func openDecisionEmitter(dest, policyVersion string, redaction OutputRedaction) (*decisionEmitter, io.Closer, error) {
+	var w io.Writer
+	var closer io.Closer
+	switch dest {
+	case "":
+		return nil, nil, nil
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening decision event file: %w", err)
+		}
+		w, closer = f, f
+	}
+	return newDecisionEmitter(w, policyVersion, redaction), closer, nil
+}
+
+func newDecisionEmitter(w io.Writer, policyVersion string, redaction OutputRedaction) *decisionEmitter {
+	return &decisionEmitter{policyVersion: policyVersion, redaction: redaction, enc: json.NewEncoder(w)}
+}
+
+// emit writes the event for a decision on input served by endpoint.
+func (e *decisionEmitter) emit(endpoint, requestID, traceID string, result *claude.LivenessAnalysisResult, input claude.AnalyzeDataForLivenessInput) {
+	if e == nil {
+		return
+	}
+	reasoning := result.Reasoning
+	if e.redaction.enabled() {
+		reasoning = e.redaction.redact(reasoning, e.redaction.valuesPattern(input))
+	}
+	ev := decisionEvent{
+		EventType:     "decision",
+		Time:          time.Now().UTC(),
+		Endpoint:      endpoint,
+		RequestID:     requestID,
+		TraceID:       traceID,
+		Outcome:       result.Outcome,
+		IsLikelyLive:  result.IsLikelyLive,
+		Confidence:    result.Confidence,
+		Reasoning:     reasoning,
+		Categories:    result.Categories,
+		Model:         result.Model,
+		RuleOnly:      result.RuleOnly,
+		PolicyVersion: e.policyVersion,
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enc.Encode(ev); err != nil {
+		log.Printf("Writing decision event failed: %v", err)
+	}
+}
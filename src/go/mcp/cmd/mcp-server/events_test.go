@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecisionEventFormat(t *testing.T) {
+	stub := newClaudeStub(t, decision(false, 0.2, "Same address user@example.com on every attempt."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	cfg.OutputRedaction = OutputRedaction{Patterns: []string{"email"}}
+	var events bytes.Buffer
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, newDecisionEmitter(&events, svc.PolicyVersion(), cfg.OutputRedaction), newErrorLog(cfg.LastErrors))
+
+	for i := 0; i < 2; i++ {
+		if rec := post(h, "/analyze", analyzeBody, nil); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(events.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d event lines, want one per decision:\n%s", len(lines), events.String())
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &fields); err != nil {
+		t.Fatalf("event is not a JSON object: %v", err)
+	}
+	for _, key := range []string{"event_type", "time", "endpoint", "request_id", "outcome", "is_likely_live", "confidence", "reasoning", "policy_version"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("event lacks %q: %s", key, lines[0])
+		}
+	}
+	for _, key := range []string{"user_data", "session_data", "technical_data", "raw_response"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("event carries %q: %s", key, lines[0])
+		}
+	}
+	var ev decisionEvent
+	json.Unmarshal([]byte(lines[0]), &ev)
+	if ev.EventType != "decision" || ev.Endpoint != "/analyze" || ev.Outcome != "not_live" || ev.PolicyVersion != svc.PolicyVersion() {
+		t.Errorf("event = %+v", ev)
+	}
+	if ev.Reasoning != "Same address [redacted] on every attempt." {
+		t.Errorf("event reasoning = %q, want the email masked", ev.Reasoning)
+	}
+	if strings.Contains(events.String(), "user@example.com") {
+		t.Error("events repeat the input email")
+	}
+}
+
+func TestDecisionEventsIgnoreLogLevel(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr); debugLogging = false })
+
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	for _, debug := range []bool{false, true} {
+		debugLogging = debug
+		var events bytes.Buffer
+		h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, newDecisionEmitter(&events, svc.PolicyVersion(), cfg.OutputRedaction), newErrorLog(cfg.LastErrors))
+		post(h, "/analyze", analyzeBody, nil)
+
+		scanner := bufio.NewScanner(&events)
+		n := 0
+		for scanner.Scan() {
+			n++
+		}
+		if n != 1 {
+			t.Errorf("debug logging %t: %d events, want 1", debug, n)
+		}
+	}
+	if strings.Contains(logs.String(), `"event_type"`) {
+		t.Errorf("decision events reached the operational log:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+// feedbackRequest is the body accepted by POST /feedback.
+type feedbackRequest struct {
+	RequestID  string `json:"request_id"`
+	ActualLive *bool  `json:"actual_live"`
+}
+
+// feedbackResponse reports the labeled decision and the running accuracy.
+type feedbackResponse struct {
+	RequestID     string `json:"request_id"`
+	PredictedLive bool   `json:"predicted_live"`
+	ActualLive    bool   `json:"actual_live"`
+	Correct       bool   `json:"correct"`
+	Labeled       int    `json:"labeled"`
+	// Accuracy is the share of labeled decisions predicted correctly,
+	// omitted until enough labels exist for it to be meaningful.
+	Accuracy *float64 `json:"accuracy,omitempty"`
+}
+
+// feedbackMetrics tracks ground-truth labels and the resulting accuracy.
+type feedbackMetrics struct {
+	labels    *metrics.Counter
+	accuracy  *metrics.Gauge
+	minLabels int
+}
+
+func newFeedbackMetrics(r *metrics.Registry, minLabels int) *feedbackMetrics {
+	return &feedbackMetrics{
+		labels:    r.NewCounter("mcp_feedback_labels_total", "Ground-truth labels received via POST /feedback."),
+		accuracy:  r.NewGauge("mcp_feedback_accuracy", "Share of labeled decisions whose prediction matched the label; 0 until the minimum number of labels exists."),
+		minLabels: minLabels,
+	}
+}
+
+// update recomputes the accuracy from st and returns it, or nil while fewer
+// than minLabels decisions are labeled.
+func (m *feedbackMetrics) update(st *store.JSONLStore) (labeled int, accuracy *float64) {
+	labeled, correct := st.Accuracy()
+	if labeled < m.minLabels || labeled == 0 {
+		return labeled, nil
+	}
+	a := float64(correct) / float64(labeled)
+	m.accuracy.Set(a)
+	return labeled, &a
+}
+
+// feedbackHandler serves POST /feedback, recording whether the user behind a
+// previously served decision was actually live.
+func feedbackHandler(st *store.JSONLStore, m *feedbackMetrics, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var req feedbackRequest
+		if !decodeBody(w, r, &req, cfg.RejectUnknownFields) {
+			return
+		}
+		if req.RequestID == "" || req.ActualLive == nil {
+			writeError(w, http.StatusBadRequest, "request_id and actual_live are required")
+			return
+		}
+
+		rec, err := st.Label(context.WithoutCancel(r.Context()), req.RequestID, *req.ActualLive)
+		if errors.Is(err, store.ErrUnknownRequest) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("Recording feedback for %s failed: %v", req.RequestID, err)
+			writeError(w, http.StatusInternalServerError, "recording feedback failed")
+			return
+		}
+		m.labels.Inc()
+		labeled, accuracy := m.update(st)
+		writeJSON(w, http.StatusOK, feedbackResponse{
+			RequestID:     req.RequestID,
+			PredictedLive: rec.Result.IsLikelyLive,
+			ActualLive:    *req.ActualLive,
+			Correct:       rec.Result.IsLikelyLive == *req.ActualLive,
+			Labeled:       labeled,
+			Accuracy:      accuracy,
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/metrics"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+func TestFeedbackRecordsLabelsAndAccuracy(t *testing.T) {
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	for id, live := range map[string]bool{"r1": true, "r2": true, "r3": false, "r4": true} {
+		if err := st.SaveServed(t.Context(), id, &claude.LivenessAnalysisResult{IsLikelyLive: live, Confidence: 0.9}); err != nil {
+			t.Fatalf("SaveServed: %v", err)
+		}
+	}
+	m := newFeedbackMetrics(metrics.NewRegistry(), 3)
+	h := requireAdmin("secret", feedbackHandler(st, m, testConfig()))
+	auth := http.Header{"Authorization": {"Bearer secret"}}
+
+	if rec := post(h, "/feedback", `{"request_id": "r1", "actual_live": true}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", rec.Code)
+	}
+
+	for i, tc := range []struct {
+		id           string
+		actual       bool
+		correct      bool
+		wantAccuracy *float64
+	}{
+		{"r1", true, true, nil}, // Below the minimum labels, no accuracy yet
+		{"r2", false, false, nil},
+		{"r3", false, true, ptr(2.0 / 3)},
+		{"r4", true, true, ptr(3.0 / 4)},
+	} {
+		rec := post(h, "/feedback", fmt.Sprintf(`{"request_id": %q, "actual_live": %t}`, tc.id, tc.actual), auth)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tc.id, rec.Code, rec.Body)
+		}
+		var resp feedbackResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decoding response: %v", tc.id, err)
+		}
+		if resp.Correct != tc.correct || resp.Labeled != i+1 {
+			t.Errorf("%s: correct %t, labeled %d; want %t, %d", tc.id, resp.Correct, resp.Labeled, tc.correct, i+1)
+		}
+		switch {
+		case tc.wantAccuracy == nil && resp.Accuracy != nil:
+			t.Errorf("%s: accuracy %v reported before the minimum labels", tc.id, *resp.Accuracy)
+		case tc.wantAccuracy != nil && (resp.Accuracy == nil || *resp.Accuracy != *tc.wantAccuracy):
+			t.Errorf("%s: accuracy = %v, want %v", tc.id, resp.Accuracy, *tc.wantAccuracy)
+		}
+	}
+	if got := m.accuracy.Value(); got != 0.75 {
+		t.Errorf("mcp_feedback_accuracy = %v, want 0.75", got)
+	}
+	if got := m.labels.Value(); got != 4 {
+		t.Errorf("mcp_feedback_labels_total = %v, want 4", got)
+	}
+
+	if rec := post(h, "/feedback", `{"request_id": "unknown", "actual_live": true}`, auth); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown request ID: status = %d, want 404", rec.Code)
+	}
+	if rec := post(h, "/feedback", `{"request_id": "r1"}`, auth); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing actual_live: status = %d, want 400", rec.Code)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
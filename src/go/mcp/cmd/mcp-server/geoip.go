@@ -0,0 +1,192 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/geoip"
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// technical_data keys filled in from the GeoIP databases when the client
+// didn't send them.
+const (
+	geoCountryKey      = "ip_country"
+	geoASNKey          = "ip_asn"
+	geoOrganizationKey = "ip_as_organization"
+)
+
+// geoEnricher adds the location of a request's client IP to the technical
+// data of its analyses. The databases are loaded into memory once and
+// swapped on reload; a database that can't be loaded is skipped, so with
+// none loaded enrichment does nothing.
+type geoEnricher struct {
+	paths    []string
+	ipHeader string
+	trusted  []netip.Prefix // Proxies whose hops in ipHeader are skipped
+	enriched *metrics.Counter
+
+	mu      sync.RWMutex
+	readers map[string]*geoip.Reader // Keyed by path
+}
+
+// newGeoEnricher loads the databases at paths. It returns nil, which
+// enriches nothing, when paths is empty. The client IP is read from
+// ipHeader, when set, skipping the hops of trusted proxies.
+func newGeoEnricher(paths []string, ipHeader string, trusted []netip.Prefix, registry *metrics.Registry) *geoEnricher {
+	if len(paths) == 0 {
+		return nil
+	}
+	g := &geoEnricher{
+		paths:    paths,
+		ipHeader: ipHeader,
+		trusted:  trusted,
+		enriched: registry.NewCounter("mcp_geoip_enriched_total", "Analysis inputs whose technical_data was enriched from the GeoIP databases."),
+		readers:  make(map[string]*geoip.Reader),
+	}
+	g.reload()
+	return g
+}
+
+// reload re-reads the databases and returns how many are loaded. A
+// database that fails to load keeps its previous version, if any.
+func (g *geoEnricher) reload() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, path := range g.paths {
+		r, err := geoip.Open(path)
+		if err != nil {
+			if _, loaded := g.readers[path]; loaded {
+				log.Printf("Reloading GeoIP database %s failed, keeping the loaded version: %v", path, err)
+			} else {
+				log.Printf("GeoIP database %s unavailable, skipping: %v", path, err)
+			}
+			continue
+		}
+		g.readers[path] = r
+		log.Printf("Loaded GeoIP database %s (%s)", path, r.DatabaseType())
+	}
+	return len(g.readers)
+}
+
+// lookup merges what the loaded databases know about addr.
+func (g *geoEnricher) lookup(addr netip.Addr) (geoip.Record, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var rec geoip.Record
+	found := false
+	for _, path := range g.paths {
+		r := g.readers[path]
+		if r == nil {
+			continue
+		}
+		got, ok, err := r.Lookup(addr)
+		if err != nil {
+			log.Printf("GeoIP lookup in %s failed: %v", path, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		if rec.Country == "" {
+			rec.Country = got.Country
+		}
+		if rec.ASN == 0 {
+			rec.ASN, rec.Organization = got.ASN, got.Organization
+		}
+	}
+	return rec, found
+}
+
+// clientAddr returns the client IP of r. With a configured header, that
+// is the rightmost of its addresses not within a trusted proxy: each proxy
+// appends the address it received the request from, so hops to the left
+// of the first untrusted one were supplied by the client and can be
+// forged. The proxy in front of the server must therefore append to the
+// header rather than pass the client's through. Without the header, or
+// when every hop is trusted, the connection's peer is used.
+func (g *geoEnricher) clientAddr(r *http.Request) (netip.Addr, bool) {
+	if g.ipHeader != "" {
+		var hops []string
+		for _, v := range r.Header.Values(g.ipHeader) {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return netip.Addr{}, false
+			}
+			if addr = addr.Unmap(); !g.isTrusted(addr) {
+				return addr, true
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr, err == nil
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy.
+func (g *geoEnricher) isTrusted(addr netip.Addr) bool {
+	for _, p := range g.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// enrich adds the country and ASN of r's client to the technical data of
+// input. Keys the client already provided are kept.
+func (g *geoEnricher) enrich(r *http.Request, input *claude.AnalyzeDataForLivenessInput) {
+	if g == nil {
+		return
+	}
+	addr, ok := g.clientAddr(r)
+	if !ok {
+		return
+	}
+	rec, ok := g.lookup(addr)
+	if !ok {
+		return
+	}
+	fields := make(map[string]interface{}, 3)
+	if rec.Country != "" {
+		fields[geoCountryKey] = rec.Country
+	}
+	if rec.ASN != 0 {
+		fields[geoASNKey] = rec.ASN
+	}
+	if rec.Organization != "" {
+		fields[geoOrganizationKey] = rec.Organization
+	}
+	if len(fields) == 0 {
+		return
+	}
+	added := false
+	for k, v := range fields {
+		if _, provided := input.TechnicalData[k]; provided {
+			continue
+		}
+		if input.TechnicalData == nil {
+			input.TechnicalData = make(map[string]interface{}, len(fields))
+		}
+		input.TechnicalData[k] = v
+		added = true
+	}
+	if added {
+		g.enriched.Inc()
+	}
+}
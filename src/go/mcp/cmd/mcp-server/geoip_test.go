@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// geoFixtures are the test databases of pkg/geoip: a Country database
+// and an ASN database.
+var geoFixtures = []string{
+	filepath.Join("..", "..", "pkg", "geoip", "testdata", "test-country.mmdb"),
+	filepath.Join("..", "..", "pkg", "geoip", "testdata", "test-asn.mmdb"),
+}
+
+func TestGeoClientAddr(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8:ffff::/48")}
+	for _, tc := range []struct {
+		header  string
+		trusted []netip.Prefix
+		values  []string
+		want    string // Empty when no address is usable
+	}{
+		{"", nil, nil, "192.0.2.10"},
+		{"", nil, []string{"1.2.3.4"}, "192.0.2.10"}, // Header not configured
+		{"X-Forwarded-For", nil, nil, "192.0.2.10"},  // Header absent
+		{"X-Forwarded-For", nil, []string{"1.2.3.4"}, "1.2.3.4"},
+		{"X-Forwarded-For", nil, []string{"6.6.6.6, 1.2.3.4"}, "1.2.3.4"},                 // A forged hop on the left is ignored
+		{"X-Forwarded-For", trusted, []string{"6.6.6.6, 1.2.3.4, 10.1.1.1"}, "1.2.3.4"},   // Trusted proxies are skipped
+		{"X-Forwarded-For", trusted, []string{"6.6.6.6, 1.2.3.4", "10.1.1.1"}, "1.2.3.4"}, // Across repeated headers
+		{"X-Forwarded-For", trusted, []string{"10.2.2.2, 10.1.1.1"}, "192.0.2.10"},        // Every hop trusted
+		{"X-Forwarded-For", trusted, []string{"2001:db8::1, 2001:db8:ffff::2"}, "2001:db8::1"},
+		{"X-Forwarded-For", nil, []string{"::ffff:1.2.3.4"}, "1.2.3.4"},
+		{"X-Forwarded-For", nil, []string{"1.2.3.4, bogus"}, ""},
+	} {
+		g := &geoEnricher{ipHeader: tc.header, trusted: tc.trusted}
+		r := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+		r.RemoteAddr = "192.0.2.10:4711"
+		for _, v := range tc.values {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		addr, ok := g.clientAddr(r)
+		if got := addr.String(); !ok && tc.want != "" || ok && got != tc.want {
+			t.Errorf("%s %q, trusted %v: clientAddr = %s, %t; want %q", tc.header, tc.values, tc.trusted, got, ok, tc.want)
+		}
+	}
+}
+
+func TestGeoEnrich(t *testing.T) {
+	g := newGeoEnricher(geoFixtures, "X-Forwarded-For", nil, metrics.NewRegistry())
+	enrich := func(clientIP string, technical map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+		r.Header.Set("X-Forwarded-For", clientIP)
+		input := claude.AnalyzeDataForLivenessInput{TechnicalData: technical}
+		g.enrich(r, &input)
+		return input.TechnicalData
+	}
+
+	// Both databases contribute.
+	got := enrich("1.2.3.4", nil)
+	if got[geoCountryKey] != "US" || got[geoASNKey] != uint64(64500) || got[geoOrganizationKey] != "Example Net" {
+		t.Errorf("1.2.3.4: technical_data = %v", got)
+	}
+	// Only one database knows the address.
+	got = enrich("2001:db8::1", nil)
+	if len(got) != 1 || got[geoCountryKey] != "US" {
+		t.Errorf("2001:db8::1: technical_data = %v, want only the country", got)
+	}
+	// What the client sent is kept.
+	got = enrich("81.2.69.160", map[string]interface{}{geoCountryKey: "FR", "captcha_solved": true})
+	if got[geoCountryKey] != "FR" || got[geoASNKey] != uint64(20712) || got["captcha_solved"] != true {
+		t.Errorf("81.2.69.160: technical_data = %v, want the client's country kept", got)
+	}
+	// Unknown addresses add nothing.
+	if got := enrich("198.51.100.1", nil); got != nil {
+		t.Errorf("198.51.100.1: technical_data = %v, want none", got)
+	}
+	if v := g.enriched.Value(); v != 3 {
+		t.Errorf("enriched = %v, want 3", v)
+	}
+
+	// Missing databases are skipped, and a nil enricher does nothing.
+	if n := newGeoEnricher(append([]string{filepath.Join(t.TempDir(), "missing.mmdb")}, geoFixtures[1]), "", nil, metrics.NewRegistry()).reload(); n != 1 {
+		t.Errorf("reload loaded %d databases, want 1", n)
+	}
+	var none *geoEnricher
+	input := claude.AnalyzeDataForLivenessInput{}
+	none.enrich(httptest.NewRequest(http.MethodPost, "/analyze", nil), &input)
+	if input.TechnicalData != nil {
+		t.Errorf("nil enricher added %v", input.TechnicalData)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// claudeStub stands in for the Messages API. Each call is answered by
+// handle, which is given the request body and the 1-based call number;
+// the bodies and request contexts are kept for inspection.
+type claudeStub struct {
+	*httptest.Server
+	calls atomic.Int64
+
+	mu       sync.Mutex
+	bodies   []string
+	contexts []context.Context
+}
+
+func newClaudeStubFunc(t *testing.T, handle func(w http.ResponseWriter, body string, call int64)) *claudeStub {
+	t.Helper()
+	stub := &claudeStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		stub.mu.Lock()
+		stub.bodies = append(stub.bodies, string(data))
+		stub.contexts = append(stub.contexts, r.Context())
+		call := stub.calls.Add(1)
+		stub.mu.Unlock()
+		handle(w, string(data), call)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// newClaudeStub returns a stub that answers every call with decision as
+// the message text.
+func newClaudeStub(t *testing.T, decision string) *claudeStub {
+	return newClaudeStubFunc(t, func(w http.ResponseWriter, _ string, _ int64) {
+		writeMessage(w, decision)
+	})
+}
+
+func (s *claudeStub) lastBody() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) == 0 {
+		return ""
+	}
+	return s.bodies[len(s.bodies)-1]
+}
+
+// requestContext returns the context of the given 1-based call, which is
+// done once the service gives up on it.
+func (s *claudeStub) requestContext(call int64) context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.contexts[call-1]
+}
+
+// waitCancelled waits until the given 1-based call is given up by the
+// service, failing the test if it keeps running.
+func (s *claudeStub) waitCancelled(t *testing.T, call int64) {
+	t.Helper()
+	select {
+	case <-s.requestContext(call).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Claude call %d still running upstream", call)
+	}
+}
+
+// writeMessage writes a Messages API response whose only block is text.
+func writeMessage(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":          "msg_test",
+		"model":       claude.DefaultModel,
+		"stop_reason": "end_turn",
+		"content":     []map[string]string{{"type": "text", "text": text}},
+		"usage":       map[string]int{"input_tokens": 100, "output_tokens": 20},
+	})
+}
+
+// decision returns the text of a Claude decision.
+func decision(live bool, confidence float64, reasoning string) string {
+	return fmt.Sprintf(`{"is_likely_live": %t, "confidence": %v, "reasoning": %q}`, live, confidence, reasoning)
+}
+
+// newTestService returns a service that calls stub.
+func newTestService(t *testing.T, stub *claudeStub, opts ...claude.Option) *claude.ClaudeService {
+	t.Helper()
+	opts = append([]claude.Option{claude.WithBaseURL(stub.URL), claude.WithMetrics(metrics.NewRegistry())}, opts...)
+	svc, err := claude.NewService("test-key", opts...)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return svc
+}
+
+// testConfig returns a Config holding the flag defaults the handlers
+// depend on.
+func testConfig() *Config {
+	return &Config{
+		MaxRequestTimeout: 9 * time.Second,
+		Model:             claude.DefaultModel,
+		DecisionTTL: DecisionTTLConfig{
+			HighConfidence: 0.8,
+			Live:           10 * time.Minute,
+			NotLive:        5 * time.Minute,
+		},
+		AsyncMaxJobs:         100,
+		AsyncRetention:       5 * time.Minute,
+		AnalyzeMode:          modeSync,
+		AnalyzeModes:         []analyzeMode{modeSync, modeAsync},
+		MaxBatchSize:         50,
+		BatchConcurrency:     4,
+		BatchStreamHeartbeat: 2 * time.Second,
+		LastErrors:           20,
+	}
+}
+
+// newTestTenants returns a registry without per-tenant overrides.
+func newTestTenants(t *testing.T, cfg *Config, svc *claude.ClaudeService) *tenantRegistry {
+	t.Helper()
+	tenants, err := newTenantRegistry("", cfg, svc)
+	if err != nil {
+		t.Fatalf("newTenantRegistry: %v", err)
+	}
+	return tenants
+}
+
+// analyzeBody is a minimal valid /analyze request body.
+const analyzeBody = `{"user_data": {"email": "user@example.com"}, "session_data": {"session_id": "s1"}, "technical_data": {"captcha_solved": true}}`
+
+// post sends body to h as a POST to path and returns the recorded response.
+func post(h http.Handler, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResult decodes the analysis result in rec's body.
+func decodeResult(t *testing.T, rec *httptest.ResponseRecorder) claude.LivenessAnalysisResult {
+	t.Helper()
+	var result claude.LivenessAnalysisResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return result
+}
+
+// mustInput decodes an analysis input from body.
+func mustInput(t *testing.T, body string) claude.AnalyzeDataForLivenessInput {
+	t.Helper()
+	var input claude.AnalyzeDataForLivenessInput
+	if err := json.Unmarshal([]byte(body), &input); err != nil {
+		t.Fatalf("decoding input: %v", err)
+	}
+	return input
+}
+
+// sseEvent is one Server-Sent Event.
+type sseEvent struct {
+	name, data string
+}
+
+// readEvent reads the next event from an SSE stream, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (sseEvent, error) {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ev, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if ev.name != "" || ev.data != "" {
+				return ev, nil
+			}
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
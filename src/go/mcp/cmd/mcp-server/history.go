@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// QueryLimits bounds the query strings accepted by the history endpoint.
+type QueryLimits struct {
+	MaxParams     int // Total number of query values
+	MaxValueBytes int // Length of any single key or value
+}
+
+// historyRecord is one stored decision as served by GET /history.
+type historyRecord struct {
+	InputHash string                         `json:"input_hash"`
+	CreatedAt time.Time                      `json:"created_at"`
+	Outcome   claude.Outcome                 `json:"outcome"`
+	Result    *claude.LivenessAnalysisResult `json:"result"`
+}
+
+type historyResponse struct {
+	Records []historyRecord `json:"records"`
+	Count   int             `json:"count"`
+}
+
+// historyFilter is the parsed query of a GET /history request.
+type historyFilter struct {
+	since, until time.Time
+	outcome      claude.Outcome
+	limit        int
+}
+
+// historyHandler serves GET /history, listing stored decisions newest first.
+// It accepts since and until (RFC 3339), outcome (live, not_live or
+// uncertain, classified under the current threshold) and limit.
+func historyHandler(svc *claude.ClaudeService, st *store.JSONLStore, limits QueryLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		f, err := parseHistoryQuery(r.URL.RawQuery, limits)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var match func(*store.Record) bool
+		if f.outcome != "" {
+			match = func(rec *store.Record) bool {
+				return rec.Result != nil && svc.Classify(rec.Result.Confidence) == f.outcome
+			}
+		}
+		recs := st.Query(f.since, f.until, match, f.limit)
+		resp := historyResponse{Records: make([]historyRecord, 0, len(recs)), Count: len(recs)}
+		for _, rec := range recs {
+			out := historyRecord{InputHash: rec.InputHash, CreatedAt: rec.CreatedAt, Result: rec.Result}
+			if rec.Result != nil {
+				out.Outcome = svc.Classify(rec.Result.Confidence)
+			}
+			resp.Records = append(resp.Records, out)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// storeHealthHandler serves GET /admin/store/health, reporting the records
+// the result store holds and the corrupted lines it skipped.
+func storeHealthHandler(st *store.JSONLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, st.Health())
+	}
+}
+
+// parseHistoryQuery enforces limits on the raw query before parsing it, so
+// an oversized query is rejected without decoding it in full, then validates
+// each filter.
+func parseHistoryQuery(raw string, limits QueryLimits) (historyFilter, error) {
+	f := historyFilter{limit: defaultHistoryLimit}
+	// Each key and value may be percent-encoded to three times its length,
+	// plus the '=' and '&' separators.
+	if max := limits.MaxParams * (6*limits.MaxValueBytes + 2); len(raw) > max {
+		return f, fmt.Errorf("query string of %d bytes exceeds the limit of %d", len(raw), max)
+	}
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return f, fmt.Errorf("invalid query string: %v", err)
+	}
+	n := 0
+	for key, values := range q {
+		n += len(values)
+		if n > limits.MaxParams {
+			return f, fmt.Errorf("query has more than %d parameters", limits.MaxParams)
+		}
+		if len(key) > limits.MaxValueBytes {
+			return f, fmt.Errorf("query parameter name exceeds %d bytes", limits.MaxValueBytes)
+		}
+		for _, v := range values {
+			if len(v) > limits.MaxValueBytes {
+				return f, fmt.Errorf("query parameter %q exceeds %d bytes", key, limits.MaxValueBytes)
+			}
+		}
+		if len(values) > 1 {
+			return f, fmt.Errorf("query parameter %q given more than once", key)
+		}
+	}
+
+	for key, values := range q {
+		v := values[0]
+		switch key {
+		case "since", "until":
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 timestamp such as 2006-01-02T15:04:05Z, got %q", key, v)
+			}
+			if key == "since" {
+				f.since = t
+			} else {
+				f.until = t
+			}
+		case "outcome":
+			if f.outcome, err = claude.ParseOutcome(v); err != nil {
+				return f, err
+			}
+		case "limit":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxHistoryLimit {
+				return f, fmt.Errorf("limit must be an integer between 1 and %d, got %q", maxHistoryLimit, v)
+			}
+			f.limit = n
+		default:
+			return f, fmt.Errorf("unknown query parameter %q", key)
+		}
+	}
+	if !f.since.IsZero() && !f.until.IsZero() && !f.since.Before(f.until) {
+		return f, fmt.Errorf("since must be before until")
+	}
+	return f, nil
+}
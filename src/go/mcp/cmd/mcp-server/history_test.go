@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+func TestHistoryQueryValidation(t *testing.T) {
+	svc := newTestService(t, newClaudeStub(t, decision(true, 0.9, "Consistent signals.")))
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	for hash, conf := range map[string]float64{"a": 0.9, "b": 0.1} {
+		if err := st.Save(t.Context(), hash, &claude.LivenessAnalysisResult{IsLikelyLive: conf > 0.5, Confidence: conf}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	h := historyHandler(svc, st, QueryLimits{MaxParams: 4, MaxValueBytes: 32})
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/history?"+query, nil))
+		return rec
+	}
+
+	rec := get("outcome=live&since=2000-01-01T00:00:00Z&limit=10")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid query: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp historyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Count != 1 || resp.Records[0].InputHash != "a" || resp.Records[0].Outcome != claude.OutcomeLive {
+		t.Errorf("valid query: response = %+v, want only the live record", resp)
+	}
+
+	for query, wantErr := range map[string]string{
+		"outcome=" + strings.Repeat("x", 1000): "query string of",
+		"outcome=" + strings.Repeat("x", 33):   `query parameter "outcome" exceeds 32 bytes`,
+		strings.Repeat("y", 33) + "=1":         "query parameter name exceeds 32 bytes",
+		"a=1&b=2&c=3&d=4&e=5":                  "query has more than 4 parameters",
+		"limit=1&limit=2":                      `query parameter "limit" given more than once`,
+		"since=yesterday":                      "since must be an RFC 3339 timestamp",
+		"until=2025-13-01T00:00:00Z":           "until must be an RFC 3339 timestamp",
+		"outcome=maybe":                        `unknown outcome "maybe"`,
+		"limit=0":                              "limit must be an integer between 1 and 1000",
+		"limit=ten":                            "limit must be an integer between 1 and 1000",
+		"since=2025-02-01T00:00:00Z&until=2025-01-01T00:00:00Z": "since must be before until",
+		"sort=asc":    `unknown query parameter "sort"`,
+		"outcome=%zz": "invalid query string",
+	} {
+		rec := get(query)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%.40s: status = %d, want 400", query, rec.Code)
+			continue
+		}
+		var body ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || !strings.HasPrefix(body.Error, wantErr) {
+			t.Errorf("%.40s: error = %q, want it to start with %q", query, body.Error, wantErr)
+		}
+	}
+}
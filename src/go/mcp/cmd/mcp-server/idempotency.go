@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/cache"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks a response served from an earlier
+	// request with the same key.
+	idempotentReplayHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyBytes = 255
+)
+
+// storedResponse is a complete response kept for replay.
+type storedResponse struct {
+	bodyHash [32]byte // Of the request, to detect a reused key
+	status   int
+	header   http.Header
+	body     []byte
+}
+
+// inflightRequest is a request being executed for a key; done is closed once
+// resp is set.
+type inflightRequest struct {
+	bodyHash [32]byte
+	done     chan struct{}
+	resp     *storedResponse
+}
+
+// idempotency replays responses for requests repeating an Idempotency-Key,
+// whether the repeat arrives after the first request completed or while it
+// is still running. Concurrent requests with the same key are coalesced:
+// only the first executes, and the rest wait up to wait for its response.
+// Retryable responses reach those waiters but are not replayed afterwards.
+type idempotency struct {
+	wait      time.Duration
+	completed *cache.Cache[*storedResponse]
+
+	mu       sync.Mutex
+	inflight map[string]*inflightRequest
+}
+
+func newIdempotency(ttl, wait time.Duration) *idempotency {
+	return &idempotency{
+		wait:      wait,
+		completed: cache.New[*storedResponse](ttl, 0),
+		inflight:  make(map[string]*inflightRequest),
+	}
+}
+
+// middleware applies idempotency to next. Requests without the header pass
+// through. Keys are scoped to the partner and path, and reusing a key with a
+// different body is rejected with 422.
+func (m *idempotency) middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyBytes {
+			writeError(w, http.StatusBadRequest, idempotencyKeyHeader+" is too long")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+		scoped := r.Header.Get(partnerIDHeader) + "\x00" + r.URL.Path + "\x00" + key
+
+		m.mu.Lock()
+		if resp, ok := m.completed.Get(scoped); ok {
+			m.mu.Unlock()
+			m.replay(w, resp, hash)
+			return
+		}
+		if in, ok := m.inflight[scoped]; ok {
+			m.mu.Unlock()
+			if in.bodyHash != hash {
+				writeError(w, http.StatusUnprocessableEntity, idempotencyKeyHeader+" was already used with a different request body")
+				return
+			}
+			timer := time.NewTimer(m.wait)
+			defer timer.Stop()
+			select {
+			case <-in.done:
+				m.replay(w, in.resp, hash)
+			case <-timer.C:
+				writeError(w, http.StatusConflict, "a request with this "+idempotencyKeyHeader+" is still in progress")
+			case <-r.Context().Done():
+			}
+			return
+		}
+		in := &inflightRequest{bodyHash: hash, done: make(chan struct{})}
+		m.inflight[scoped] = in
+		m.mu.Unlock()
+
+		rec := &responseCapture{ResponseWriter: w}
+		defer func() {
+			in.resp = rec.stored(hash)
+			m.mu.Lock()
+			delete(m.inflight, scoped)
+			// Retryable outcomes are not kept, so a retry runs afresh.
+			if !retryableStatus(in.resp.status) {
+				m.completed.Set(scoped, in.resp)
+			}
+			m.mu.Unlock()
+			close(in.done)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// retryableStatus reports whether a response with status tells the client
+// to try again: timeouts, conflicts, throttling and server errors.
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= 500
+}
+
+func (m *idempotency) replay(w http.ResponseWriter, resp *storedResponse, hash [32]byte) {
+	if resp.bodyHash != hash {
+		writeError(w, http.StatusUnprocessableEntity, idempotencyKeyHeader+" was already used with a different request body")
+		return
+	}
+	for k, v := range resp.header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.Header().Set(idempotentReplayHeader, "true")
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+// responseCapture passes a response through while keeping a copy of it.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+		c.header = c.ResponseWriter.Header().Clone()
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *responseCapture) stored(hash [32]byte) *storedResponse {
+	if c.status == 0 {
+		// The handler wrote nothing, e.g. because the request ran out of
+		// time; waiters get an error rather than an empty response.
+		return &storedResponse{
+			bodyHash: hash,
+			status:   http.StatusInternalServerError,
+			header:   http.Header{"Content-Type": {"application/json"}},
+			body:     []byte(`{"error":"the original request produced no response"}` + "\n"),
+		}
+	}
+	return &storedResponse{bodyHash: hash, status: c.status, header: c.header, body: c.body.Bytes()}
+}
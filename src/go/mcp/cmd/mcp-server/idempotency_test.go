@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCoalescesConcurrentRequests(t *testing.T) {
+	release := make(chan struct{})
+	stub := newClaudeStubFunc(t, func(w http.ResponseWriter, _ string, _ int64) {
+		<-release
+		writeMessage(w, decision(true, 0.9, "Consistent signals."))
+	})
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	h := newIdempotency(time.Minute, 5*time.Second).middleware(
+		analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors)))
+
+	header := http.Header{idempotencyKeyHeader: {"order-42"}}
+	recs := make([]*httptest.ResponseRecorder, 2)
+	var wg sync.WaitGroup
+	for i := range recs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i] = post(h, "/analyze", analyzeBody, header)
+		}()
+		if i == 0 {
+			waitForCalls(t, stub, 1)
+		}
+	}
+	time.Sleep(20 * time.Millisecond) // Let the second request start waiting
+	close(release)
+	wg.Wait()
+
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, body %s", i, rec.Code, rec.Body)
+		}
+	}
+	if recs[0].Body.String() != recs[1].Body.String() {
+		t.Errorf("responses differ:\n%s\n%s", recs[0].Body, recs[1].Body)
+	}
+	if recs[1].Header().Get(idempotentReplayHeader) != "true" {
+		t.Error("the second response was not marked as replayed")
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want 1", n)
+	}
+}
+
+func TestIdempotencyKeepsOnlyFinalOutcomes(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		kept   bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusBadRequest, true},
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusConflict, false},
+		{http.StatusTooEarly, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadGateway, false},
+		{http.StatusServiceUnavailable, false},
+	} {
+		var runs atomic.Int64
+		h := newIdempotency(time.Minute, time.Second).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			runs.Add(1)
+			writeError(w, tc.status, fmt.Sprintf("run %d", runs.Load()))
+		}))
+		header := http.Header{idempotencyKeyHeader: {"k"}}
+		post(h, "/analyze", analyzeBody, header)
+		rec := post(h, "/analyze", analyzeBody, header)
+
+		wantRuns := int64(2)
+		if tc.kept {
+			wantRuns = 1
+		}
+		if runs.Load() != wantRuns {
+			t.Errorf("status %d: handler ran %d times, want %d", tc.status, runs.Load(), wantRuns)
+		}
+		if replayed := rec.Header().Get(idempotentReplayHeader) == "true"; replayed != tc.kept {
+			t.Errorf("status %d: repeat replayed = %t, want %t", tc.status, replayed, tc.kept)
+		}
+	}
+}
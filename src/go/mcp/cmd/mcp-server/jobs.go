@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+// errJobQueueFull is returned when the in-flight job limit is reached.
+var errJobQueueFull = errors.New("job queue full")
+
+// errJobQueueClosed is returned for jobs submitted once shutdown has begun.
+var errJobQueueClosed = errors.New("server is shutting down")
+
+// JobStatus is the lifecycle state of an async analysis job.
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// job is one async analysis. Fields other than id are guarded by the
+// queue's mutex.
+type job struct {
+	id          string
+	status      JobStatus
+	result      *claude.LivenessAnalysisResult
+	errStatus   int
+	errMessage  string
+	completedAt time.Time
+}
+
+// jobView is the JSON body describing a job.
+type jobView struct {
+	JobID       string                         `json:"job_id"`
+	Status      JobStatus                      `json:"status"`
+	Result      *claude.LivenessAnalysisResult `json:"result,omitempty"`
+	Error       string                         `json:"error,omitempty"`
+	ErrorStatus int                            `json:"error_status,omitempty"` // HTTP status the synchronous endpoint would have returned
+	CompletedAt *time.Time                     `json:"completed_at,omitempty"`
+}
+
+// JobStats is the async job section of /stats.
+type JobStats struct {
+	InFlight    int `json:"in_flight"`
+	MaxInFlight int `json:"max_in_flight"`
+	Retained    int `json:"retained"` // Completed jobs still pollable
+}
+
+// jobQueue runs async analyses in the background. At most maxInFlight jobs
+// may be pending at once; completed jobs stay pollable for retention and are
+// then evicted. Jobs submitted with a callback URL are also delivered
+// through callbacks once complete. Close drains the queue at shutdown.
+type jobQueue struct {
+	ctx         context.Context // Cancelled once a shutdown drain times out
+	cancel      context.CancelFunc
+	timeout     time.Duration // Per-job analysis budget
+	maxInFlight int
+	retention   time.Duration
+	callbacks   *callbackDispatcher
+
+	mu       sync.Mutex
+	jobs     map[string]*job
+	inFlight int
+	closed   bool
+	wg       sync.WaitGroup // Running jobs, up to their callback's enqueue
+}
+
+func newJobQueue(maxInFlight int, timeout, retention time.Duration, callbacks *callbackDispatcher) *jobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobQueue{
+		ctx:         ctx,
+		cancel:      cancel,
+		timeout:     timeout,
+		maxInFlight: maxInFlight,
+		retention:   retention,
+		callbacks:   callbacks,
+		jobs:        make(map[string]*job),
+	}
+}
+
+// submit starts run as a new job, or returns errJobQueueFull, or
+// errJobQueueClosed once Close has been called. run is passed the job's ID.
+// The completed job is delivered to callback unless its URL is empty.
+func (q *jobQueue) submit(run func(ctx context.Context, id string) (*claude.LivenessAnalysisResult, error), callback callbackTarget) (string, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return "", errJobQueueClosed
+	}
+	if q.inFlight >= q.maxInFlight {
+		q.mu.Unlock()
+		return "", errJobQueueFull
+	}
+	j := &job{id: newRequestID(), status: JobPending}
+	q.jobs[j.id] = j
+	q.inFlight++
+	q.wg.Add(1)
+	q.mu.Unlock()
+
+	go func() {
+		defer q.wg.Done()
+		ctx, cancel := context.WithTimeout(q.ctx, q.timeout)
+		defer cancel()
+		result, err := run(ctx, j.id)
+		q.complete(j, result, err)
+		if callback.URL != "" {
+			v, _ := q.get(j.id)
+			q.callbacks.enqueue(callback, v)
+		}
+	}()
+	return j.id, nil
+}
+
+// complete records a job's outcome and schedules its eviction.
+func (q *jobQueue) complete(j *job, result *claude.LivenessAnalysisResult, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight--
+	j.completedAt = time.Now().UTC()
+	if err != nil {
+		log.Printf("Async job %s failed: %v", j.id, err)
+		j.status = JobFailed
+		j.errStatus, j.errMessage = analysisErrorStatus(err)
+	} else {
+		j.status = JobDone
+		j.result = result
+	}
+	time.AfterFunc(q.retention, func() {
+		q.mu.Lock()
+		delete(q.jobs, j.id)
+		q.mu.Unlock()
+	})
+}
+
+// Close stops accepting jobs and waits for the pending ones to complete and
+// hand their callbacks to the dispatcher. Jobs still running when ctx ends
+// are cancelled, failing them, and Close returns ctx's error once they have
+// finished.
+func (q *jobQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// get returns a snapshot of the job with id.
+func (q *jobQueue) get(id string) (jobView, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return jobView{}, false
+	}
+	v := jobView{JobID: j.id, Status: j.status, Result: j.result, Error: j.errMessage, ErrorStatus: j.errStatus}
+	if !j.completedAt.IsZero() {
+		t := j.completedAt
+		v.CompletedAt = &t
+	}
+	return v, true
+}
+
+func (q *jobQueue) stats() JobStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return JobStats{InFlight: q.inFlight, MaxInFlight: q.maxInFlight, Retained: len(q.jobs) - q.inFlight}
+}
+
+// asyncAnalyzeHandler serves POST /analyze/async: it validates the request
+// like /analyze, queues the analysis and answers 202 with the job's URL.
+// Decisions are recorded in st (when configured) under the job ID.
+func asyncAnalyzeHandler(svc *claude.ClaudeService, cfg *Config, tenants *tenantRegistry, geo *geoEnricher, q *jobQueue, st *store.JSONLStore, events *decisionEmitter, errs *errorLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var req analyzeRequest
+		if !decodeBody(w, r, &req, cfg.RejectUnknownFields) {
+			return
+		}
+		geo.enrich(r, &req.AnalyzeDataForLivenessInput)
+		submitAnalysis(w, r, svc, cfg, tenants, q, st, events, errs, "/analyze/async", req)
+	}
+}
+
+// submitAnalysis queues the analysis of req, received on endpoint, and
+// answers 202 with the job's URL, or 429 when the queue is full. The job ID
+// serves as the request ID: a decision is recorded under it in st (when
+// configured) for later feedback, and a failed job in errs. With a
+// callback_url the completed job is also POSTed there.
+func submitAnalysis(w http.ResponseWriter, r *http.Request, svc *claude.ClaudeService, cfg *Config, tenants *tenantRegistry, q *jobQueue, st *store.JSONLStore, events *decisionEmitter, errs *errorLog, endpoint string, req analyzeRequest) {
+	var callback callbackTarget
+	if req.CallbackURL != "" {
+		if err := q.callbacks.validate(req.CallbackURL); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		callback = callbackTarget{URL: req.CallbackURL, Partner: partnerFromContext(r.Context())}
+	}
+	traceID, _ := trace.FromContext(r.Context())
+	opts := tenants.forRequest(r).analyzeOptions(r, req.Verbosity, req.Language)
+	id, err := q.submit(func(ctx context.Context, id string) (*claude.LivenessAnalysisResult, error) {
+		result, err := svc.AnalyzeDataForLivenessWithOptions(ctx, req.AnalyzeDataForLivenessInput, opts)
+		if err != nil {
+			errs.record(endpoint, id, traceID, err)
+			return nil, err
+		}
+		events.emit(endpoint, "", traceID, result, req.AnalyzeDataForLivenessInput)
+		if st != nil {
+			if err := st.SaveServed(context.WithoutCancel(ctx), id, result); err != nil {
+				log.Printf("Recording served decision %s failed: %v", id, err)
+			}
+		}
+		return clientResult(result, req.AnalyzeDataForLivenessInput, cfg), nil
+	}, callback)
+	switch {
+	case errors.Is(err, errJobQueueFull):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	case errors.Is(err, errJobQueueClosed):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, jobView{JobID: id, Status: JobPending})
+}
+
+// jobHandler serves GET /jobs/{id}, reporting a job's status and, once it
+// completes, its result or error.
+func jobHandler(q *jobQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		v, ok := q.get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown or expired job")
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// jobsServer routes the async endpoints to q.
+type jobsServer struct {
+	mux *http.ServeMux
+	q   *jobQueue
+}
+
+func newJobsServer(t *testing.T, stub *claudeStub, maxJobs int, retention time.Duration) *jobsServer {
+	t.Helper()
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	q := newJobQueue(maxJobs, 5*time.Second, retention, nil)
+	mux := http.NewServeMux()
+	mux.Handle("/analyze/async", asyncAnalyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, q, nil, nil, newErrorLog(cfg.LastErrors)))
+	mux.Handle("/jobs/{id}", jobHandler(q))
+	return &jobsServer{mux: mux, q: q}
+}
+
+// submit posts a distinct analysis and returns the response.
+func (s *jobsServer) submit(n int) *httptest.ResponseRecorder {
+	return post(s.mux, "/analyze/async", fmt.Sprintf(`{"user_data": {"email": "user%d@example.com"}}`, n), nil)
+}
+
+// job polls the job with id, returning its view and whether it exists.
+func (s *jobsServer) job(t *testing.T, id string) (jobView, bool) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil))
+	if rec.Code == http.StatusNotFound {
+		return jobView{}, false
+	}
+	var v jobView
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding job %q: %v", rec.Body, err)
+	}
+	return v, true
+}
+
+// jobID returns the ID of the job a 202 response accepted.
+func jobID(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var v jobView
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding job %q: %v", rec.Body, err)
+	}
+	return v.JobID
+}
+
+// waitFor polls cond until it holds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingStub answers once release is closed.
+func blockingStub(t *testing.T) (*claudeStub, chan struct{}) {
+	release := make(chan struct{})
+	stub := newClaudeStubFunc(t, func(w http.ResponseWriter, _ string, _ int64) {
+		<-release
+		writeMessage(w, decision(true, 0.9, "Consistent signals."))
+	})
+	return stub, release
+}
+
+func TestAsyncJobCap(t *testing.T) {
+	stub, release := blockingStub(t)
+	s := newJobsServer(t, stub, 2, time.Minute)
+
+	first, second := jobID(t, s.submit(1)), jobID(t, s.submit(2))
+	rec := s.submit(3)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("submit over the cap: status = %d, Retry-After %q; want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if st := s.q.stats(); st.InFlight != 2 || st.MaxInFlight != 2 || st.Retained != 0 {
+		t.Errorf("stats at the cap = %+v", st)
+	}
+
+	close(release)
+	for _, id := range []string{first, second} {
+		waitFor(t, "job "+id, func() bool {
+			v, _ := s.job(t, id)
+			return v.Status == JobDone
+		})
+	}
+	if st := s.q.stats(); st.InFlight != 0 || st.Retained != 2 {
+		t.Errorf("stats once complete = %+v", st)
+	}
+	jobID(t, s.submit(3)) // Room again
+}
+
+func TestAsyncJobRetention(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	const retention = 100 * time.Millisecond
+	s := newJobsServer(t, stub, 2, retention)
+
+	id := jobID(t, s.submit(1))
+	var v jobView
+	waitFor(t, "the job to complete", func() bool {
+		v, _ = s.job(t, id)
+		return v.Status == JobDone
+	})
+	if v.Result == nil || v.CompletedAt == nil {
+		t.Fatalf("completed job = %+v, want a result and completed_at", v)
+	}
+	if time.Since(*v.CompletedAt) < retention/2 {
+		if _, ok := s.job(t, id); !ok {
+			t.Error("job evicted before its retention elapsed")
+		}
+	}
+	waitFor(t, "the job to be evicted", func() bool {
+		_, ok := s.job(t, id)
+		return !ok
+	})
+	if elapsed := time.Since(*v.CompletedAt); elapsed < retention {
+		t.Errorf("job evicted %s after completing, before the %s retention", elapsed, retention)
+	}
+	if st := s.q.stats(); st.Retained != 0 {
+		t.Errorf("stats after eviction = %+v", st)
+	}
+}
+
+func TestAsyncJobsDrainOnClose(t *testing.T) {
+	stub, release := blockingStub(t)
+	s := newJobsServer(t, stub, 2, time.Minute)
+	id := jobID(t, s.submit(1))
+	waitForCalls(t, stub, 1)
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.q.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v with a job pending", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if rec := s.submit(2); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("submit while draining: status = %d, want 503", rec.Code)
+	}
+
+	close(release)
+	if err := <-closed; err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if v, _ := s.job(t, id); v.Status != JobDone {
+		t.Errorf("drained job = %+v, want done", v)
+	}
+}
+
+func TestAsyncJobsCancelledAfterDrainTimeout(t *testing.T) {
+	stub, release := blockingStub(t)
+	t.Cleanup(func() { close(release) })
+	s := newJobsServer(t, stub, 2, time.Minute)
+	id := jobID(t, s.submit(1))
+	waitForCalls(t, stub, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.q.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want DeadlineExceeded", err)
+	}
+	if v, _ := s.job(t, id); v.Status != JobFailed {
+		t.Errorf("job cancelled at shutdown = %+v, want failed", v)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"de", []string{"de"}},
+		{"fr;q=0.5, de-AT, en;q=0.8", []string{"de-AT", "en", "fr"}},
+		{"*, es;q=0.9", []string{"es"}},
+		{"de;q=0, fr;q=bogus, it", []string{"it"}},
+		{"ja;q=0.7, ko;q=0.7", []string{"ja", "ko"}}, // Ties keep header order
+	} {
+		if got := parseAcceptLanguage(tc.header); !slices.Equal(got, tc.want) {
+			t.Errorf("parseAcceptLanguage(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestAnalyzeReasoningLanguage(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub, claude.WithLanguages([]string{"en", "de"}, "en"))
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+	withLanguage := strings.Replace(analyzeBody, "{", `{"language": "en", `, 1)
+
+	for _, tc := range []struct {
+		name, body, acceptLanguage string
+		want                       string
+		fallback                   bool
+	}{
+		{"header", analyzeBody, "fr;q=0.5, de-AT", "de", false},
+		{"unsupported", analyzeBody, "ja", "en", true},
+		{"body field overrides the header", withLanguage, "de", "en", false},
+	} {
+		rec := post(h, "/analyze", tc.body, http.Header{"Accept-Language": {tc.acceptLanguage}})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tc.name, rec.Code, rec.Body)
+		}
+		if result := decodeResult(t, rec); result.Language != tc.want || result.LanguageFallback != tc.fallback {
+			t.Errorf("%s: language = %q, fallback %t; want %q, %t", tc.name, result.Language, result.LanguageFallback, tc.want, tc.fallback)
+		}
+		if vary := rec.Header().Values("Vary"); !slices.ContainsFunc(vary, func(v string) bool { return strings.Contains(v, "Accept-Language") }) {
+			t.Errorf("%s: Vary = %q, want Accept-Language", tc.name, vary)
+		}
+	}
+	if body := stub.lastBody(); strings.Contains(body, "BCP 47 tag") {
+		t.Errorf("English request asks for a language: %s", body)
+	}
+}
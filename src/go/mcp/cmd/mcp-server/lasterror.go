@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// maxErrorMessageBytes truncates recorded error messages, which can carry
+// long upstream bodies.
+const maxErrorMessageBytes = 256
+
+// errorRecord is one failed analysis as reported by GET /admin/last-error.
+// It holds no request data, only the error and where it happened.
+type errorRecord struct {
+	Time           time.Time `json:"time"`
+	Endpoint       string    `json:"endpoint"`
+	RequestID      string    `json:"request_id,omitempty"` // X-Request-Id, or the job ID for async analyses
+	TraceID        string    `json:"trace_id,omitempty"`
+	Type           string    `json:"type"`
+	Status         int       `json:"status"`                    // HTTP status the client got
+	UpstreamStatus int       `json:"upstream_status,omitempty"` // Claude API status, for upstream failures
+	Message        string    `json:"message"`
+}
+
+// errorLog keeps the most recent server-side analysis failures, those
+// answered with a 5xx status, in a fixed-size ring.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []errorRecord
+	next    int
+	total   int64
+}
+
+func newErrorLog(size int) *errorLog {
+	return &errorLog{entries: make([]errorRecord, 0, size)}
+}
+
+// record adds err, returned by an analysis requested on endpoint, unless it
+// is a client error.
+func (l *errorLog) record(endpoint, requestID, traceID string, err error) {
+	status, _ := analysisErrorStatus(err)
+	if status < 500 {
+		return
+	}
+	rec := errorRecord{
+		Time:      time.Now().UTC(),
+		Endpoint:  endpoint,
+		RequestID: requestID,
+		TraceID:   traceID,
+		Type:      errorType(err),
+		Status:    status,
+		Message:   err.Error(),
+	}
+	var apiErr *claude.APIError
+	if errors.As(err, &apiErr) {
+		rec.UpstreamStatus = apiErr.StatusCode
+	}
+	if len(rec.Message) > maxErrorMessageBytes {
+		rec.Message = rec.Message[:maxErrorMessageBytes] + "..."
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total++
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, rec)
+		return
+	}
+	l.entries[l.next] = rec
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// recent returns up to n recorded errors, newest first, and how many were
+// recorded in total.
+func (l *errorLog) recent(n int) ([]errorRecord, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]errorRecord, 0, min(n, len(l.entries)))
+	for i := 1; i <= len(l.entries) && len(out) < n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out, l.total
+}
+
+// errorType names the kind of failure err is.
+func errorType(err error) string {
+	var apiErr *claude.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return "upstream_" + string(apiErr.Class())
+	case errors.Is(err, claude.ErrInvalidResponse):
+		return "invalid_response"
+	case errors.Is(err, claude.ErrAmbiguousResponse):
+		return "ambiguous_response"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, claude.ErrStandbyMiss):
+		return "standby_miss"
+	default:
+		return "internal"
+	}
+}
+
+// lastErrorResponse is the body returned by GET /admin/last-error.
+type lastErrorResponse struct {
+	Errors []errorRecord `json:"errors"`
+	Total  int64         `json:"total"` // Errors recorded since startup, including evicted ones
+}
+
+// lastErrorHandler serves GET /admin/last-error, listing the most recent
+// analysis failures, newest first. The limit query parameter returns fewer.
+func lastErrorHandler(l *errorLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		limit := cap(l.entries)
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = n
+		}
+		errs, total := l.recent(limit)
+		writeJSON(w, http.StatusOK, lastErrorResponse{Errors: errs, Total: total})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// failingStub answers analyses of inputs mentioning "upstream" with a
+// Claude API 500 carrying a long message, those mentioning "garbled" with
+// an unparseable reply, and everything else with a decision.
+func failingStub(t *testing.T) *claudeStub {
+	return newClaudeStubFunc(t, func(w http.ResponseWriter, body string, _ int64) {
+		switch {
+		case strings.Contains(body, "upstream"):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"type": "error", "error": {"type": "api_error", "message": %q}}`, strings.Repeat("x", 1000))
+		case strings.Contains(body, "garbled"):
+			writeMessage(w, "not a decision")
+		default:
+			writeMessage(w, decision(true, 0.9, "Consistent signals."))
+		}
+	})
+}
+
+// lastErrors fetches GET /admin/last-error from mux with the given query.
+func lastErrors(t *testing.T, mux http.Handler, query string) lastErrorResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/last-error"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/last-error%s: status = %d, body %s", query, rec.Code, rec.Body)
+	}
+	var resp lastErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	return resp
+}
+
+func TestAnalysisFailuresAppearInErrorLog(t *testing.T) {
+	svc := newTestService(t, failingStub(t), claude.WithParseRetries(0), claude.WithRetryPolicy(claude.ClassServerError, claude.BackoffPolicy{}))
+	cfg := testConfig()
+	cfg.LastErrors = 3
+	errs := newErrorLog(cfg.LastErrors)
+	q := newJobQueue(cfg.AsyncMaxJobs, 5*time.Second, cfg.AsyncRetention, nil)
+	t.Cleanup(func() { q.Close(t.Context()) })
+	tenants := newTestTenants(t, cfg, svc)
+	mux := http.NewServeMux()
+	mux.Handle("/analyze", analyzeHandler(svc, cfg, tenants, nil, q, nil, nil, errs))
+	mux.Handle("/analyze/batch", batchHandler(svc, cfg, tenants, nil, nil, errs))
+	mux.Handle("/jobs/{id}", jobHandler(q))
+	mux.Handle("/admin/last-error", lastErrorHandler(errs))
+	s := &jobsServer{mux: mux, q: q}
+
+	// An upstream failure is recorded under the request ID the client got.
+	rec := post(mux, "/analyze", `{"user_data": {"email": "upstream@example.com"}}`, nil)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("upstream failure: status = %d, want 502", rec.Code)
+	}
+	requestID := rec.Header().Get(requestIDHeader)
+	if requestID == "" {
+		t.Error("failed analysis has no X-Request-Id")
+	}
+	resp := lastErrors(t, mux, "")
+	if resp.Total != 1 || len(resp.Errors) != 1 {
+		t.Fatalf("error log = %+v, want one entry", resp)
+	}
+	e := resp.Errors[0]
+	if e.Endpoint != "/analyze" || e.RequestID != requestID || e.Type != "upstream_server_error" ||
+		e.Status != http.StatusBadGateway || e.UpstreamStatus != http.StatusInternalServerError {
+		t.Errorf("entry = %+v", e)
+	}
+	if len(e.Message) > maxErrorMessageBytes+len("...") || !strings.HasSuffix(e.Message, "...") {
+		t.Errorf("message not truncated: %d bytes", len(e.Message))
+	}
+	if e.Time.IsZero() {
+		t.Error("entry has no time")
+	}
+
+	// Client errors are left out.
+	if rec := post(mux, "/analyze", `{}`, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("empty input: status = %d, want 422", rec.Code)
+	}
+	if resp := lastErrors(t, mux, ""); resp.Total != 1 {
+		t.Errorf("client error recorded: %+v", resp)
+	}
+
+	// An async failure is recorded under its job ID.
+	id := jobID(t, post(mux, "/analyze", `{"user_data": {"email": "garbled@example.com"}}`, http.Header{"Prefer": {"respond-async"}}))
+	waitFor(t, "job "+id, func() bool {
+		job, _ := s.job(t, id)
+		return job.Status == JobFailed
+	})
+	e = lastErrors(t, mux, "").Errors[0]
+	if e.Endpoint != "/analyze" || e.RequestID != id || e.Type != "invalid_response" || e.UpstreamStatus != 0 {
+		t.Errorf("async entry = %+v", e)
+	}
+
+	// A failed batch item is recorded, its neighbours are not.
+	batch := `{"items": [{"user_data": {"email": "ok@example.com"}}, {"user_data": {"email": "upstream2@example.com"}}]}`
+	if rec := post(mux, "/analyze/batch", batch, nil); rec.Code != http.StatusOK {
+		t.Fatalf("batch: status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	// The ring keeps the newest entries, and limit returns fewer.
+	resp = lastErrors(t, mux, "")
+	if resp.Total != 3 || len(resp.Errors) != 3 {
+		t.Fatalf("error log = %+v, want three entries", resp)
+	}
+	if resp.Errors[0].Endpoint != "/analyze/batch" || resp.Errors[2].RequestID != requestID {
+		t.Errorf("entries not newest first: %+v", resp.Errors)
+	}
+	post(mux, "/analyze", `{"user_data": {"email": "upstream3@example.com"}}`, nil)
+	resp = lastErrors(t, mux, "?limit=2")
+	if resp.Total != 4 || len(resp.Errors) != 2 || resp.Errors[1].Endpoint != "/analyze/batch" {
+		t.Errorf("limited error log = %+v", resp)
+	}
+	if resp := lastErrors(t, mux, ""); len(resp.Errors) != 3 || resp.Errors[2].RequestID == requestID {
+		t.Errorf("oldest entry not evicted: %+v", resp.Errors)
+	}
+	if rec := post(mux, "/admin/last-error?limit=0", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405", rec.Code)
+	}
+}
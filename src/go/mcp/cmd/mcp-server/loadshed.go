@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// LoadShedConfig sets when analysis requests are shed. Below SoftLimit
+// requests in flight nothing is shed; from there the shedding probability
+// rises linearly, scaled by Aggressiveness, to 1 at HardLimit. A zero
+// SoftLimit disables shedding.
+type LoadShedConfig struct {
+	SoftLimit      int
+	HardLimit      int
+	Aggressiveness float64
+}
+
+// loadShedder rejects a share of new analysis requests with 503 once too
+// many are in flight, so that overload turns into fast failures for some
+// clients rather than growing latency for all. Only paths under /analyze
+// are counted or shed; health, metrics, admin and job polling are cheap
+// and always served.
+type loadShedder struct {
+	cfg      LoadShedConfig
+	inFlight atomic.Int64
+	shed     *metrics.Counter
+	random   func() float64
+}
+
+func newLoadShedder(cfg LoadShedConfig, registry *metrics.Registry) *loadShedder {
+	l := &loadShedder{
+		cfg:    cfg,
+		shed:   registry.NewCounter("mcp_load_shed_total", "Analysis requests rejected with 503 by load shedding."),
+		random: rand.Float64,
+	}
+	registry.NewGaugeFunc("mcp_load_shed_probability", "Probability that a new analysis request is shed at the current load.", l.probability)
+	registry.NewGaugeFunc("mcp_analyses_in_flight", "Analysis requests currently being served.", func() float64 {
+		return float64(l.inFlight.Load())
+	})
+	return l
+}
+
+// probability returns the share of new analysis requests to shed at the
+// current in-flight count.
+func (l *loadShedder) probability() float64 {
+	if l.cfg.SoftLimit <= 0 {
+		return 0
+	}
+	n := float64(l.inFlight.Load())
+	soft, hard := float64(l.cfg.SoftLimit), float64(l.cfg.HardLimit)
+	if n < soft {
+		return 0
+	}
+	if n >= hard {
+		return 1
+	}
+	return min(1, l.cfg.Aggressiveness*(n-soft)/(hard-soft))
+}
+
+func (l *loadShedder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/analyze") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p := l.probability(); p > 0 && l.random() < p {
+			l.shed.Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "server overloaded, request shed")
+			return
+		}
+		l.inFlight.Add(1)
+		defer l.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+func TestLoadShedProbability(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      LoadShedConfig
+		inFlight int64
+		want     float64
+	}{
+		{LoadShedConfig{SoftLimit: 0, HardLimit: 10, Aggressiveness: 1}, 50, 0}, // Disabled
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 1}, 9, 0},
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 1}, 10, 0},
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 1}, 15, 0.5},
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 1}, 20, 1},
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 1}, 30, 1},
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 0.5}, 15, 0.25},
+		{LoadShedConfig{SoftLimit: 10, HardLimit: 20, Aggressiveness: 4}, 15, 1}, // Capped
+	} {
+		l := newLoadShedder(tc.cfg, metrics.NewRegistry())
+		l.inFlight.Store(tc.inFlight)
+		if got := l.probability(); got != tc.want {
+			t.Errorf("%+v with %d in flight: probability = %v, want %v", tc.cfg, tc.inFlight, got, tc.want)
+		}
+	}
+}
+
+func TestLoadShedMiddleware(t *testing.T) {
+	l := newLoadShedder(LoadShedConfig{SoftLimit: 2, HardLimit: 4, Aggressiveness: 1}, metrics.NewRegistry())
+	l.random = func() float64 { return 0.6 }
+	started, release := make(chan struct{}), make(chan struct{})
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("block") {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	// Hold analyses in flight. At 3 the probability is 0.5, below the
+	// draw, so the next one is admitted; at 4 every new one is shed.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(http.MethodPost, "/analyze?block")
+		}()
+		<-started
+	}
+	if n := l.inFlight.Load(); n != 4 {
+		t.Fatalf("in flight = %d, want 4", n)
+	}
+	for _, path := range []string{"/analyze", "/analyze/batch", "/analyze/async"} {
+		rec := serve(http.MethodPost, path)
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s at the hard limit: status = %d, Retry-After %q; want 503 with Retry-After", path, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	if v := l.shed.Value(); v != 3 {
+		t.Errorf("shed = %v, want 3", v)
+	}
+
+	// Everything else is served regardless, and not counted.
+	for _, path := range []string{"/health", "/ready", "/metrics", "/stats", "/jobs/abc", "/admin/last-error"} {
+		if rec := serve(http.MethodGet, path); rec.Code != http.StatusNoContent {
+			t.Errorf("%s at the hard limit: status = %d, want it served", path, rec.Code)
+		}
+	}
+	if n := l.inFlight.Load(); n != 4 {
+		t.Errorf("in flight = %d after exempt requests, want 4", n)
+	}
+
+	close(release)
+	wg.Wait()
+	if n := l.inFlight.Load(); n != 0 {
+		t.Errorf("in flight = %d after the analyses finished, want 0", n)
+	}
+	if rec := serve(http.MethodPost, "/analyze"); rec.Code != http.StatusNoContent {
+		t.Errorf("after the load passed: status = %d, want the analysis served", rec.Code)
+	}
+}
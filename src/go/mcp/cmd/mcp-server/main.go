@@ -1,10 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/metrics"
+	"github.com/example-user/mcp-go/pkg/shutdown"
+	"github.com/example-user/mcp-go/pkg/slo"
+	"github.com/example-user/mcp-go/pkg/store"
+	"github.com/example-user/mcp-go/pkg/trace"
 )
 
 // HealthStatus represents the health check response
@@ -29,22 +42,256 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ReadinessStatus represents the readiness check response
+type ReadinessStatus struct {
+	Status string `json:"status"`
+	Mode   string `json:"mode"` // "claude" or "rule_only"
+}
+
+func readinessHandler(svc *claude.ClaudeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mode := "claude"
+		if svc.RuleOnly() {
+			mode = "rule_only"
+		}
+		writeJSON(w, http.StatusOK, ReadinessStatus{Status: "ready", Mode: mode})
+	}
+}
+
 func main() {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", healthCheckHandler)
+	cfg, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	debugLogging = cfg.LogDebug
 
+	// The port is claimed before the service is built; requests arriving
+	// in the meantime are answered by the gate.
 	serverAddr := ":8080"
-	log.Printf("MCP Go Server starting on %s", serverAddr)
-
+	listener, err := net.Listen("tcp", serverAddr)
+	if err != nil {
+		log.Fatalf("Could not listen on %s: %v\n", serverAddr, err)
+	}
+	gate := &startupGate{}
 	server := &http.Server{
 		Addr:         serverAddr,
-		Handler:      mux,
+		Handler:      gate,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+	log.Printf("MCP Go Server listening on %s, starting up", serverAddr)
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Could not listen on %s: %v\n", serverAddr, err)
+	registry := metrics.NewRegistry()
+	opts := []claude.Option{
+		claude.WithMetrics(registry),
+		claude.WithModel(cfg.Model),
+		claude.WithCanary(cfg.CanaryModel, cfg.CanaryPercent),
+		claude.WithShadow(cfg.ShadowModel, cfg.ShadowSampleRate),
+		claude.WithHedging(cfg.HedgeDelay, cfg.HedgeDeadlineFraction, cfg.HedgeMaxInFlight),
+		claude.WithModelPricing(cfg.ModelPricing),
+		claude.WithRequestTimeout(cfg.ClaudeTimeout),
+		claude.WithStreaming(cfg.Stream, cfg.StreamFallback),
+		claude.WithParseRetries(cfg.ParseRetries),
+		claude.WithModelTimeouts(cfg.ModelTimeouts),
+		claude.WithAnalysisTimeout(cfg.AnalysisTimeout),
+		claude.WithOutboundAllowlist(cfg.OutboundAllowlist),
+		claude.WithCategories(cfg.Categories),
+		claude.WithRejectEmptyReasoning(cfg.RejectEmptyReasoning),
+		claude.WithRejectUnknownCategories(cfg.RejectUnknownCategories),
+		claude.WithRejectExtraFields(cfg.RejectExtraFields),
+		claude.WithDecisionMargin(cfg.DecisionThreshold, cfg.DecisionMargin),
+		claude.WithRiskMapping(cfg.RiskMapping),
+		claude.WithRuleScore(cfg.IncludeRuleScore),
+		claude.WithHysteresis(cfg.HysteresisWindow, cfg.HysteresisSwing, cfg.HysteresisSessionKey),
+		claude.WithSessionOverrides(cfg.SessionOverrides),
+		claude.WithSessionLimit(cfg.SessionLimit),
+		claude.WithMaxNestingDepth(cfg.MaxNestingDepth),
+		claude.WithImageLimits(cfg.MaxImages, cfg.MaxImageBytes),
+		claude.WithNestedJSONKeys(cfg.NestedJSONKeys, cfg.NestedJSONDepth),
+		claude.WithPromptTemplates(cfg.PromptTemplates),
+		claude.WithMissingKeyPolicy(cfg.PromptMissingKeys),
+		claude.WithVerbosity(cfg.Verbosity),
+		claude.WithLanguages(cfg.Languages, cfg.DefaultLanguage),
+		claude.WithCache(cfg.CacheTTL, cfg.CacheTTLJitter),
+		claude.WithCacheSalt(cfg.CacheSalt),
+		claude.WithSpendCap(cfg.SpendCap),
+	}
+	if cfg.ClaudeBaseURL != "" {
+		opts = append(opts, claude.WithBaseURL(cfg.ClaudeBaseURL))
+	}
+	for class, policy := range cfg.RetryPolicies {
+		opts = append(opts, claude.WithRetryPolicy(class, policy))
+	}
+
+	var resultStore *store.JSONLStore
+	if cfg.StorePath != "" {
+		storeOpts := []store.Option{store.WithStrictReads(cfg.StoreStrict)}
+		if cfg.AuditSigner != nil {
+			storeOpts = append(storeOpts, store.WithSigner(cfg.AuditSigner))
+		}
+		resultStore, err = store.OpenJSONL(cfg.StorePath, storeOpts...)
+		if err != nil {
+			log.Fatalf("Could not open result store: %v", err)
+		}
+		opts = append(opts, claude.WithStore(resultStore))
+	}
+	if cfg.Standby {
+		log.Println("Standby mode enabled: serving only cached or stored decisions")
+		if resultStore == nil && cfg.CacheTTL == 0 {
+			log.Println("Warning: standby mode without a cache or result store will reject every analysis")
+		}
+		opts = append(opts, claude.WithStandby(true))
+	}
+	claudeService, err := claude.NewService(cfg.ClaudeAPIKey, opts...)
+	if err != nil {
+		log.Fatalf("Could not create Claude service: %v", err)
+	}
+
+	events, eventsFile, err := openDecisionEmitter(cfg.DecisionEvents, claudeService.PolicyVersion(), cfg.OutputRedaction)
+	if err != nil {
+		log.Fatalf("Could not open decision event stream: %v", err)
+	}
+	tenants, err := newTenantRegistry(cfg.TenantConfig, cfg, claudeService)
+	if err != nil {
+		log.Fatalf("Could not load tenant config: %v", err)
+	}
+
+	bgCtx, cancelBackground := context.WithCancel(context.Background())
+	warmUp(bgCtx, claudeService, cfg.WarmupGrace, cfg.ModelsRefreshInterval)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthCheckHandler)
+	mux.HandleFunc("/ready", readinessHandler(claudeService))
+	// Partner-facing analysis endpoints require signed requests when
+	// partner secrets are configured, and honor Idempotency-Key.
+	var idem *idempotency
+	if cfg.IdempotencyTTL > 0 {
+		idem = newIdempotency(cfg.IdempotencyTTL, cfg.IdempotencyWait)
+	}
+	signed := func(h http.Handler) http.Handler {
+		return signatureMiddleware(cfg.PartnerSecrets, cfg.SignatureMaxSkew, time.Now, idem.middleware(h))
+	}
+	// The latency SLO covers synchronous analyses, measured from when the
+	// handler starts to when it returns.
+	sloTracker := slo.New(cfg.SLO.Target, cfg.SLO.Objective, cfg.SLO.Window)
+	registry.NewGaugeFunc("mcp_slo_compliance", "Fraction of synchronous analyses within the latency SLO target over the rolling window.", func() float64 {
+		return sloTracker.Report().Compliance
+	})
+	registry.NewGaugeFunc("mcp_slo_burn_rate", "Rate at which the latency SLO error budget is being spent; above 1 exhausts it before the window ends.", func() float64 {
+		return sloTracker.Report().BurnRate
+	})
+	callbacks := newCallbackDispatcher(cfg.Callbacks, cfg.PartnerSecrets, registry)
+	jobs := newJobQueue(cfg.AsyncMaxJobs, cfg.MaxRequestTimeout, cfg.AsyncRetention, callbacks)
+	lastErrors := newErrorLog(cfg.LastErrors)
+	geo := newGeoEnricher(cfg.GeoIPDatabases, cfg.GeoIPClientIPHeader, cfg.GeoIPTrustedProxies, registry)
+	mux.Handle("/analyze", sloMiddleware(sloTracker, signed(analyzeHandler(claudeService, cfg, tenants, geo, jobs, resultStore, events, lastErrors))))
+	mux.Handle("/analyze/batch", signed(batchHandler(claudeService, cfg, tenants, geo, events, lastErrors)))
+	mux.Handle("/analyze/batch/stream", signed(batchStreamHandler(claudeService, cfg, tenants, geo, events, lastErrors)))
+	mux.Handle("/analyze/async", signed(asyncAnalyzeHandler(claudeService, cfg, tenants, geo, jobs, resultStore, events, lastErrors)))
+	mux.HandleFunc("/jobs/{id}", jobHandler(jobs))
+	stats := statsSources{svc: claudeService, jobs: jobs, slo: sloTracker}
+	mux.Handle("/stats", requireAdmin(cfg.AdminToken, statsHandler(stats)))
+	mux.Handle("/whoami", signed(whoamiHandler(tenants)))
+	mux.Handle("/admin/reload", requireAdmin(cfg.AdminToken, reloadHandler(tenants, geo)))
+	mux.Handle("/admin/last-error", requireAdmin(cfg.AdminToken, lastErrorHandler(lastErrors)))
+	mux.Handle("/admin/canary", requireAdmin(cfg.AdminToken, canaryHandler(claudeService, cfg)))
+	mux.Handle("/metrics", registry.Handler())
+	if resultStore != nil {
+		mux.Handle("/history", requireAdmin(cfg.AdminToken, historyHandler(claudeService, resultStore, cfg.HistoryQueryLimits)))
+		mux.Handle("/admin/store/health", requireAdmin(cfg.AdminToken, storeHealthHandler(resultStore)))
+		registry.NewGaugeFunc("mcp_store_corrupted_records", "Result store lines skipped at startup because they couldn't be decoded.", func() float64 {
+			return float64(resultStore.Health().Corrupted)
+		})
+		feedback := newFeedbackMetrics(registry, cfg.FeedbackMinLabels)
+		feedback.update(resultStore)
+		mux.Handle("/feedback", requireAdmin(cfg.AdminToken, feedbackHandler(resultStore, feedback, cfg)))
+	}
+
+	// Long-lived streams sit outside the per-request time budget and are
+	// ended explicitly at shutdown, since the server won't wait them out.
+	streamsDone := make(chan struct{})
+	root := http.NewServeMux()
+	root.Handle("/stats/stream", requireAdmin(cfg.AdminToken, statsStreamHandler(stats, cfg.StatsStreamInterval, streamsDone)))
+	shedder := newLoadShedder(cfg.LoadShed, registry)
+	root.Handle("/", shedder.middleware(timeBudgetMiddleware(cfg.MaxRequestTimeout, mux)))
+
+	abortedWrites := registry.NewCounter("mcp_http_aborted_writes_total", "Responses abandoned because the client disconnected or stopped reading.")
+	server.RegisterOnShutdown(func() { close(streamsDone) })
+
+	// Subsystems are closed in ascending Order: stop accepting traffic first,
+	// then anything that depends on in-flight work having finished.
+	seq := shutdown.NewSequence(cfg.ShutdownTimeout)
+	seq.Register(shutdown.Step{
+		Name:    "http server",
+		Order:   0,
+		Timeout: cfg.HTTPShutdownTimeout,
+		Closer:  shutdown.CloserFunc(server.Shutdown),
+	})
+	seq.Register(shutdown.Step{
+		Name:  "background tasks",
+		Order: 0,
+		Closer: shutdown.CloserFunc(func(context.Context) error {
+			cancelBackground()
+			return nil
+		}),
+	})
+	// Pending async jobs may finish within the drain timeout, after which
+	// they are cancelled and fail.
+	seq.Register(shutdown.Step{
+		Name:    "async jobs",
+		Order:   1,
+		Timeout: cfg.AsyncDrainTimeout,
+		Closer:  jobs,
+	})
+	if callbacks != nil {
+		// Runs once every job has completed or been cancelled and failed,
+		// so each job's callback is sent, along with any pending batches.
+		// Deliveries still in flight when the timeout ends are abandoned.
+		seq.Register(shutdown.Step{
+			Name:    "callbacks",
+			Order:   5,
+			Timeout: cfg.Callbacks.Timeout,
+			Closer:  callbacks,
+		})
+	}
+	if eventsFile != nil {
+		seq.Register(shutdown.Step{
+			Name:  "decision events",
+			Order: 10,
+			Closer: shutdown.CloserFunc(func(context.Context) error {
+				return eventsFile.Close()
+			}),
+		})
+	}
+	if resultStore != nil {
+		seq.Register(shutdown.Step{
+			Name:    "result store",
+			Order:   10,
+			Timeout: 5 * time.Second,
+			Closer:  resultStore,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	gate.open(trace.Middleware(slowClientMiddleware(cfg.ResponseWriteTimeout, abortedWrites, root)))
+	log.Printf("MCP Go Server ready on %s", serverAddr)
+
+	select {
+	case err := <-serverErr:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Could not listen on %s: %v\n", serverAddr, err)
+		}
+	case <-ctx.Done():
+		log.Println("MCP Go Server shutting down")
+		if err := seq.Run(context.Background()); err != nil {
+			log.Printf("Shutdown completed with errors: %v", err)
+		}
 	}
 }
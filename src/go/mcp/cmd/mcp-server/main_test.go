@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+// rawGet sends a bare HTTP/1.0 request line, with no Host header, to srv
+// and returns the response.
+func rawGet(t *testing.T, srv *httptest.Server, path string) *http.Response {
+	t.Helper()
+	return rawRequest(t, srv, "GET "+path+" HTTP/1.0\r\n\r\n")
+}
+
+// rawRequest writes request to srv verbatim and reads the response.
+func rawRequest(t *testing.T, srv *httptest.Server, request string) *http.Response {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestHealthOverHTTP10WithoutHost(t *testing.T) {
+	// The handler chain main serves, with only /health behind it.
+	gate := &startupGate{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthCheckHandler)
+	root := http.NewServeMux()
+	root.Handle("/", timeBudgetMiddleware(time.Second, mux))
+	srv := httptest.NewServer(gate)
+	defer srv.Close()
+
+	check := func(stage string) {
+		resp := rawGet(t, srv, "/health")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", stage, resp.StatusCode)
+		}
+		var status HealthStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil || status.Status != "ok" {
+			t.Errorf("%s: body = %+v, %v", stage, status, err)
+		}
+	}
+	check("starting")
+	aborted := metrics.NewRegistry().NewCounter("aborted_total", "Aborted writes.")
+	gate.open(trace.Middleware(slowClientMiddleware(time.Second, aborted, root)))
+	check("ready")
+}
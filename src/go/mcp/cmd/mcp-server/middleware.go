@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/slo"
+)
+
+const (
+	timeoutHeader = "X-Timeout-Ms"
+	budgetHeader  = "X-Budget-Ms"
+)
+
+// statusRecorder remembers whether and with which status a handler responded.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// timeBudgetMiddleware applies a per-request deadline taken from the client's
+// X-Timeout-Ms header, clamped to max. Requests without the header get max.
+// The effective budget is echoed in X-Budget-Ms, and a handler that runs out
+// of budget without responding produces a 504. The deadline also ends the
+// request's Claude call unless another request still waits for it.
+func timeBudgetMiddleware(max time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget := max
+		if v := r.Header.Get(timeoutHeader); v != "" {
+			ms, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || ms <= 0 {
+				writeError(w, http.StatusBadRequest, timeoutHeader+" must be a positive integer number of milliseconds")
+				return
+			}
+			if requested := time.Duration(ms) * time.Millisecond; requested < budget {
+				budget = requested
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+
+		w.Header().Set(budgetHeader, strconv.FormatInt(budget.Milliseconds(), 10))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, "request exceeded its time budget")
+		}
+	})
+}
+
+// requireAdmin guards operator endpoints with a bearer token. An empty token
+// leaves them open, matching deployments that restrict access at the network
+// layer instead.
+func requireAdmin(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "admin authorization required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sloMiddleware records how long each request to next took against the
+// latency SLO.
+func sloMiddleware(t *slo.Tracker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		t.Observe(time.Since(start))
+	})
+}
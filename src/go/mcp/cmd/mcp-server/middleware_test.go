@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// budgetOf returns a handler reporting the time left on each request's
+// context in got.
+func budgetOf(got *time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ := r.Context().Deadline()
+		*got = time.Until(deadline)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestTimeBudgetMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header string
+		want   time.Duration
+		echo   string
+	}{
+		{"absent uses max", "", 2 * time.Second, "2000"},
+		{"honored below max", "500", 500 * time.Millisecond, "500"},
+		{"clamped to max", "60000", 2 * time.Second, "2000"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got time.Duration
+			h := timeBudgetMiddleware(2*time.Second, budgetOf(&got))
+			req := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+			if tc.header != "" {
+				req.Header.Set(timeoutHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if got > tc.want || got < tc.want-100*time.Millisecond {
+				t.Errorf("handler budget = %s, want about %s", got, tc.want)
+			}
+			if echo := rec.Header().Get(budgetHeader); echo != tc.echo {
+				t.Errorf("%s = %q, want %q", budgetHeader, echo, tc.echo)
+			}
+		})
+	}
+}
+
+func TestTimeBudgetMiddlewareRejectsInvalidHeader(t *testing.T) {
+	h := timeBudgetMiddleware(time.Second, http.NotFoundHandler())
+	for _, v := range []string{"0", "-5", "soon"} {
+		req := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+		req.Header.Set(timeoutHeader, v)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %q: status = %d, want 400", timeoutHeader, v, rec.Code)
+		}
+	}
+}
+
+func TestTimeBudgetMiddlewareExpiry(t *testing.T) {
+	h := timeBudgetMiddleware(time.Second, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+	req.Header.Set(timeoutHeader, "20")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+}
+
+func TestTimeBudgetMiddlewareKeepsHandlerResponse(t *testing.T) {
+	// A handler that answered before the budget ran out keeps its status.
+	h := timeBudgetMiddleware(time.Second, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		<-r.Context().Done()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+	req.Header.Set(timeoutHeader, "20")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
+
+func TestTimeBudgetExpiryCancelsClaudeCall(t *testing.T) {
+	var stub *claudeStub
+	stub = newClaudeStubFunc(t, func(w http.ResponseWriter, _ string, call int64) {
+		<-stub.requestContext(call).Done()
+	})
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	h := timeBudgetMiddleware(time.Second, analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors)))
+
+	start := time.Now()
+	if rec := post(h, "/analyze", analyzeBody, http.Header{timeoutHeader: {"50"}}); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+	// The Claude call ends with the budget rather than running on.
+	stub.waitCancelled(t, 1)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Claude call given up after %s, want at the 50ms budget", elapsed)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want no retry past the budget", n)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// analyzeMode is whether POST /analyze answers with the decision (sync) or
+// with a job to poll (async).
+type analyzeMode string
+
+const (
+	modeSync  analyzeMode = "sync"
+	modeAsync analyzeMode = "async"
+)
+
+// negotiateAnalyzeMode picks the mode for a POST /analyze request from its
+// Prefer header (RFC 7240): respond-async asks for a job, wait for the
+// decision itself. Without either, or when the preferred mode is not in
+// allowed, def is used. The second result is the preference to echo in
+// Preference-Applied, if one was honored.
+func negotiateAnalyzeMode(r *http.Request, def analyzeMode, allowed []analyzeMode) (analyzeMode, string) {
+	var preferred analyzeMode
+	var token string
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(pref, ";")
+			name, _, _ = strings.Cut(name, "=")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "respond-async":
+				preferred, token = modeAsync, "respond-async"
+			case "wait":
+				if preferred == "" {
+					preferred = modeSync
+				}
+			}
+		}
+	}
+	if preferred == "" || !slices.Contains(allowed, preferred) {
+		return def, ""
+	}
+	return preferred, token
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+func TestNegotiateAnalyzeMode(t *testing.T) {
+	both := []analyzeMode{modeSync, modeAsync}
+	for _, tc := range []struct {
+		prefer  []string
+		def     analyzeMode
+		allowed []analyzeMode
+		want    analyzeMode
+		applied string
+	}{
+		{nil, modeSync, both, modeSync, ""},
+		{nil, modeAsync, both, modeAsync, ""},
+		{[]string{"respond-async"}, modeSync, both, modeAsync, "respond-async"},
+		{[]string{"Respond-Async; foo=bar, wait=10"}, modeSync, both, modeAsync, "respond-async"},
+		{[]string{"wait=5"}, modeAsync, both, modeSync, ""},
+		{[]string{"return=minimal", "respond-async"}, modeSync, both, modeAsync, "respond-async"},
+		{[]string{"respond-async"}, modeSync, []analyzeMode{modeSync}, modeSync, ""}, // Async not allowed
+		{[]string{"wait"}, modeAsync, []analyzeMode{modeAsync}, modeAsync, ""},       // Sync not allowed
+		{[]string{"handling=lenient"}, modeSync, both, modeSync, ""},                 // Unrelated preference
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+		for _, v := range tc.prefer {
+			r.Header.Add("Prefer", v)
+		}
+		mode, applied := negotiateAnalyzeMode(r, tc.def, tc.allowed)
+		if mode != tc.want || applied != tc.applied {
+			t.Errorf("Prefer %q, default %s, allowed %v: got %s, %q; want %s, %q", tc.prefer, tc.def, tc.allowed, mode, applied, tc.want, tc.applied)
+		}
+	}
+}
+
+func TestAnalyzeSyncAndRespondAsync(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	q := newJobQueue(cfg.AsyncMaxJobs, 5*time.Second, cfg.AsyncRetention, nil)
+	t.Cleanup(func() { q.Close(t.Context()) })
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	mux := http.NewServeMux()
+	mux.Handle("/analyze", analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, q, st, nil, newErrorLog(cfg.LastErrors)))
+	mux.Handle("/jobs/{id}", jobHandler(q))
+	s := &jobsServer{mux: mux, q: q}
+
+	// Without a preference the decision comes back at once.
+	rec := post(mux, "/analyze", analyzeBody, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Preference-Applied") != "" {
+		t.Fatalf("sync: status = %d, Preference-Applied %q", rec.Code, rec.Header().Get("Preference-Applied"))
+	}
+	if result := decodeResult(t, rec); !result.IsLikelyLive {
+		t.Errorf("sync: result = %+v", result)
+	}
+	if _, err := st.Label(t.Context(), rec.Header().Get(requestIDHeader), true); err != nil {
+		t.Errorf("sync: served decision not stored: %v", err)
+	}
+
+	// With respond-async it is a job to poll.
+	rec = post(mux, "/analyze", analyzeBody, http.Header{"Prefer": {"respond-async"}})
+	if got := rec.Header().Get("Preference-Applied"); got != "respond-async" {
+		t.Errorf("async: Preference-Applied = %q, want respond-async", got)
+	}
+	id := jobID(t, rec)
+	var job jobView
+	waitFor(t, "job "+id, func() bool {
+		job, _ = s.job(t, id)
+		return job.Status == JobDone
+	})
+	if job.Result == nil || !job.Result.IsLikelyLive {
+		t.Errorf("async: job = %+v", job)
+	}
+	// The decision is stored like a sync one, under the job ID.
+	if served, err := st.Label(t.Context(), id, true); err != nil {
+		t.Errorf("async: served decision not stored: %v", err)
+	} else if !served.Result.IsLikelyLive {
+		t.Errorf("async: stored result = %+v", served.Result)
+	}
+
+	// The configured default and allowed modes are enforced.
+	cfg.AnalyzeMode, cfg.AnalyzeModes = modeAsync, []analyzeMode{modeAsync}
+	if rec := post(mux, "/analyze", analyzeBody, http.Header{"Prefer": {"wait"}}); rec.Code != http.StatusAccepted {
+		t.Errorf("async only, Prefer wait: status = %d, want 202", rec.Code)
+	}
+	cfg.AnalyzeMode, cfg.AnalyzeModes = modeSync, []analyzeMode{modeSync}
+	if rec := post(mux, "/analyze", analyzeBody, http.Header{"Prefer": {"respond-async"}}); rec.Code != http.StatusOK {
+		t.Errorf("sync only, Prefer respond-async: status = %d, want 200", rec.Code)
+	}
+}
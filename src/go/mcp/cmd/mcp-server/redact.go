@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// redactionMask replaces each redacted value in client responses.
+const redactionMask = "[redacted]"
+
+// minRedactedValueLen is the shortest input value masked by key; shorter
+// ones, such as a 0 or "no", would mask unrelated words.
+const minRedactedValueLen = 3
+
+// outputPatterns are the PII patterns -redact-output-patterns can name.
+// A match is masked only when its check, if any, accepts it.
+var outputPatterns = map[string]struct {
+	re    *regexp.Regexp
+	check func(string) bool
+}{
+	"email": {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	"ip": {
+		re: regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:(?:\.\d{1,3}){3})?|\d{1,3}(?:\.\d{1,3}){3}`),
+		check: func(s string) bool {
+			_, err := netip.ParseAddr(s)
+			return err == nil
+		},
+	},
+}
+
+// OutputRedaction masks sensitive values in the reasoning and factors
+// returned to clients and written to decision events. The decision, logs
+// and the result store keep the original text.
+type OutputRedaction struct {
+	// Keys are input field names, matched case-insensitively in any
+	// section and at any depth, whose values are masked wherever the
+	// reasoning repeats them.
+	Keys []string
+	// Patterns name entries of outputPatterns to mask regardless of the
+	// input.
+	Patterns []string
+}
+
+func (o OutputRedaction) enabled() bool { return len(o.Keys) > 0 || len(o.Patterns) > 0 }
+
+// validate checks that every pattern is known.
+func (o OutputRedaction) validate() error {
+	for _, p := range o.Patterns {
+		if _, ok := outputPatterns[p]; !ok {
+			names := make([]string, 0, len(outputPatterns))
+			for name := range outputPatterns {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return fmt.Errorf("unknown redact-output-patterns entry %q (want %s)", p, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// redact returns text with the matches of values, the input values under
+// o.Keys when non-nil, and of o.Patterns masked.
+func (o OutputRedaction) redact(text string, values *regexp.Regexp) string {
+	if text == "" {
+		return text
+	}
+	if values != nil {
+		text = values.ReplaceAllLiteralString(text, redactionMask)
+	}
+	for _, name := range o.Patterns {
+		p := outputPatterns[name]
+		text = p.re.ReplaceAllStringFunc(text, func(match string) string {
+			if p.check != nil && !p.check(match) {
+				return match
+			}
+			return redactionMask
+		})
+	}
+	return text
+}
+
+// valuesPattern returns a case-insensitive pattern matching any of the
+// values under o.Keys in input, or nil when there are none.
+func (o OutputRedaction) valuesPattern(input claude.AnalyzeDataForLivenessInput) *regexp.Regexp {
+	values := o.sensitiveValues(input)
+	if len(values) == 0 {
+		return nil
+	}
+	for i, v := range values {
+		values[i] = regexp.QuoteMeta(v)
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(values, "|"))
+}
+
+// sensitiveValues returns the values under o.Keys in input, longest first
+// so that a value containing another is masked whole.
+func (o OutputRedaction) sensitiveValues(input claude.AnalyzeDataForLivenessInput) []string {
+	if len(o.Keys) == 0 {
+		return nil
+	}
+	var values []string
+	var walk func(v interface{}, sensitive bool)
+	walk = func(v interface{}, sensitive bool) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				walk(child, sensitive || slices.ContainsFunc(o.Keys, func(key string) bool { return strings.EqualFold(key, k) }))
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child, sensitive)
+			}
+		case string:
+			if sensitive && len(v) >= minRedactedValueLen {
+				values = append(values, v)
+			}
+		case float64:
+			if s := strconv.FormatFloat(v, 'f', -1, 64); sensitive && len(s) >= minRedactedValueLen {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, section := range []map[string]interface{}{input.UserData, input.SessionData, input.TechnicalData} {
+		walk(section, false)
+	}
+	slices.SortFunc(values, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	return slices.Compact(values)
+}
+
+// apply masks the reasoning and factors of out, a client copy of a result
+// for input. The raw upstream response is dropped, as it repeats them.
+func (o OutputRedaction) apply(out *claude.LivenessAnalysisResult, input claude.AnalyzeDataForLivenessInput) {
+	values := o.valuesPattern(input)
+	out.Reasoning = o.redact(out.Reasoning, values)
+	if len(out.Factors) > 0 {
+		factors := make([]string, len(out.Factors))
+		for i, f := range out.Factors {
+			factors[i] = o.redact(f, values)
+		}
+		out.Factors = factors
+	}
+	out.RawResponse = ""
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/store"
+)
+
+// piiDecision repeats an email, IPv4 and IPv6 addresses and a phone number
+// from the input in its reasoning and factors, next to text that only
+// looks like them.
+const piiDecision = `{"is_likely_live": false, "confidence": 0.2,
+	"reasoning": "Signups from user@example.com and 203.0.113.7 at 10:30:45, phone 5550100.",
+	"factors": ["email user@example.com reused", "ip 2001:db8::1 on a blocklist", "client build 1.2.3"]}`
+
+const piiBody = `{"user_data": {"email": "user@example.com", "contact": {"phone": "5550100"}}, "session_data": {"session_id": "s1"}, "technical_data": {"ip_address": "203.0.113.7"}}`
+
+func TestOutputRedactionPatterns(t *testing.T) {
+	o := OutputRedaction{Patterns: []string{"email", "ip"}}
+	for _, tc := range []struct{ text, want string }{
+		{"", ""},
+		{"Mail to first.last+tag@mail.example.co.uk now.", "Mail to [redacted] now."},
+		{"From 192.0.2.1 and 2001:db8::1.", "From [redacted] and [redacted]."},
+		{"Mapped ::ffff:192.0.2.1 too.", "Mapped [redacted] too."},
+		{"At 10:30:45 on build 1.2.3.", "At 10:30:45 on build 1.2.3."},
+		{"Out of range 999.1.1.1.", "Out of range 999.1.1.1."},
+	} {
+		if got := o.redact(tc.text, nil); got != tc.want {
+			t.Errorf("redact(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+	if err := (OutputRedaction{Patterns: []string{"ssn"}}).validate(); err == nil || !strings.Contains(err.Error(), "email, ip") {
+		t.Errorf("unknown pattern: validate error = %v, want the known patterns listed", err)
+	}
+}
+
+func TestAnalyzeMasksClientResult(t *testing.T) {
+	stub := newClaudeStub(t, piiDecision)
+	svc := newTestService(t, stub, claude.WithVerbosity(claude.VerbosityDetailed)) // Factors are kept
+	cfg := testConfig()
+	cfg.OutputRedaction = OutputRedaction{Keys: []string{"PHONE"}, Patterns: []string{"email", "ip"}}
+	st, err := store.OpenJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer st.Close(t.Context())
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, st, nil, newErrorLog(cfg.LastErrors))
+
+	rec := post(h, "/analyze", piiBody, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	result := decodeResult(t, rec)
+	if want := "Signups from [redacted] and [redacted] at 10:30:45, phone [redacted]."; result.Reasoning != want {
+		t.Errorf("client reasoning = %q, want %q", result.Reasoning, want)
+	}
+	if want := []string{"email [redacted] reused", "ip [redacted] on a blocklist", "client build 1.2.3"}; !slices.Equal(result.Factors, want) {
+		t.Errorf("client factors = %q, want %q", result.Factors, want)
+	}
+	if result.RawResponse != "" {
+		t.Errorf("raw_response repeats the unmasked text: %q", result.RawResponse)
+	}
+	for _, pii := range []string{"user@example.com", "203.0.113.7", "2001:db8::1", "5550100"} {
+		if strings.Contains(rec.Body.String(), pii) {
+			t.Errorf("response repeats %s: %s", pii, rec.Body)
+		}
+	}
+
+	// The stored decision keeps the original text.
+	served, err := st.Label(t.Context(), rec.Header().Get(requestIDHeader), true)
+	if err != nil {
+		t.Fatalf("served decision not stored: %v", err)
+	}
+	if !strings.Contains(served.Result.Reasoning, "user@example.com") || !slices.Contains(served.Result.Factors, "ip 2001:db8::1 on a blocklist") {
+		t.Errorf("stored result = %+v, want the original reasoning and factors", served.Result)
+	}
+
+	// Without the option the client gets the text as Claude wrote it.
+	cfg = testConfig()
+	h = analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+	result = decodeResult(t, post(h, "/analyze", piiBody, nil))
+	if !strings.Contains(result.Reasoning, "203.0.113.7") || !slices.Contains(result.Factors, "email user@example.com reused") {
+		t.Errorf("unmasked result = %+v", result)
+	}
+}
+
+func TestBatchMasksClientResults(t *testing.T) {
+	stub := newClaudeStub(t, piiDecision)
+	svc := newTestService(t, stub, claude.WithVerbosity(claude.VerbosityDetailed))
+	cfg := testConfig()
+	cfg.OutputRedaction = OutputRedaction{Keys: []string{"phone"}, Patterns: []string{"email", "ip"}}
+	h := batchHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, newErrorLog(cfg.LastErrors))
+
+	rec := post(h, "/analyze/batch", `{"items": [`+piiBody+`]}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 || resp.Results[0].Result == nil {
+		t.Fatalf("decoding response %s: %v", rec.Body, err)
+	}
+	result := resp.Results[0].Result
+	if !strings.HasSuffix(result.Reasoning, "phone [redacted].") || result.Factors[0] != "email [redacted] reused" {
+		t.Errorf("batch result = %+v, want it masked", result)
+	}
+}
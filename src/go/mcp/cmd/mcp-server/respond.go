@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ErrorResponse is the JSON body returned for failed API requests.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON sends v as the JSON response body. The body is encoded up front
+// so an encoding failure can still become a 500, and so the response has a
+// Content-Length. Write failures are reported by slowClientWriter.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		status, body = http.StatusInternalServerError, []byte(`{"error":"encoding response failed"}`)
+	}
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+// decodeBody decodes the JSON request body into v, answering 400 itself when
+// it can't. An absent, empty or whitespace-only body gets its own message so
+// the common mistake of posting nothing isn't reported as a bare EOF. With
+// strict set, fields v doesn't define are rejected.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, strict bool) bool {
+	body := bufio.NewReader(r.Body)
+	for {
+		b, err := body.ReadByte()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, "request body is required")
+			return false
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "reading request body: "+err.Error())
+			return false
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			body.UnreadByte()
+			break
+		}
+	}
+	dec := json.NewDecoder(body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeRequiresBody(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	errorOf := func(resp *http.Response) string {
+		t.Helper()
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+		var body ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding error body: %v", err)
+		}
+		return body.Error
+	}
+
+	for name, body := range map[string]string{"empty": "", "whitespace": " \r\n\t "} {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("%s body: %v", name, err)
+		}
+		if msg := errorOf(resp); msg != "request body is required" {
+			t.Errorf("%s body: error = %q", name, msg)
+		}
+	}
+
+	// Neither Content-Length nor Transfer-Encoding: no body at all.
+	resp := rawRequest(t, srv, "POST / HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nConnection: close\r\n\r\n")
+	if msg := errorOf(resp); msg != "request body is required" {
+		t.Errorf("absent body: error = %q", msg)
+	}
+	resp = rawRequest(t, srv, "POST / HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n0\r\n\r\n")
+	if msg := errorOf(resp); msg != "request body is required" {
+		t.Errorf("empty chunked body: error = %q", msg)
+	}
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(" {"))
+	if err != nil {
+		t.Fatalf("malformed body: %v", err)
+	}
+	if msg := errorOf(resp); !strings.HasPrefix(msg, "invalid request body: ") {
+		t.Errorf("malformed body: error = %q", msg)
+	}
+	if n := stub.calls.Load(); n != 0 {
+		t.Errorf("Claude calls = %d, want 0", n)
+	}
+}
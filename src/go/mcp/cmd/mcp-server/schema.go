@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+const schemaVersionHeader = "X-Schema-Version"
+
+// currentSchemaVersion is the request/response contract used when the
+// client does not ask for one.
+const currentSchemaVersion = "2"
+
+// supportedSchemaVersions lists every contract version still served.
+// Version 1 is the original response shape without categories, usage or
+// decision TTL fields.
+var supportedSchemaVersions = []string{"1", "2"}
+
+// negotiateSchemaVersion picks the schema version from the X-Schema-Version
+// header and the request body's schema_version field. Either may be omitted,
+// but if both are given they must agree.
+func negotiateSchemaVersion(header, body string) (string, error) {
+	header, body = strings.TrimSpace(header), strings.TrimSpace(body)
+	version := body
+	if header != "" {
+		if body != "" && body != header {
+			return "", fmt.Errorf("%s %q does not match schema_version %q", schemaVersionHeader, header, body)
+		}
+		version = header
+	}
+	if version == "" {
+		return currentSchemaVersion, nil
+	}
+	if !slices.Contains(supportedSchemaVersions, version) {
+		return "", fmt.Errorf("unsupported schema version %q; supported versions are %s", version, strings.Join(supportedSchemaVersions, ", "))
+	}
+	return version, nil
+}
+
+// analyzeResponseV1 is the schema version 1 body of POST /analyze.
+type analyzeResponseV1 struct {
+	IsLikelyLive  bool    `json:"is_likely_live"`
+	Confidence    float64 `json:"confidence"`
+	Reasoning     string  `json:"reasoning"`
+	RawResponse   string  `json:"raw_response"`
+	SchemaVersion string  `json:"schema_version"`
+}
+
+// versionedResponse shapes the /analyze body for the negotiated version.
+func versionedResponse(version string, result *claude.LivenessAnalysisResult, ttlSeconds int, requestID string) interface{} {
+	if version == "1" {
+		return analyzeResponseV1{
+			IsLikelyLive:  result.IsLikelyLive,
+			Confidence:    result.Confidence,
+			Reasoning:     result.Reasoning,
+			RawResponse:   result.RawResponse,
+			SchemaVersion: version,
+		}
+	}
+	return analyzeResponse{
+		LivenessAnalysisResult: result,
+		DecisionTTLSeconds:     ttlSeconds,
+		SchemaVersion:          version,
+		RequestID:              requestID,
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestNegotiateSchemaVersion(t *testing.T) {
+	for _, tc := range []struct {
+		header, body string
+		want         string
+		wantErr      bool
+	}{
+		{"", "", currentSchemaVersion, false},
+		{"1", "", "1", false},
+		{"", "1", "1", false},
+		{" 2 ", "2", "2", false},
+		{"3", "", "", true},
+		{"", "0", "", true},
+		{"1", "2", "", true},
+	} {
+		got, err := negotiateSchemaVersion(tc.header, tc.body)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("negotiateSchemaVersion(%q, %q) = %q, %v; want %q, error %t", tc.header, tc.body, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestAnalyzeSchemaVersions(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+	fields := func(t *testing.T, header, body string) map[string]any {
+		t.Helper()
+		var hdr http.Header
+		if header != "" {
+			hdr = http.Header{schemaVersionHeader: {header}}
+		}
+		rec := post(h, "/analyze", body, hdr)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		return m
+	}
+
+	t.Run("omitted", func(t *testing.T) {
+		m := fields(t, "", analyzeBody)
+		if m["schema_version"] != currentSchemaVersion {
+			t.Errorf("schema_version = %v, want %s", m["schema_version"], currentSchemaVersion)
+		}
+		for _, key := range []string{"outcome", "decision_ttl_seconds", "request_id"} {
+			if _, ok := m[key]; !ok {
+				t.Errorf("current version lacks %s", key)
+			}
+		}
+	})
+	t.Run("older supported", func(t *testing.T) {
+		body := `{"schema_version": "1", "user_data": {"email": "user@example.com"}}`
+		m := fields(t, "", body)
+		if m["schema_version"] != "1" || m["is_likely_live"] != true {
+			t.Errorf("v1 body = %v", m)
+		}
+		for _, key := range []string{"outcome", "decision_ttl_seconds", "request_id", "risk_score"} {
+			if _, ok := m[key]; ok {
+				t.Errorf("v1 body includes newer field %s", key)
+			}
+		}
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		rec := post(h, "/analyze", analyzeBody, http.Header{schemaVersionHeader: {"9"}})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+	if n := stub.calls.Load(); n != 2 {
+		t.Errorf("Claude calls = %d; the unsupported version should be rejected before analysis", n)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedHeader returns the headers signing body as partner with secret at ts.
+func signedHeader(partner, secret string, ts time.Time, body string) http.Header {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	h := make(http.Header)
+	h.Set(partnerIDHeader, partner)
+	h.Set(timestampHeader, unix)
+	h.Set(signatureHeader, "sha256="+hex.EncodeToString(signPayload(secret, unix, []byte(body))))
+	return h
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	now := time.Unix(1_750_000_000, 0)
+	var gotPartner, gotBody string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPartner = partnerFromContext(r.Context())
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+	})
+	h := signatureMiddleware(map[string]string{"acme": "s3cret"}, 5*time.Minute, func() time.Time { return now }, next)
+
+	rec := post(h, "/analyze", analyzeBody, signedHeader("acme", "s3cret", now.Add(-time.Minute), analyzeBody))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid signature: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if gotPartner != "acme" || gotBody != analyzeBody {
+		t.Errorf("handler saw partner %q and body %q; want acme and the signed body", gotPartner, gotBody)
+	}
+
+	for name, header := range map[string]http.Header{
+		"tampered body":    signedHeader("acme", "s3cret", now, `{"user_data": {}}`),
+		"wrong secret":     signedHeader("acme", "guess", now, analyzeBody),
+		"stale timestamp":  signedHeader("acme", "s3cret", now.Add(-6*time.Minute), analyzeBody),
+		"future timestamp": signedHeader("acme", "s3cret", now.Add(6*time.Minute), analyzeBody),
+		"unknown partner":  signedHeader("other", "s3cret", now, analyzeBody),
+		"unsigned":         nil,
+	} {
+		if rec := post(h, "/analyze", analyzeBody, header); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// debugLogging enables debugf output; see -log-debug.
+var debugLogging bool
+
+// debugf logs like log.Printf, but only with -log-debug.
+func debugf(format string, args ...interface{}) {
+	if debugLogging {
+		log.Printf("DEBUG: "+format, args...)
+	}
+}
+
+// clientGone reports whether err from writing a response means the client
+// disconnected or stopped reading, rather than a fault of ours.
+func clientGone(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, errClientGone)
+}
+
+// errClientGone is returned for writes after one has already failed because
+// the client went away.
+var errClientGone = errors.New("client went away")
+
+// slowClientWriter bounds each write of a response by a deadline, so a
+// client that stops reading can tie up its handler for at most timeout per
+// write. After a write fails because the client is gone, later writes fail
+// immediately.
+type slowClientWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+	r       *http.Request
+	aborted *metrics.Counter
+	gone    bool
+}
+
+func (w *slowClientWriter) Write(p []byte) (int, error) {
+	if w.gone {
+		return 0, errClientGone
+	}
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout)) // unsupported writers keep the server timeout
+	n, err := w.ResponseWriter.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		w.fail(err)
+	}
+	return n, err
+}
+
+// FlushError sends buffered data under the same deadline as Write.
+func (w *slowClientWriter) FlushError() error {
+	if w.gone {
+		return errClientGone
+	}
+	w.rc.SetWriteDeadline(time.Now().Add(w.timeout))
+	err := w.rc.Flush()
+	if err != nil {
+		w.fail(err)
+	}
+	return err
+}
+
+func (w *slowClientWriter) Flush() { w.FlushError() }
+
+func (w *slowClientWriter) fail(err error) {
+	if clientGone(err) || w.r.Context().Err() != nil {
+		w.gone = true
+		w.aborted.Inc()
+		debugf("Aborted response to %s %s: client went away: %v", w.r.Method, w.r.URL.Path, err)
+		return
+	}
+	log.Printf("Error writing response to %s %s: %v", w.r.Method, w.r.URL.Path, err)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *slowClientWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// slowClientMiddleware applies slowClientWriter to every response, counting
+// responses abandoned because the client went away in aborted.
+func slowClientMiddleware(timeout time.Duration, aborted *metrics.Counter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&slowClientWriter{
+			ResponseWriter: w,
+			rc:             http.NewResponseController(w),
+			timeout:        timeout,
+			r:              r,
+			aborted:        aborted,
+		}, r)
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// writeOutcome is how a handler's attempt to write a large response ended.
+type writeOutcome struct {
+	err, after error // The failed write, and a write attempted after it
+	elapsed    time.Duration
+}
+
+// largeResponseServer serves a response far larger than the socket buffers
+// through slowClientMiddleware, reporting how writing it ended.
+func largeResponseServer(t *testing.T, timeout time.Duration, aborted *metrics.Counter) (*httptest.Server, <-chan writeOutcome) {
+	t.Helper()
+	outcomes := make(chan writeOutcome, 1)
+	chunk := bytes.Repeat([]byte("x"), 1<<20)
+	srv := httptest.NewServer(slowClientMiddleware(timeout, aborted, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var err error
+		for range 256 {
+			if _, err = w.Write(chunk); err != nil {
+				break
+			}
+		}
+		_, after := w.Write(chunk)
+		outcomes <- writeOutcome{err: err, after: after, elapsed: time.Since(start)}
+	})))
+	t.Cleanup(srv.Close)
+	return srv, outcomes
+}
+
+// dialAndRequest sends a GET over a raw connection, without reading the
+// response.
+func dialAndRequest(t *testing.T, srv *httptest.Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return conn
+}
+
+func TestSlowClientWriteAborted(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr); debugLogging = false })
+	debugLogging = true
+
+	for _, tc := range []struct {
+		name   string
+		client func(net.Conn)
+	}{
+		// Never reads, so the writes stall until the write deadline.
+		{"stalled", func(net.Conn) {}},
+		// Reads a little, then hangs up.
+		{"disconnected", func(conn net.Conn) {
+			io.ReadFull(conn, make([]byte, 64<<10))
+			conn.Close()
+		}},
+	} {
+		aborted := metrics.NewRegistry().NewCounter("aborted", "")
+		srv, outcomes := largeResponseServer(t, 50*time.Millisecond, aborted)
+		tc.client(dialAndRequest(t, srv))
+
+		var got writeOutcome
+		select {
+		case got = <-outcomes:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: handler still writing", tc.name)
+		}
+		if !clientGone(got.err) {
+			t.Errorf("%s: write error = %v, want one meaning the client is gone", tc.name, got.err)
+		}
+		if !errors.Is(got.after, errClientGone) {
+			t.Errorf("%s: write after the failure = %v, want errClientGone", tc.name, got.after)
+		}
+		if got.elapsed > 5*time.Second {
+			t.Errorf("%s: handler blocked for %s", tc.name, got.elapsed)
+		}
+		if v := aborted.Value(); v != 1 {
+			t.Errorf("%s: aborted writes = %v, want 1", tc.name, v)
+		}
+	}
+	if strings.Contains(logs.String(), "Error writing response") || strings.Count(logs.String(), "DEBUG: Aborted response") != 2 {
+		t.Errorf("client disconnects not logged once each at debug:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// startupGate is the server's handler while the service is being set up.
+// The listener is bound first so the port is claimed and liveness probes
+// pass during a slow startup; until open is called every request other
+// than /health gets 503 instead of reaching a half-built service.
+type startupGate struct {
+	initialized atomic.Bool
+	handler     http.Handler // Set once, before initialized
+}
+
+// open starts routing requests to h. It must be called once, when setup
+// has finished.
+func (g *startupGate) open(h http.Handler) {
+	g.handler = h
+	g.initialized.Store(true)
+}
+
+func (g *startupGate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.initialized.Load() {
+		g.handler.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path == "/health" {
+		healthCheckHandler(w, r)
+		return
+	}
+	w.Header().Set("Retry-After", "1")
+	writeError(w, http.StatusServiceUnavailable, "service starting")
+}
+
+// warmUp fetches the model metadata for svc in the background; until it
+// arrives, or if it never does, the service runs on the built-in model
+// defaults. With a grace window, rule-only decisions are served until
+// warmup ends or the window elapses, whichever comes first. The models are
+// then refreshed every refresh, if set, until ctx is done.
+func warmUp(ctx context.Context, svc *claude.ClaudeService, grace, refresh time.Duration) {
+	if grace > 0 {
+		svc.SetRuleOnly(true)
+		time.AfterFunc(grace, func() { svc.SetRuleOnly(false) })
+	}
+	go func() {
+		warmupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := svc.WarmupModels(warmupCtx); err != nil {
+			log.Printf("Model warmup failed, using built-in defaults: %v", err)
+		}
+		svc.SetRuleOnly(false)
+		if refresh > 0 {
+			svc.RefreshModels(ctx, refresh)
+		}
+	}()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// slowModelsAPI serves the Models API once release is closed, and answers
+// analyses with a live decision, counting them.
+func slowModelsAPI(t *testing.T, release <-chan struct{}, analyses *atomic.Int64) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/models":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": []claude.ModelInfo{{ID: claude.DefaultModel}}})
+		case "/v1/messages":
+			analyses.Add(1)
+			writeMessage(w, decision(true, 0.9, "Consistent signals."))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// readinessMode returns the mode GET /ready reports for svc.
+func readinessMode(t *testing.T, svc *claude.ClaudeService) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	readinessHandler(svc).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	var status ReadinessStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK || status.Status != "ready" {
+		t.Fatalf("/ready: status %d, body %s", rec.Code, rec.Body)
+	}
+	return status.Mode
+}
+
+// waitForModeChange waits for the next change signalled on ch.
+func waitForModeChange(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("mode did not change")
+	}
+}
+
+func TestWarmupServesRuleOnlyUntilModelsLoad(t *testing.T) {
+	release := make(chan struct{})
+	var analyses atomic.Int64
+	srv := slowModelsAPI(t, release, &analyses)
+	svc, err := claude.NewService("test-key", claude.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	cfg := testConfig()
+	h := analyzeHandler(svc, cfg, newTestTenants(t, cfg, svc), nil, nil, nil, nil, newErrorLog(cfg.LastErrors))
+
+	warmUp(t.Context(), svc, time.Minute, 0)
+	if mode := readinessMode(t, svc); mode != "rule_only" {
+		t.Errorf("during warmup: /ready mode = %q, want rule_only", mode)
+	}
+	rec := post(h, "/analyze", analyzeBody, nil)
+	if rec.Code != http.StatusOK || !decodeResult(t, rec).RuleOnly {
+		t.Errorf("during warmup: status %d, body %s; want a rule-only decision", rec.Code, rec.Body)
+	}
+	if n := analyses.Load(); n != 0 {
+		t.Errorf("during warmup: %d Claude calls, want 0", n)
+	}
+
+	changed := svc.ModeChanges()
+	close(release)
+	waitForModeChange(t, changed)
+	if mode := readinessMode(t, svc); mode != "claude" {
+		t.Errorf("after warmup: /ready mode = %q, want claude", mode)
+	}
+	rec = post(h, "/analyze", analyzeBody, nil)
+	if rec.Code != http.StatusOK || decodeResult(t, rec).RuleOnly {
+		t.Errorf("after warmup: status %d, body %s; want a Claude decision", rec.Code, rec.Body)
+	}
+	if n := analyses.Load(); n != 1 {
+		t.Errorf("after warmup: %d Claude calls, want 1", n)
+	}
+}
+
+func TestWarmupGraceWindowEnds(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var analyses atomic.Int64
+	srv := slowModelsAPI(t, release, &analyses)
+	svc, err := claude.NewService("test-key", claude.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	// The Models API never answers in time; the grace window ends anyway.
+	warmUp(t.Context(), svc, 20*time.Millisecond, 0)
+	if !svc.RuleOnly() {
+		t.Fatal("not rule-only during the grace window")
+	}
+	for deadline := time.Now().Add(5 * time.Second); svc.RuleOnly(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("still rule-only after the grace window")
+		}
+	}
+}
+
+func TestWarmupWithoutGraceServesClaude(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	warmUp(t.Context(), svc, 0, 0)
+	if svc.RuleOnly() {
+		t.Error("rule-only without a grace window")
+	}
+	if mode := readinessMode(t, svc); mode != "claude" {
+		t.Errorf("/ready mode = %q, want claude", mode)
+	}
+}
+
+func TestStartupGateAnswersUntilOpen(t *testing.T) {
+	gate := &startupGate{}
+	srv := httptest.NewServer(gate)
+	t.Cleanup(srv.Close)
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Before setup finishes nothing reaches the half-built service.
+	for _, path := range []string{"/analyze", "/ready", "/stats"} {
+		if resp := get(path); resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+			t.Errorf("before open: %s status = %d, Retry-After %q; want 503 with Retry-After", path, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	if resp := get("/health"); resp.StatusCode != http.StatusOK {
+		t.Errorf("before open: /health status = %d, want 200", resp.StatusCode)
+	}
+
+	// Requests racing the open see either the gate or the service.
+	var served atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 50 {
+			resp, err := http.Get(srv.URL + "/analyze")
+			if err != nil {
+				t.Errorf("during open: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusTeapot {
+				t.Errorf("during open: status = %d", resp.StatusCode)
+			}
+		}
+	}()
+	gate.open(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	<-done
+
+	before := served.Load()
+	if resp := get("/analyze"); resp.StatusCode != http.StatusTeapot || served.Load() != before+1 {
+		t.Errorf("after open: status = %d, want the service's answer", resp.StatusCode)
+	}
+}
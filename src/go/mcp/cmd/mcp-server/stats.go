@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/slo"
+)
+
+// statsResponse is the body of GET /stats: the service counters plus the
+// server's own queues.
+type statsResponse struct {
+	claude.Stats
+	AsyncJobs JobStats   `json:"async_jobs"`
+	SLO       slo.Report `json:"slo"`
+}
+
+// statsSources gathers what /stats and /stats/stream report.
+type statsSources struct {
+	svc  *claude.ClaudeService
+	jobs *jobQueue
+	slo  *slo.Tracker
+}
+
+func (s statsSources) snapshot() statsResponse {
+	return statsResponse{Stats: s.svc.Stats(), AsyncJobs: s.jobs.stats(), SLO: s.slo.Report()}
+}
+
+// statsHandler serves GET /stats with a snapshot of the service counters.
+func statsHandler(src statsSources) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, src.snapshot())
+	}
+}
+
+// statsStreamHandler serves GET /stats/stream, a Server-Sent Events stream
+// that pushes a stats snapshot every interval and immediately whenever the
+// service changes mode. The stream ends when the client disconnects or done
+// is closed at shutdown.
+func statsStreamHandler(src statsSources, interval time.Duration, done <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		// The server write timeout applies to whole responses; lift it for
+		// this connection so the stream isn't cut off.
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			writeError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(event string) bool {
+			data, err := json.Marshal(src.snapshot())
+			if err != nil {
+				log.Printf("Encoding stats for stream failed: %v", err)
+				return false
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		modeChanged := src.svc.ModeChanges()
+		if !send("stats") {
+			return
+		}
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				if !send("stats") {
+					return
+				}
+			case <-modeChanged:
+				modeChanged = src.svc.ModeChanges()
+				if !send("mode") {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/slo"
+)
+
+func TestStatsStream(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.9, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	src := statsSources{
+		svc:  svc,
+		jobs: newJobQueue(cfg.AsyncMaxJobs, time.Second, cfg.AsyncRetention, nil),
+		slo:  slo.New(time.Second, 0.99, time.Hour),
+	}
+	done := make(chan struct{})
+	srv := httptest.NewServer(requireAdmin("secret", statsStreamHandler(src, 20*time.Millisecond, done)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET without token: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without token: status = %d, want 401", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	body := bufio.NewReader(resp.Body)
+	next := func() (string, statsResponse) {
+		t.Helper()
+		ev, err := readEvent(t, body)
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		var stats statsResponse
+		if err := json.Unmarshal([]byte(ev.data), &stats); err != nil {
+			t.Fatalf("decoding %s event %q: %v", ev.name, ev.data, err)
+		}
+		return ev.name, stats
+	}
+
+	// A snapshot on connecting, then one per interval.
+	for i := 0; i < 2; i++ {
+		if name, stats := next(); name != "stats" || stats.RuleOnly {
+			t.Errorf("update %d: event %q, rule_only %t; want a stats event", i, name, stats.RuleOnly)
+		}
+	}
+
+	// A mode change is pushed without waiting for the interval. Ticks may
+	// already be queued ahead of it.
+	svc.SetRuleOnly(true)
+	for {
+		name, stats := next()
+		if name == "mode" {
+			if !stats.RuleOnly {
+				t.Error("mode event does not report rule-only mode")
+			}
+			break
+		}
+	}
+
+	// Shutdown ends the stream.
+	close(done)
+	for {
+		if _, err := readEvent(t, body); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("stream ended with %v, want EOF", err)
+			}
+			break
+		}
+	}
+}
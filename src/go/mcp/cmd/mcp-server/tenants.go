@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// TenantConfig overrides the global settings for one tenant. Zero fields
+// fall back to the global value.
+type TenantConfig struct {
+	Model             string   `json:"model,omitempty"`
+	DecisionThreshold *float64 `json:"decision_threshold,omitempty"`
+	DecisionMargin    *float64 `json:"decision_margin,omitempty"`
+	PromptTemplate    string   `json:"prompt_template,omitempty"`
+	MaxBatchSize      int      `json:"max_batch_size,omitempty"`
+}
+
+// tenantSettings are the settings in effect for a tenant after falling
+// back to the global defaults, as reported by GET /whoami.
+type tenantSettings struct {
+	Tenant         string              `json:"tenant,omitempty"`
+	Overridden     bool                `json:"overridden"` // The tenant has its own configuration
+	Model          string              `json:"model"`
+	DecisionBand   claude.DecisionBand `json:"decision_band"`
+	PromptTemplate string              `json:"prompt_template"`
+	MaxBatchSize   int                 `json:"max_batch_size"`
+
+	// modelOverride is set when the tenant chose the model, which then
+	// bypasses canary routing.
+	modelOverride string
+}
+
+// tenantRegistry resolves the authenticated tenant of a request to its
+// settings. The per-tenant overrides are read from a JSON file mapping
+// tenant IDs to TenantConfig and can be reloaded at runtime.
+type tenantRegistry struct {
+	path      string
+	defaults  tenantSettings
+	templates []string
+
+	mu      sync.RWMutex
+	tenants map[string]TenantConfig
+}
+
+// newTenantRegistry loads the tenant overrides at path, if set, on top of
+// the global settings in cfg and svc.
+func newTenantRegistry(path string, cfg *Config, svc *claude.ClaudeService) (*tenantRegistry, error) {
+	t := &tenantRegistry{
+		path: path,
+		defaults: tenantSettings{
+			Model:          cfg.Model,
+			DecisionBand:   svc.DecisionBand(),
+			PromptTemplate: claude.DefaultPromptTemplate,
+			MaxBatchSize:   cfg.MaxBatchSize,
+		},
+		templates: svc.PromptTemplates(),
+		tenants:   make(map[string]TenantConfig),
+	}
+	if _, err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reload re-reads the tenant file, keeping the previous overrides if it is
+// invalid, and returns how many tenants it configures.
+func (t *tenantRegistry) reload() (int, error) {
+	if t.path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return 0, fmt.Errorf("reading tenant config: %w", err)
+	}
+	var tenants map[string]TenantConfig
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return 0, fmt.Errorf("parsing tenant config %s: %w", t.path, err)
+	}
+	for id, tc := range tenants {
+		if err := t.validate(tc); err != nil {
+			return 0, fmt.Errorf("tenant %q: %w", id, err)
+		}
+	}
+	t.mu.Lock()
+	t.tenants = tenants
+	t.mu.Unlock()
+	log.Printf("Loaded configuration for %d tenants from %s", len(tenants), t.path)
+	return len(tenants), nil
+}
+
+func (t *tenantRegistry) validate(tc TenantConfig) error {
+	band := t.apply(tc).DecisionBand
+	if err := claude.ValidateDecisionMargin(band.Threshold, band.Margin); err != nil {
+		return err
+	}
+	if tc.PromptTemplate != "" && !slices.Contains(t.templates, tc.PromptTemplate) {
+		return fmt.Errorf("%w %q", claude.ErrUnknownPromptTemplate, tc.PromptTemplate)
+	}
+	if tc.MaxBatchSize < 0 {
+		return errors.New("max_batch_size must not be negative")
+	}
+	return nil
+}
+
+// apply overlays tc on the global settings.
+func (t *tenantRegistry) apply(tc TenantConfig) tenantSettings {
+	s := t.defaults
+	if tc.Model != "" {
+		s.Model, s.modelOverride = tc.Model, tc.Model
+	}
+	if tc.DecisionThreshold != nil {
+		s.DecisionBand.Threshold = *tc.DecisionThreshold
+	}
+	if tc.DecisionMargin != nil {
+		s.DecisionBand.Margin = *tc.DecisionMargin
+	}
+	if tc.PromptTemplate != "" {
+		s.PromptTemplate = tc.PromptTemplate
+	}
+	if tc.MaxBatchSize > 0 {
+		s.MaxBatchSize = tc.MaxBatchSize
+	}
+	return s
+}
+
+// resolve returns the settings in effect for tenant.
+func (t *tenantRegistry) resolve(tenant string) tenantSettings {
+	t.mu.RLock()
+	tc, ok := t.tenants[tenant]
+	t.mu.RUnlock()
+	s := t.apply(tc)
+	s.Tenant, s.Overridden = tenant, ok
+	return s
+}
+
+// forRequest returns the settings for the tenant that signed r.
+func (t *tenantRegistry) forRequest(r *http.Request) tenantSettings {
+	return t.resolve(partnerFromContext(r.Context()))
+}
+
+// analyzeOptions returns the analysis options for a request under these
+// settings. An explicit X-Prompt-Template takes precedence over the
+// tenant's template. verbosity and language come from the request body,
+// when it has them; see requestLanguages.
+func (s tenantSettings) analyzeOptions(r *http.Request, verbosity, language string) claude.AnalyzeOptions {
+	band := s.DecisionBand
+	opts := claude.AnalyzeOptions{
+		PromptTemplate: r.Header.Get(promptTemplateHeader),
+		Verbosity:      claude.Verbosity(verbosity),
+		Languages:      requestLanguages(r, language),
+		Model:          s.modelOverride,
+		DecisionBand:   &band,
+	}
+	if opts.PromptTemplate == "" && s.Overridden {
+		opts.PromptTemplate = s.PromptTemplate
+	}
+	return opts
+}
+
+// whoamiHandler serves GET /whoami, reporting the authenticated tenant and
+// its effective settings.
+func whoamiHandler(tenants *tenantRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, tenants.forRequest(r))
+	}
+}
+
+// reloadHandler serves POST /admin/reload, re-reading the tenant
+// configuration and GeoIP databases without a restart. The databases are
+// reloaded even when the tenant configuration is invalid.
+func reloadHandler(tenants *tenantRegistry, geo *geoEnricher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		n, err := tenants.reload()
+		databases := geo.reload()
+		if err != nil {
+			log.Printf("Reloading tenant config failed: %v", err)
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		resp := map[string]int{"tenants": n}
+		if geo != nil {
+			resp["geoip_databases"] = databases
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+type partnerKey struct{}
+
+// withPartner records the authenticated partner ID in ctx.
+func withPartner(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, partnerKey{}, id)
+}
+
+// partnerFromContext returns the partner that signed the request, or "" when
+// signatures aren't required.
+func partnerFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(partnerKey{}).(string)
+	return id
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// asPartner authenticates each request to h as the partner named in its
+// X-Partner-ID header, as the signature check would.
+func asPartner(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(withPartner(r.Context(), r.Header.Get(partnerIDHeader))))
+	})
+}
+
+// writeTenants writes a tenant config file and returns its path.
+func writeTenants(t *testing.T, path, config string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("writing tenant config: %v", err)
+	}
+	return path
+}
+
+const tenantConfig = `{
+	"bank":  {"model": "claude-bank", "decision_threshold": 0.9},
+	"games": {"model": "claude-games", "decision_threshold": 0.5, "decision_margin": 0.1}
+}`
+
+func TestTenantsGetTheirOwnModelAndThreshold(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.8, "Consistent signals."))
+	svc := newTestService(t, stub, claude.WithDecisionMargin(0.7, 0))
+	cfg := testConfig()
+	tenants, err := newTenantRegistry(writeTenants(t, filepath.Join(t.TempDir(), "tenants.json"), tenantConfig), cfg, svc)
+	if err != nil {
+		t.Fatalf("newTenantRegistry: %v", err)
+	}
+	analyze := asPartner(analyzeHandler(svc, cfg, tenants, nil, nil, nil, nil, newErrorLog(cfg.LastErrors)))
+	whoami := asPartner(whoamiHandler(tenants))
+
+	for _, tc := range []struct {
+		tenant, model string
+		threshold     float64
+		outcome       claude.Outcome
+	}{
+		{"bank", "claude-bank", 0.9, claude.OutcomeNotLive},
+		{"games", "claude-games", 0.5, claude.OutcomeLive},
+		{"", claude.DefaultModel, 0.7, claude.OutcomeLive},        // Unauthenticated: the global defaults
+		{"unknown", claude.DefaultModel, 0.7, claude.OutcomeLive}, // No overrides of its own
+	} {
+		header := http.Header{partnerIDHeader: {tc.tenant}}
+		rec := post(analyze, "/analyze", analyzeBody, header)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("tenant %q: status = %d, body %s", tc.tenant, rec.Code, rec.Body)
+		}
+		var sent struct {
+			Model string `json:"model"`
+		}
+		if err := json.Unmarshal([]byte(stub.lastBody()), &sent); err != nil {
+			t.Fatalf("decoding Claude request: %v", err)
+		}
+		if sent.Model != tc.model {
+			t.Errorf("tenant %q: Claude model = %q, want %q", tc.tenant, sent.Model, tc.model)
+		}
+		if result := decodeResult(t, rec); result.Model != tc.model || result.Outcome != tc.outcome {
+			t.Errorf("tenant %q: result model %q, outcome %q; want %q, %q", tc.tenant, result.Model, result.Outcome, tc.model, tc.outcome)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.Header.Set(partnerIDHeader, tc.tenant)
+		rec = httptest.NewRecorder()
+		whoami.ServeHTTP(rec, req)
+		var settings tenantSettings
+		if err := json.Unmarshal(rec.Body.Bytes(), &settings); err != nil {
+			t.Fatalf("decoding /whoami %q: %v", rec.Body, err)
+		}
+		if settings.Model != tc.model || settings.DecisionBand.Threshold != tc.threshold {
+			t.Errorf("tenant %q: /whoami = %+v", tc.tenant, settings)
+		}
+		if overridden := tc.tenant == "bank" || tc.tenant == "games"; settings.Overridden != overridden {
+			t.Errorf("tenant %q: overridden = %t, want %t", tc.tenant, settings.Overridden, overridden)
+		}
+	}
+}
+
+func TestReloadKeepsTenantsOnErrorAndStillReloadsGeoIP(t *testing.T) {
+	stub := newClaudeStub(t, decision(true, 0.8, "Consistent signals."))
+	svc := newTestService(t, stub)
+	cfg := testConfig()
+	path := writeTenants(t, filepath.Join(t.TempDir(), "tenants.json"), tenantConfig)
+	tenants, err := newTenantRegistry(path, cfg, svc)
+	if err != nil {
+		t.Fatalf("newTenantRegistry: %v", err)
+	}
+	geo := newGeoEnricher([]string{filepath.Join(t.TempDir(), "missing.mmdb")}, "", nil, metrics.NewRegistry())
+	h := reloadHandler(tenants, geo)
+
+	writeTenants(t, path, `{"bank": {"model": "claude-bank-2"}, "games": {"decision_threshold": 2}}`)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	rec := post(h, "/admin/reload", "", nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid tenant config: status = %d, want 422", rec.Code)
+	}
+	if got := tenants.resolve("bank").Model; got != "claude-bank" {
+		t.Errorf("bank model after a failed reload = %q, want the previous claude-bank", got)
+	}
+	if !strings.Contains(logs.String(), "GeoIP database") {
+		t.Errorf("GeoIP databases not reloaded after the tenant config failed: %s", logs.String())
+	}
+
+	writeTenants(t, path, `{"bank": {"model": "claude-bank-2"}}`)
+	rec = post(h, "/admin/reload", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tenants":1`) {
+		t.Errorf("valid tenant config: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := tenants.resolve("bank").Model; got != "claude-bank-2" {
+		t.Errorf("bank model after reload = %q, want claude-bank-2", got)
+	}
+	if tenants.resolve("games").Overridden {
+		t.Error("games still overridden after it was removed from the config")
+	}
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// Cache is a concurrency-safe in-memory cache whose entries expire after a
+// TTL. Each key's TTL is jittered by a deterministic per-key offset so that
+// entries written together do not all expire together.
+type Cache[V any] struct {
+	ttl    time.Duration
+	jitter float64
+	now    func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]entry[V]
+	sweepSize int
+}
+
+// Option configures optional Cache behaviour.
+type Option[V any] func(*Cache[V])
+
+// WithClock replaces time.Now, letting tests control expiry.
+func WithClock[V any](now func() time.Time) Option[V] {
+	return func(c *Cache[V]) { c.now = now }
+}
+
+// New creates a cache with the given base TTL. jitter is the maximum
+// fraction (0 to 1) by which an entry's TTL may deviate from ttl in either
+// direction; 0.1 spreads expirations over ttl ±10%.
+func New[V any](ttl time.Duration, jitter float64, opts ...Option[V]) *Cache[V] {
+	c := &Cache[V]{
+		ttl:       ttl,
+		jitter:    jitter,
+		now:       time.Now,
+		entries:   make(map[string]entry[V]),
+		sweepSize: 64,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// TTL returns the jittered TTL used for key. The same key always gets the
+// same TTL.
+func (c *Cache[V]) TTL(key string) time.Duration {
+	if c.jitter <= 0 {
+		return c.ttl
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV's high bits barely differ between keys that differ only in
+	// their last bytes, so mix them in (the splitmix64 finalizer) before
+	// mapping the hash onto [-1, 1) and scaling it by the jitter fraction.
+	x := h.Sum64()
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	unit := float64(x>>11)/float64(1<<53)*2 - 1
+	return c.ttl + time.Duration(unit*c.jitter*float64(c.ttl))
+}
+
+// Get returns the cached value for key if present and not expired.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key for the key's jittered TTL.
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(c.TTL(key))}
+
+	// Expired entries are otherwise only removed when read, so sweep them
+	// whenever the map has doubled since the previous sweep.
+	if len(c.entries) >= c.sweepSize {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepSize = max(64, 2*len(c.entries))
+	}
+}
+
+// Len returns the number of entries currently held, including any that have
+// expired but not yet been removed.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for WithClock.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestTTLJitterRange(t *testing.T) {
+	const ttl, jitter = time.Minute, 0.1
+	c := New[int](ttl, jitter)
+	lo, hi := ttl, ttl
+	for i := range 1000 {
+		key := "key-" + strconv.Itoa(i)
+		d := c.TTL(key)
+		if d < ttl-6*time.Second || d >= ttl+6*time.Second {
+			t.Fatalf("TTL(%q) = %s, outside %s ±10%%", key, d, ttl)
+		}
+		if d != c.TTL(key) {
+			t.Fatalf("TTL(%q) is not stable", key)
+		}
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	// The offsets should actually spread across the range.
+	if lo > ttl-5*time.Second || hi < ttl+5*time.Second {
+		t.Errorf("TTLs spread over [%s, %s], want most of %s ±6s", lo, hi, ttl)
+	}
+	if d := New[int](ttl, 0).TTL("key"); d != ttl {
+		t.Errorf("TTL without jitter = %s, want %s", d, ttl)
+	}
+}
+
+func TestEntryExpiresAtItsJitteredTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	c := New(time.Minute, 0.5, WithClock[string](clock.Now))
+	c.Set("key", "value")
+	ttl := c.TTL("key")
+
+	clock.now = clock.now.Add(ttl - time.Nanosecond)
+	if v, ok := c.Get("key"); !ok || v != "value" {
+		t.Fatalf("Get just before expiry = %q, %t", v, ok)
+	}
+	clock.now = clock.now.Add(time.Nanosecond)
+	if _, ok := c.Get("key"); ok {
+		t.Error("entry still served at its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len = %d after the expired entry was read, want 0", c.Len())
+	}
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type call[V any] struct {
+	done    chan struct{} // Closed once val and err are set
+	val     V
+	err     error
+	dups    int
+	waiters int                // Callers still waiting, guarded by Group.mu
+	cancel  context.CancelFunc // Cancels fn's context
+}
+
+// Group coalesces concurrent calls that share a key so only one of them runs
+// the underlying function; the others wait for and share its result.
+type Group[V any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[V]
+}
+
+// Do runs fn once for all concurrent callers with the same key. fn runs on
+// its own goroutine with a context that keeps the first caller's values
+// but not its cancellation: every caller, including the one that started
+// it, stops waiting with ctx's error when its ctx is done while fn carries
+// on for the rest. Once no caller is left waiting fn's context is
+// cancelled, and a later caller starts a new call.
+// shared reports whether the result was delivered to more than one caller.
+func (g *Group[V]) Do(ctx context.Context, key string, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[V])
+	}
+	c, ok := g.calls[key]
+	if ok {
+		c.dups++
+		c.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		// The call left the map before done was closed, so dups is final.
+		return c.val, c.err, c.dups > 0
+	case <-ctx.Done():
+		g.mu.Lock()
+		if c.waiters--; c.waiters == 0 {
+			g.forget(key, c)
+			c.cancel()
+		}
+		g.mu.Unlock()
+		var zero V
+		return zero, ctx.Err(), false
+	}
+}
+
+// run calls fn and publishes its result. A panic in fn becomes its error
+// rather than crashing the process from a goroutine no caller owns.
+func (g *Group[V]) run(ctx context.Context, key string, c *call[V], fn func(context.Context) (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("cache: coalesced call panicked: %v", r)
+		}
+		g.mu.Lock()
+		g.forget(key, c)
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	c.val, c.err = fn(ctx)
+}
+
+// forget removes c from the map unless an abandoned c was already replaced
+// by a newer call for key. g.mu must be held.
+func (g *Group[V]) forget(key string, c *call[V]) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoCoalescesConcurrentCalls(t *testing.T) {
+	var g Group[int]
+	var runs atomic.Int32
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		runs.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make(chan int, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, _ := g.Do(context.Background(), "key", fn)
+			if err != nil {
+				t.Errorf("Do: %v", err)
+			}
+			results <- v
+		}()
+	}
+	// Let every caller join the flight before it completes.
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		g.mu.Lock()
+		c := g.calls["key"]
+		joined := c != nil && c.dups == callers-1
+		g.mu.Unlock()
+		if joined {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+	for v := range results {
+		if v != 42 {
+			t.Errorf("result = %d, want 42", v)
+		}
+	}
+	if n := runs.Load(); n != 1 {
+		t.Errorf("fn ran %d times, want 1", n)
+	}
+}
+
+func TestDoWaiterStopsAtItsOwnContext(t *testing.T) {
+	var g Group[int]
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		<-release
+		return 7, nil
+	}
+
+	// The caller that starts the flight gives up; the flight carries on
+	// for a caller that is still waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error, 1)
+	go func() {
+		_, err, _ := g.Do(ctx, "key", fn)
+		started <- err
+	}()
+	for {
+		g.mu.Lock()
+		_, ok := g.calls["key"]
+		g.mu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waited := make(chan int, 1)
+	go func() {
+		v, err, shared := g.Do(context.Background(), "key", fn)
+		if err != nil || !shared {
+			t.Errorf("waiter: err = %v, shared = %t", err, shared)
+		}
+		waited <- v
+	}()
+	// Let the waiter join the flight before it can finish.
+	for {
+		g.mu.Lock()
+		dups := g.calls["key"].dups
+		g.mu.Unlock()
+		if dups == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-started; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller error = %v, want Canceled", err)
+	}
+	close(release)
+	if v := <-waited; v != 7 {
+		t.Errorf("waiter result = %d, want 7", v)
+	}
+}
+
+func TestDoRecoversPanic(t *testing.T) {
+	var g Group[int]
+	_, err, _ := g.Do(context.Background(), "key", func(context.Context) (int, error) { panic("boom") })
+	if err == nil {
+		t.Fatal("panic in fn was not reported as an error")
+	}
+	if v, err, _ := g.Do(context.Background(), "key", func(context.Context) (int, error) { return 1, nil }); err != nil || v != 1 {
+		t.Errorf("Do after a panic = %d, %v", v, err)
+	}
+}
+
+func TestDoCancelsOnceNoCallerWaits(t *testing.T) {
+	var g Group[int]
+	type ctxKey struct{}
+	started, cancelled := make(chan struct{}), make(chan error, 1)
+	fn := func(ctx context.Context) (int, error) {
+		if ctx.Value(ctxKey{}) != "first" {
+			t.Error("fn's context lacks the first caller's values")
+		}
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return 0, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "first"))
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err, _ := g.Do(first, "key", fn)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err, _ := g.Do(second, "key", fn)
+		errs <- err
+	}()
+	for {
+		g.mu.Lock()
+		waiters := g.calls["key"].waiters
+		g.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// fn carries on while a caller waits, and is cancelled with the last.
+	cancelFirst()
+	<-errs
+	select {
+	case err := <-cancelled:
+		t.Fatalf("fn cancelled (%v) with a caller still waiting", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancelSecond()
+	<-errs
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("fn context error = %v, want Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fn's context not cancelled once no caller waits")
+	}
+
+	// The abandoned call is forgotten: the next caller starts afresh even
+	// before it returns.
+	if v, err, _ := g.Do(context.Background(), "key", func(context.Context) (int, error) { return 3, nil }); err != nil || v != 3 {
+		t.Errorf("Do after the call was abandoned = %d, %v; want a new call", v, err)
+	}
+}
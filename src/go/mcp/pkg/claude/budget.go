@@ -0,0 +1,167 @@
+package claude
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// SpendMode describes how the spend guard is limiting Claude usage.
+type SpendMode string
+
+const (
+	SpendNormal     SpendMode = "normal"     // Under the downgrade threshold
+	SpendDowngraded SpendMode = "downgraded" // Approaching the cap: using the cheapest model
+	SpendRuleOnly   SpendMode = "rule_only"  // Cap reached: no Claude calls until the period resets
+)
+
+// SpendPeriod is the window over which spend is capped.
+type SpendPeriod string
+
+const (
+	SpendDaily   SpendPeriod = "daily"
+	SpendMonthly SpendPeriod = "monthly"
+)
+
+// SpendCap configures the spend guardrail. Spend is tracked from the
+// estimated cost of each Claude call and resets at the start of each UTC
+// day or month.
+type SpendCap struct {
+	CapUSD float64
+	// DowngradeAt is the fraction of CapUSD (e.g. 0.8) beyond which new
+	// requests use the cheapest model.
+	DowngradeAt float64
+	Period      SpendPeriod
+	// DowngradeModel is used once DowngradeAt is crossed. When empty the
+	// cheapest priced model in the catalog is chosen, or among the
+	// built-in models until the catalog has been loaded.
+	DowngradeModel string
+}
+
+// spendGuard tracks spend against a SpendCap within the current period.
+type spendGuard struct {
+	cfg SpendCap
+	now func() time.Time
+
+	mu          sync.Mutex
+	periodStart time.Time
+	spent       float64
+	mode        SpendMode
+
+	// onChange, if set, is called whenever mode changes.
+	onChange func()
+}
+
+func newSpendGuard(cfg SpendCap, now func() time.Time) *spendGuard {
+	g := &spendGuard{cfg: cfg, now: now, mode: SpendNormal}
+	g.periodStart = g.startOf(now())
+	return g
+}
+
+func (g *spendGuard) startOf(t time.Time) time.Time {
+	t = t.UTC()
+	if g.cfg.Period == SpendMonthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// rollover resets spend when a new period has begun. Callers hold g.mu.
+func (g *spendGuard) rollover() {
+	start := g.startOf(g.now())
+	if start.After(g.periodStart) {
+		if g.mode != SpendNormal {
+			log.Printf("ClaudeService: New %s spend period, leaving %s mode", g.cfg.Period, g.mode)
+		}
+		changed := g.mode != SpendNormal
+		g.periodStart = start
+		g.spent = 0
+		g.mode = SpendNormal
+		if changed {
+			g.changed()
+		}
+	}
+}
+
+// changed reports a mode change. Callers hold g.mu.
+func (g *spendGuard) changed() {
+	if g.onChange != nil {
+		g.onChange()
+	}
+}
+
+// current returns the mode new requests should run in.
+func (g *spendGuard) current() SpendMode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollover()
+	return g.mode
+}
+
+// record adds the cost of a Claude call and updates the mode.
+func (g *spendGuard) record(costUSD float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollover()
+	g.spent += costUSD
+
+	next := SpendNormal
+	switch {
+	case g.spent >= g.cfg.CapUSD:
+		next = SpendRuleOnly
+	case g.spent >= g.cfg.CapUSD*g.cfg.DowngradeAt:
+		next = SpendDowngraded
+	}
+	if next == g.mode {
+		return
+	}
+	g.mode = next
+	g.changed()
+	switch next {
+	case SpendRuleOnly:
+		log.Printf("ALERT: ClaudeService: %s spend $%.4f reached the cap of $%.4f; switching to rule-only mode until the period resets", g.cfg.Period, g.spent, g.cfg.CapUSD)
+	case SpendDowngraded:
+		log.Printf("ClaudeService: Warning: %s spend $%.4f crossed %.0f%% of the $%.4f cap; downgrading to the cheapest model", g.cfg.Period, g.spent, g.cfg.DowngradeAt*100, g.cfg.CapUSD)
+	}
+}
+
+// SpendStatus is the spend guard's state as reported in Stats.
+type SpendStatus struct {
+	Mode        SpendMode   `json:"mode"`
+	Period      SpendPeriod `json:"period"`
+	PeriodStart time.Time   `json:"period_start"`
+	SpentUSD    float64     `json:"spent_usd"`
+	CapUSD      float64     `json:"cap_usd"`
+}
+
+func (g *spendGuard) status() *SpendStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollover()
+	return &SpendStatus{
+		Mode:        g.mode,
+		Period:      g.cfg.Period,
+		PeriodStart: g.periodStart,
+		SpentUSD:    g.spent,
+		CapUSD:      g.cfg.CapUSD,
+	}
+}
+
+// WithSpendCap enables the spend guardrail. A non-positive CapUSD disables it.
+func WithSpendCap(cfg SpendCap) Option {
+	return func(s *ClaudeService) {
+		if cfg.CapUSD <= 0 {
+			s.spend = nil
+			return
+		}
+		s.spend = newSpendGuard(cfg, time.Now)
+	}
+}
+
+// downgradeModel returns the model to use while downgraded.
+func (s *ClaudeService) downgradeModel() (string, bool) {
+	if s.spend.cfg.DowngradeModel != "" {
+		return s.spend.cfg.DowngradeModel, true
+	}
+	return s.catalog.cheapest()
+}
@@ -0,0 +1,96 @@
+package claude
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSpendCapDowngradesThenServesRules(t *testing.T) {
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Consistent signals."))
+	})
+	// Each stub reply uses 100 input and 20 output tokens: $0.0006 on
+	// Sonnet 4 and $0.00016 on Haiku 3.5.
+	const cheap = "claude-3-5-haiku-20241022"
+	s := newStubService(t, stub, WithSpendCap(SpendCap{CapUSD: 0.0007, DowngradeAt: 0.5, Period: SpendDaily, DowngradeModel: cheap}))
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.spend.now = func() time.Time { return now }
+	s.spend.periodStart = s.spend.startOf(now)
+
+	analyze := func() *LivenessAnalysisResult {
+		t.Helper()
+		result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+		if err != nil {
+			t.Fatalf("AnalyzeDataForLiveness: %v", err)
+		}
+		return result
+	}
+	lastModel := func() string {
+		t.Helper()
+		var req messagesRequest
+		if err := json.Unmarshal([]byte(stub.lastBody()), &req); err != nil {
+			t.Fatalf("decoding request: %v", err)
+		}
+		return req.Model
+	}
+
+	analyze()
+	if got := lastModel(); got != DefaultModel {
+		t.Errorf("first call used %s, want %s", got, DefaultModel)
+	}
+	if st := s.Stats().Spend; st == nil || st.Mode != SpendDowngraded {
+		t.Fatalf("after crossing the downgrade threshold: spend = %+v, want downgraded", st)
+	}
+
+	analyze()
+	if got := lastModel(); got != cheap {
+		t.Errorf("downgraded call used %s, want %s", got, cheap)
+	}
+	if !s.RuleOnly() {
+		t.Fatal("service not rule-only after the cap was crossed")
+	}
+	stats := s.Stats()
+	if stats.Spend.Mode != SpendRuleOnly || stats.Spend.SpentUSD < stats.Spend.CapUSD || !stats.RuleOnly {
+		t.Errorf("after crossing the cap: stats = %+v, spend = %+v", stats, stats.Spend)
+	}
+
+	if result := analyze(); !result.RuleOnly {
+		t.Errorf("call over the cap was not rule-only: %+v", result)
+	}
+	if n := stub.calls.Load(); n != 2 {
+		t.Errorf("Claude calls = %d; none should be made over the cap", n)
+	}
+
+	// The next UTC day starts a new period.
+	now = now.Add(12 * time.Hour)
+	if st := s.Stats().Spend; st.Mode != SpendNormal || st.SpentUSD != 0 {
+		t.Errorf("new period: spend = %+v, want normal with nothing spent", st)
+	}
+	analyze()
+	if got := lastModel(); got != DefaultModel {
+		t.Errorf("first call of the new period used %s, want %s", got, DefaultModel)
+	}
+}
+
+func TestSpendGuardMonthlyPeriod(t *testing.T) {
+	now := time.Date(2025, 6, 30, 23, 0, 0, 0, time.UTC)
+	g := newSpendGuard(SpendCap{CapUSD: 10, DowngradeAt: 0.8, Period: SpendMonthly}, func() time.Time { return now })
+	g.record(8)
+	if got := g.current(); got != SpendDowngraded {
+		t.Errorf("mode at 80%% of the cap = %s, want downgraded", got)
+	}
+	g.record(2)
+	if got := g.current(); got != SpendRuleOnly {
+		t.Errorf("mode at the cap = %s, want rule_only", got)
+	}
+	now = now.Add(30 * time.Minute) // Still June
+	if got := g.current(); got != SpendRuleOnly {
+		t.Errorf("mode later the same month = %s, want rule_only", got)
+	}
+	now = now.Add(time.Hour) // July
+	if got := g.current(); got != SpendNormal {
+		t.Errorf("mode in the next month = %s, want normal", got)
+	}
+}
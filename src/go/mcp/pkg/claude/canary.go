@@ -0,0 +1,96 @@
+package claude
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// WithCanary routes percent (0-100) of requests to model instead of the
+// stable model. Routing is by a hash of the prompt, so identical inputs
+// always reach the same model. The percentage can be changed later with
+// SetCanaryPercent.
+func WithCanary(model string, percent float64) Option {
+	return func(s *ClaudeService) {
+		s.canaryModel = model
+		s.canaryPercent = percent
+	}
+}
+
+// ValidateCanaryPercent reports whether percent is usable as a canary
+// percentage.
+func ValidateCanaryPercent(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("canary percent must be between 0 and 100, got %v", percent)
+	}
+	return nil
+}
+
+// CanaryStatus describes the canary routing in effect.
+type CanaryStatus struct {
+	Model   string  `json:"model"`
+	Percent float64 `json:"percent"`
+}
+
+// Canary returns the canary routing in effect.
+func (s *ClaudeService) Canary() CanaryStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return CanaryStatus{Model: s.canaryModel, Percent: s.canaryPercent}
+}
+
+// SetCanaryPercent changes the share of requests routed to the canary
+// model. It fails when no canary model is configured.
+func (s *ClaudeService) SetCanaryPercent(percent float64) error {
+	if err := ValidateCanaryPercent(percent); err != nil {
+		return err
+	}
+	if s.canaryModel == "" {
+		return fmt.Errorf("no canary model configured")
+	}
+	s.mu.Lock()
+	s.canaryPercent = percent
+	s.mu.Unlock()
+	return nil
+}
+
+// routeCanary reports whether the request with the given prompt goes to
+// the canary model. The prompt hash maps each request to one of 10000
+// slots, of which the first percent are the canary's.
+func (s *ClaudeService) routeCanary(prompt string) bool {
+	if s.canaryModel == "" {
+		return false
+	}
+	s.mu.Lock()
+	percent := s.canaryPercent
+	s.mu.Unlock()
+	return float64(promptSlot("", prompt)) < percent*100
+}
+
+// promptSlot maps a prompt to one of 10000 slots by its hash, salted so
+// that independent samplings of the same traffic don't overlap.
+func promptSlot(salt, prompt string) uint64 {
+	h := sha256.New()
+	if salt != "" {
+		h.Write([]byte(salt + "\x00"))
+	}
+	h.Write([]byte(prompt))
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8]) % 10000
+}
+
+// countOutcome tallies a served decision's outcome under the model that
+// made it, so the canary's outcome distribution can be compared with the
+// stable model's.
+func (s *ClaudeService) countOutcome(result *LivenessAnalysisResult) {
+	if result.Model == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := s.modelOutcomes[result.Model]
+	if counts == nil {
+		counts = make(map[Outcome]int64)
+		s.modelOutcomes[result.Model] = counts
+	}
+	counts[result.Outcome]++
+}
@@ -0,0 +1,104 @@
+package claude
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+const canaryTestModel = "claude-canary-test"
+
+// canaryInput returns the ith of a set of distinct inputs.
+func canaryInput(i int) AnalyzeDataForLivenessInput {
+	input := testInput()
+	input.SessionData = map[string]interface{}{"session_id": fmt.Sprintf("s%d", i)}
+	return input
+}
+
+func TestCanarySplit(t *testing.T) {
+	var canaryCalls atomic.Int64
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		if req.Model == canaryTestModel {
+			canaryCalls.Add(1)
+		}
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Consistent signals."))
+	})
+	s := newStubService(t, stub, WithCanary(canaryTestModel, 20))
+
+	const n = 1000
+	served := make(map[int]string, n)
+	canary := 0
+	for i := range n {
+		result, err := s.AnalyzeDataForLiveness(t.Context(), canaryInput(i))
+		if err != nil {
+			t.Fatalf("AnalyzeDataForLiveness: %v", err)
+		}
+		served[i] = result.Model
+		if result.Model == canaryTestModel {
+			canary++
+		} else if result.Model != DefaultModel {
+			t.Fatalf("served model = %q, want the stable or canary model", result.Model)
+		}
+	}
+	if canary < 150 || canary > 250 {
+		t.Errorf("canary served %d of %d requests, want about 20%%", canary, n)
+	}
+	if got := canaryCalls.Load(); got != int64(canary) {
+		t.Errorf("recorded canary model on %d results, but %d Claude calls used it", canary, got)
+	}
+	outcomes := s.Stats().ModelOutcomes
+	if got := outcomes[canaryTestModel][OutcomeLive]; got != int64(canary) {
+		t.Errorf("canary live outcomes = %d, want %d", got, canary)
+	}
+	if got := outcomes[DefaultModel][OutcomeLive]; got != int64(n-canary) {
+		t.Errorf("stable live outcomes = %d, want %d", got, n-canary)
+	}
+
+	// Routing is deterministic: the same input reaches the same model.
+	for i := range 50 {
+		result, err := s.AnalyzeDataForLiveness(t.Context(), canaryInput(i))
+		if err != nil {
+			t.Fatalf("AnalyzeDataForLiveness: %v", err)
+		}
+		if result.Model != served[i] {
+			t.Errorf("input %d served by %q, then by %q", i, served[i], result.Model)
+		}
+	}
+}
+
+func TestSetCanaryPercent(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	s := newStubService(t, stub, WithCanary(canaryTestModel, 0))
+
+	for _, tc := range []struct {
+		percent float64
+		want    string
+	}{
+		{0, DefaultModel},
+		{100, canaryTestModel},
+	} {
+		if err := s.SetCanaryPercent(tc.percent); err != nil {
+			t.Fatalf("SetCanaryPercent(%v): %v", tc.percent, err)
+		}
+		for i := range 20 {
+			result, err := s.AnalyzeDataForLiveness(t.Context(), canaryInput(i))
+			if err != nil {
+				t.Fatalf("AnalyzeDataForLiveness: %v", err)
+			}
+			if result.Model != tc.want {
+				t.Fatalf("at %v%%: served model = %q, want %q", tc.percent, result.Model, tc.want)
+			}
+		}
+	}
+	if got := s.Canary(); got.Percent != 100 || got.Model != canaryTestModel {
+		t.Errorf("Canary() = %+v", got)
+	}
+
+	if err := s.SetCanaryPercent(101); err == nil {
+		t.Error("SetCanaryPercent(101) succeeded")
+	}
+	if err := newStubService(t, stub).SetCanaryPercent(10); err == nil {
+		t.Error("SetCanaryPercent without a canary model succeeded")
+	}
+}
@@ -3,94 +3,813 @@ package claude
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"maps"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/cache"
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// DefaultModel is the Claude model used unless WithModel selects another.
+const DefaultModel = "claude-sonnet-4-20250514"
+
+const (
+	defaultBaseURL   = "https://api.anthropic.com"
+	defaultMaxTokens = 1024
 )
 
+// DefaultCategories are the category tags Claude may attach to a decision
+// unless WithCategories configures a different set.
+var DefaultCategories = []string{"bot", "replay", "device-mismatch"}
+
+var (
+	// ErrNoData is returned when none of the input maps carry any data.
+	ErrNoData = errors.New("no data provided for liveness analysis")
+	// ErrInvalidResponse is returned when Claude's reply cannot be parsed into a decision.
+	ErrInvalidResponse = errors.New("invalid response from Claude")
+	// ErrAmbiguousResponse is returned when several blocks of Claude's
+	// reply hold conflicting decisions; see AmbiguousResponseError.
+	ErrAmbiguousResponse = errors.New("ambiguous response from Claude")
+	// ErrStandbyMiss is returned in standby mode when no cached or stored
+	// decision exists for the input.
+	ErrStandbyMiss = errors.New("standby: no cached decision")
+)
+
+// ResultStore persists decisions so they can be retrieved later by the hash
+// of the input they were computed from.
+type ResultStore interface {
+	Save(ctx context.Context, inputHash string, result *LivenessAnalysisResult) error
+	Lookup(ctx context.Context, inputHash string) (result *LivenessAnalysisResult, found bool, err error)
+}
+
 // ClaudeService provides methods to interact with the Anthropic Claude API.
 type ClaudeService struct {
-	apiKey string
-	// Potentially other configurations like baseURL, HTTP client, etc.
+	apiKey    string
+	baseURL   string
+	model     string
+	maxTokens int
+
+	maxNestingDepth int
+	httpClient      *http.Client
+	// maxImages and maxImageBytes bound the images attached to a request.
+	maxImages     int
+	maxImageBytes int
+	// nestedJSONKeys lists technical_data keys whose string-encoded JSON
+	// values are decoded, up to nestedJSONDepth layers.
+	nestedJSONKeys  []string
+	nestedJSONDepth int
+	// requestTimeout bounds each Claude call; modelTimeouts overrides it
+	// for matching models.
+	requestTimeout time.Duration
+	modelTimeouts  map[string]time.Duration
+	// analysisTimeout bounds a whole analysis including its retries.
+	analysisTimeout time.Duration
+
+	// outboundAllowlist, when non-nil, is the exhaustive set of
+	// "section.key" names that may be included in the Claude prompt.
+	outboundAllowlist map[string]struct{}
+
+	// categories is the ordered set of tags Claude may return;
+	// allowedCategories indexes it for validation.
+	categories        []string
+	allowedCategories map[string]struct{}
+
+	// cache, when non-nil, holds recent decisions keyed by the hash of the
+	// outbound request; flight coalesces concurrent misses for one key.
+	cache  *cache.Cache[*LivenessAnalysisResult]
+	flight cache.Group[*LivenessAnalysisResult]
+
+	// store, when non-nil, records every fresh decision.
+	store ResultStore
+	// standby disables Claude calls entirely; only cached or stored
+	// decisions are served.
+	standby bool
+	// ruleOnly serves decisions from the local rules instead of Claude,
+	// e.g. while the Claude connection is still warming up.
+	ruleOnly atomic.Bool
+	// rejectEmptyReasoning fails decisions that come back without a
+	// reasoning instead of synthesizing one.
+	rejectEmptyReasoning bool
+	// rejectUnknownCategories fails decisions tagged with a category outside
+	// the configured set instead of dropping the tag.
+	rejectUnknownCategories bool
+	// rejectExtraFields fails decisions carrying fields beyond the decision
+	// schema instead of returning them in Extra.
+	rejectExtraFields bool
+	// decisionThreshold and decisionMargin classify confidences into
+	// live, not_live and uncertain outcomes.
+	decisionThreshold float64
+	decisionMargin    float64
+	// streaming calls the streaming Messages API; streamFallback retries a
+	// stream cut short by an error event once without streaming.
+	streaming      bool
+	streamFallback bool
+	// parseRetries is how many times an unparseable decision is re-requested
+	// with parseRetryInstruction before failing.
+	parseRetries int
+	// includeRuleScore adds the local rule evaluation to every result.
+	includeRuleScore bool
+	// riskMapping derives each result's RiskScore from its confidence.
+	riskMapping RiskMapping
+	// sessionLimit, when non-nil, caps analyses per session.
+	sessionLimit *sessionLimiter
+	// overrides, when non-nil, force decisions for listed sessions.
+	overrides *overrides
+	// hysteresis, when non-nil, smooths outcomes per session.
+	hysteresis *hysteresis
+
+	// languages are the reasoning languages requests may ask for;
+	// defaultLanguage is used when they ask for none of them.
+	languages       []string
+	defaultLanguage string
+	// verbosity is the reasoning detail used when a request doesn't
+	// choose one.
+	verbosity Verbosity
+
+	// promptTemplates maps template names to analysis instructions.
+	promptTemplates map[string]string
+	parsedTemplates map[string]*promptTemplate
+	// missingKeyPolicy decides how templates render missing input keys.
+	missingKeyPolicy MissingKeyPolicy
+
+	// policyVersion hashes the decision policy; it is computed once all
+	// options have been applied. cacheSalt allows manual cache busting.
+	policyVersion string
+	cacheSalt     string
+
+	// spend, when non-nil, caps Claude spend per period.
+	spend *spendGuard
+
+	// modeChanged is closed and replaced whenever rule-only or spend mode
+	// changes; see ModeChanges.
+	modeMu      sync.Mutex
+	modeChanged chan struct{}
+
+	catalog       modelCatalog
+	retryPolicies map[ErrorClass]BackoffPolicy
+
+	registry *metrics.Registry
+	metrics  *serviceMetrics
+
+	outboundKeysDropped   atomic.Int64
+	outboundImagesDropped atomic.Int64
+	cacheHits             atomic.Int64
+	cacheMisses           atomic.Int64
+	coalesced             atomic.Int64
+
+	mu             sync.Mutex
+	categoryCounts map[string]int64
+	modelOutcomes  map[string]map[Outcome]int64
+	costUSD        float64
+	// canaryModel receives canaryPercent of requests; see WithCanary.
+	// canaryPercent is guarded by mu so it can change at runtime.
+	canaryModel   string
+	canaryPercent float64
+	// shadow, when non-nil, evaluates a sample of requests against a
+	// candidate model; see WithShadow.
+	shadow *shadow
+	// hedging, when non-nil, resends slow Claude calls; see WithHedging.
+	hedging *hedging
+}
+
+// Option configures optional ClaudeService behaviour.
+type Option func(*ClaudeService)
+
+// WithBaseURL overrides the Anthropic API base URL.
+func WithBaseURL(baseURL string) Option {
+	return func(s *ClaudeService) { s.baseURL = baseURL }
+}
+
+// WithModel sets the Claude model used for analysis.
+func WithModel(model string) Option {
+	return func(s *ClaudeService) { s.model = model }
+}
+
+// WithHTTPClient sets the HTTP client used for Claude API calls.
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *ClaudeService) { s.httpClient = c }
+}
+
+// WithOutboundAllowlist restricts the input sent to Claude to the given keys,
+// written as "section.key" (e.g. "technical_data.captcha_solved"). Every other
+// key is dropped before the prompt is built. Images are sent only when the
+// list also holds the entry "images". An empty list disables the
+// restriction.
+func WithOutboundAllowlist(keys []string) Option {
+	return func(s *ClaudeService) {
+		if len(keys) == 0 {
+			s.outboundAllowlist = nil
+			return
+		}
+		s.outboundAllowlist = make(map[string]struct{}, len(keys))
+		for _, k := range keys {
+			s.outboundAllowlist[k] = struct{}{}
+		}
+	}
+}
+
+// WithCategories sets the category tags Claude may attach to a decision.
+// Tags are matched case-insensitively; anything else Claude returns is dropped.
+func WithCategories(categories []string) Option {
+	return func(s *ClaudeService) { s.setCategories(categories) }
+}
+
+func (s *ClaudeService) setCategories(categories []string) {
+	s.categories = nil
+	s.allowedCategories = make(map[string]struct{}, len(categories))
+	for _, c := range categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if _, dup := s.allowedCategories[c]; c == "" || dup {
+			continue
+		}
+		s.categories = append(s.categories, c)
+		s.allowedCategories[c] = struct{}{}
+	}
+}
+
+// WithCache enables caching of decisions for ttl, with each entry's TTL
+// jittered by up to ±jitter (a fraction of ttl) to spread out expirations.
+// A ttl of zero disables caching.
+func WithCache(ttl time.Duration, jitter float64) Option {
+	return func(s *ClaudeService) {
+		if ttl <= 0 {
+			s.cache = nil
+			return
+		}
+		s.cache = cache.New[*LivenessAnalysisResult](ttl, jitter)
+	}
+}
+
+// WithStore records every decision in store and lets standby mode serve
+// decisions from it.
+func WithStore(store ResultStore) Option {
+	return func(s *ClaudeService) { s.store = store }
+}
+
+// WithStandby enables standby mode, in which no Claude calls are made and
+// only decisions found in the cache or store are returned. Inputs without one
+// fail with ErrStandbyMiss.
+func WithStandby(standby bool) Option {
+	return func(s *ClaudeService) { s.standby = standby }
+}
+
+// WithRejectUnknownCategories makes a Claude decision carrying a category tag
+// outside the configured set fail with ErrInvalidResponse instead of having
+// the tag dropped.
+func WithRejectUnknownCategories(reject bool) Option {
+	return func(s *ClaudeService) { s.rejectUnknownCategories = reject }
+}
+
+// parseRetryInstruction is appended to the system prompt when re-requesting
+// a decision whose response could not be parsed.
+const parseRetryInstruction = "Your previous reply could not be parsed. Reply with the JSON object described above and nothing else: no prose, no markdown, no code fences."
+
+// WithParseRetries re-requests a decision up to n times, with a stricter
+// instruction, when Claude's response is not a valid decision. These are
+// separate from the retries of failed API calls; the last parse failure is
+// returned as ErrInvalidResponse.
+func WithParseRetries(n int) Option {
+	return func(s *ClaudeService) { s.parseRetries = n }
+}
+
+// WithRejectExtraFields makes a Claude decision with fields beyond the
+// decision schema fail with ErrInvalidResponse instead of having them
+// returned in the result's Extra.
+func WithRejectExtraFields(reject bool) Option {
+	return func(s *ClaudeService) { s.rejectExtraFields = reject }
+}
+
+// WithRejectEmptyReasoning makes a Claude decision with an empty reasoning
+// fail with ErrInvalidResponse. By default a minimal reasoning is synthesized
+// from the decision and the local signals, and the result is flagged with
+// ReasoningSynthesized.
+func WithRejectEmptyReasoning(reject bool) Option {
+	return func(s *ClaudeService) { s.rejectEmptyReasoning = reject }
+}
+
+// SetRuleOnly switches the service between rule-only and Claude-backed
+// analysis. It is safe to call while requests are being served.
+func (s *ClaudeService) SetRuleOnly(ruleOnly bool) {
+	if s.ruleOnly.Swap(ruleOnly) == ruleOnly {
+		return
+	}
+	s.notifyModeChange()
+	if ruleOnly {
+		log.Println("ClaudeService: Rule-only mode enabled")
+	} else {
+		log.Println("ClaudeService: Rule-only mode disabled, using Claude")
+	}
+}
+
+// RuleOnly reports whether new requests are served by the local rules,
+// either because rule-only mode was set or because the spend cap was reached.
+func (s *ClaudeService) RuleOnly() bool {
+	return s.ruleOnly.Load() || s.spend != nil && s.spend.current() == SpendRuleOnly
+}
+
+// ModeChanges returns a channel that is closed the next time rule-only or
+// spend mode changes. Call it again after each change to keep watching.
+func (s *ClaudeService) ModeChanges() <-chan struct{} {
+	s.modeMu.Lock()
+	defer s.modeMu.Unlock()
+	return s.modeChanged
+}
+
+func (s *ClaudeService) notifyModeChange() {
+	s.modeMu.Lock()
+	defer s.modeMu.Unlock()
+	close(s.modeChanged)
+	s.modeChanged = make(chan struct{})
 }
 
 // NewService creates a new instance of ClaudeService.
 // It requires an API key for authentication.
-func NewService(apiKey string) (*ClaudeService, error) {
+func NewService(apiKey string, opts ...Option) (*ClaudeService, error) {
 	if apiKey == "" {
 		return nil, errors.New("Claude API key is required")
 	}
-	return &ClaudeService{apiKey: apiKey}, nil
+	s := &ClaudeService{
+		apiKey:    apiKey,
+		baseURL:   defaultBaseURL,
+		model:     DefaultModel,
+		maxTokens: defaultMaxTokens,
+
+		maxNestingDepth:   DefaultMaxNestingDepth,
+		maxImages:         DefaultMaxImages,
+		maxImageBytes:     DefaultMaxImageBytes,
+		decisionThreshold: DefaultDecisionThreshold,
+		verbosity:         VerbosityNormal,
+		riskMapping:       DefaultRiskMapping,
+		languages:         []string{DefaultLanguage},
+		defaultLanguage:   DefaultLanguage,
+		httpClient:        &http.Client{},
+		requestTimeout:    DefaultRequestTimeout,
+		modelTimeouts:     make(map[string]time.Duration),
+		analysisTimeout:   DefaultAnalysisTimeout,
+
+		categoryCounts:   make(map[string]int64),
+		modelOutcomes:    make(map[string]map[Outcome]int64),
+		promptTemplates:  map[string]string{DefaultPromptTemplate: systemPromptPreamble},
+		missingKeyPolicy: MissingKeyEmpty,
+		retryPolicies:    make(map[ErrorClass]BackoffPolicy, len(DefaultRetryPolicies)),
+		modeChanged:      make(chan struct{}),
+	}
+	for class, policy := range DefaultRetryPolicies {
+		s.retryPolicies[class] = policy
+	}
+	s.setCategories(DefaultCategories)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.registry == nil {
+		s.registry = metrics.NewRegistry()
+	}
+	s.metrics = newServiceMetrics(s.registry)
+	if err := s.parsePromptTemplates(); err != nil {
+		return nil, err
+	}
+	if s.spend != nil {
+		s.spend.onChange = s.notifyModeChange
+	}
+	s.policyVersion = s.computePolicyVersion()
+	log.Printf("ClaudeService: Policy version %s", s.policyVersion)
+	return s, nil
 }
 
 // AnalyzeDataForLivenessInput represents the input for analyzing data.
 type AnalyzeDataForLivenessInput struct {
-	UserData      map[string]interface{} `json:"user_data"` // Generic map for various user data points
-	SessionData   map[string]interface{} `json:"session_data"` // Data related to the user's session
+	UserData      map[string]interface{} `json:"user_data"`      // Generic map for various user data points
+	SessionData   map[string]interface{} `json:"session_data"`   // Data related to the user's session
 	TechnicalData map[string]interface{} `json:"technical_data"` // Data from technical probes
+
+	Images []Image `json:"images,omitempty"` // Sent to Claude as image content, not in the JSON prompt
 }
 
 // LivenessAnalysisResult represents the result from Claude's analysis.
 type LivenessAnalysisResult struct {
 	IsLikelyLive bool    `json:"is_likely_live"`
-	Confidence   float64 `json:"confidence"` // A score from 0.0 to 1.0
+	Confidence   float64 `json:"confidence"`   // Likelihood from 0.0 to 1.0 that the user is live
 	Reasoning    string  `json:"reasoning"`    // Explanation from Claude
 	RawResponse  string  `json:"raw_response"` // The raw response from Claude API for debugging
+
+	Model            string  `json:"model,omitempty"`              // Model that produced the decision
+	Canary           bool    `json:"canary,omitempty"`             // Model was the canary rather than the stable model
+	InputTokens      int     `json:"input_tokens,omitempty"`       // Prompt tokens billed for the call
+	OutputTokens     int     `json:"output_tokens,omitempty"`      // Completion tokens billed for the call
+	EstimatedCostUSD float64 `json:"estimated_cost_usd,omitempty"` // From the token counts and the model's pricing
+
+	Categories []string `json:"categories,omitempty"` // Why the session may not be live, from the configured set
+	Factors    []string `json:"factors,omitempty"`    // Signals that drove the decision, for detailed verbosity
+
+	Extra map[string]interface{} `json:"extra,omitempty"` // Fields Claude returned beyond the decision schema
+
+	RuleOnly             bool     `json:"rule_only,omitempty"`             // Decided by the local rules without consulting Claude
+	RuleScore            *float64 `json:"rule_score,omitempty"`            // Liveness score of the local rules whoever decided, with WithRuleScore
+	TriggeredRules       []string `json:"triggered_rules,omitempty"`       // Names of the local rules that matched, with RuleScore
+	Override             string   `json:"override,omitempty"`              // allow or deny when the session's decision was forced by a list
+	OverrideConflict     bool     `json:"override_conflict,omitempty"`     // The session was on both lists; Override is the one that won
+	ReasoningSynthesized bool     `json:"reasoning_synthesized,omitempty"` // Claude gave no reasoning; Reasoning was generated locally
+	ParseRetries         int      `json:"parse_retries,omitempty"`         // Unusable responses re-requested before this one
+
+	PromptTemplate string `json:"prompt_template,omitempty"` // Name of the prompt template the request selected
+
+	Language         string `json:"language,omitempty"`          // BCP 47 tag of the language Reasoning is written in
+	LanguageFallback bool   `json:"language_fallback,omitempty"` // The requested language couldn't be served; Reasoning is in Language instead
+
+	RiskScore         int     `json:"risk_score"`                   // 0 (safe) to 100 (risky), from Confidence under the configured risk mapping
+	Outcome           Outcome `json:"outcome"`                      // live, not_live or uncertain, from Confidence and the decision margin
+	HysteresisApplied bool    `json:"hysteresis_applied,omitempty"` // Outcome kept the session's prior decision despite Confidence
+}
+
+// Stats is a snapshot of the service counters.
+type Stats struct {
+	OutboundKeysDropped   int64                        `json:"outbound_keys_dropped"`
+	OutboundImagesDropped int64                        `json:"outbound_images_dropped"` // Images withheld by the outbound allowlist
+	Categories            map[string]int64             `json:"categories"`              // Decisions tagged with each category
+	ModelOutcomes         map[string]map[Outcome]int64 `json:"model_outcomes"`          // Served decisions by model and outcome
+	Canary                *CanaryStatus                `json:"canary,omitempty"`        // Present when a canary model is configured
+	Shadow                *ShadowStatus                `json:"shadow,omitempty"`        // Present when a shadow model is configured
+	CacheHits             int64                        `json:"cache_hits"`
+	CacheMisses           int64                        `json:"cache_misses"`
+	CoalescedRequests     int64                        `json:"coalesced_requests"` // Misses served by a Claude call shared with other requests
+	EstimatedCostUSD      float64                      `json:"estimated_cost_usd"` // Total estimated spend on Claude calls
+	PolicyVersion         string                       `json:"policy_version"`
+	Spend                 *SpendStatus                 `json:"spend,omitempty"` // Present when a spend cap is configured
+	RuleOnly              bool                         `json:"rule_only"`       // Whether new requests are served by the local rules
+}
+
+// Stats returns a snapshot of the service counters.
+func (s *ClaudeService) Stats() Stats {
+	s.mu.Lock()
+	categories := make(map[string]int64, len(s.categoryCounts))
+	for k, v := range s.categoryCounts {
+		categories[k] = v
+	}
+	outcomes := make(map[string]map[Outcome]int64, len(s.modelOutcomes))
+	for model, counts := range s.modelOutcomes {
+		outcomes[model] = maps.Clone(counts)
+	}
+	cost := s.costUSD
+	s.mu.Unlock()
+
+	stats := Stats{
+		OutboundKeysDropped:   s.outboundKeysDropped.Load(),
+		OutboundImagesDropped: s.outboundImagesDropped.Load(),
+		Categories:            categories,
+		ModelOutcomes:         outcomes,
+		CacheHits:             s.cacheHits.Load(),
+		CacheMisses:           s.cacheMisses.Load(),
+		CoalescedRequests:     s.coalesced.Load(),
+		EstimatedCostUSD:      cost,
+		PolicyVersion:         s.policyVersion,
+		RuleOnly:              s.RuleOnly(),
+	}
+	if s.spend != nil {
+		stats.Spend = s.spend.status()
+	}
+	if s.canaryModel != "" {
+		canary := s.Canary()
+		stats.Canary = &canary
+	}
+	if s.shadow != nil {
+		stats.Shadow = s.shadow.status()
+	}
+	return stats
+}
+
+// AnalyzeOptions are per-request settings for AnalyzeDataForLivenessWithOptions.
+type AnalyzeOptions struct {
+	// PromptTemplate selects a registered prompt template by name; empty
+	// selects DefaultPromptTemplate.
+	PromptTemplate string
+	// Verbosity selects the reasoning detail; empty selects the service
+	// default.
+	Verbosity Verbosity
+	// Languages are the languages the reasoning may be written in, most
+	// preferred first; empty selects the configured default.
+	Languages []string
+	// Model overrides the configured model, bypassing canary routing.
+	Model string
+	// DecisionBand, when set, classifies the outcome instead of the
+	// configured threshold and margin.
+	DecisionBand *DecisionBand
 }
 
 // AnalyzeDataForLiveness sends data to Claude for liveness analysis.
-// This is a placeholder and does not make a real API call yet.
 func (s *ClaudeService) AnalyzeDataForLiveness(ctx context.Context, input AnalyzeDataForLivenessInput) (*LivenessAnalysisResult, error) {
-	log.Printf("ClaudeService: Analyzing data for liveness (API Key: %s...)", s.apiKey[:min(5, len(s.apiKey))]) // Log a snippet of the key for confirmation
-	log.Printf("Input UserData: %+v", input.UserData)
-	log.Printf("Input SessionData: %+v", input.SessionData)
-	log.Printf("Input TechnicalData: %+v", input.TechnicalData)
+	return s.AnalyzeDataForLivenessWithOptions(ctx, input, AnalyzeOptions{})
+}
 
-	// Placeholder: Simulate a Claude API call and response.
-	// In a real implementation, this would involve:
-	// 1. Formatting the input data into a prompt for Claude.
-	// 2. Making an HTTP request to the Claude API.
-	// 3. Parsing the response.
-	// 4. Handling errors.
+// AnalyzeDataForLivenessWithOptions is AnalyzeDataForLiveness with
+// per-request options.
+func (s *ClaudeService) AnalyzeDataForLivenessWithOptions(ctx context.Context, input AnalyzeDataForLivenessInput, opts AnalyzeOptions) (*LivenessAnalysisResult, error) {
+	if len(input.UserData) == 0 && len(input.SessionData) == 0 && len(input.TechnicalData) == 0 {
+		return nil, ErrNoData
+	}
+	input = s.decodeNested(input)
+	if err := checkDepth(input, s.maxNestingDepth); err != nil {
+		return nil, err
+	}
+	if err := s.checkImages(input.Images); err != nil {
+		return nil, err
+	}
+	tmpl, err := s.promptTemplate(opts.PromptTemplate)
+	if err != nil {
+		return nil, err
+	}
+	templateName := tmpl.name
+	band := s.DecisionBand()
+	if opts.DecisionBand != nil {
+		band = *opts.DecisionBand
+	}
+	verbosity, err := ParseVerbosity(string(opts.Verbosity))
+	if err != nil {
+		return nil, err
+	}
+	if verbosity == "" {
+		verbosity = s.verbosity
+	}
+	if s.sessionLimit != nil {
+		if err := s.sessionLimit.admit(input); err != nil {
+			s.metrics.sessionRateLimited.Inc()
+			return nil, err
+		}
+	}
+	lang := s.resolveLanguage(opts.Languages)
+	if forced := s.overrideResult(input); forced != nil {
+		return s.finish(forced, templateName, lang, input, band), nil
+	}
+
+	spendMode := SpendNormal
+	if s.spend != nil {
+		spendMode = s.spend.current()
+	}
+	outbound := s.filterOutbound(input)
+	images := outbound.Images
+	outbound.Images = nil
+	prompt, err := buildUserPrompt(outbound)
+	if err != nil {
+		return nil, fmt.Errorf("building prompt: %w", err)
+	}
+	preamble, err := tmpl.render(outbound, s.missingKeyPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	model := s.model
+	switch {
+	case opts.Model != "":
+		model = opts.Model
+	case s.routeCanary(prompt):
+		model = s.canaryModel
+	}
+	if spendMode == SpendDowngraded {
+		if cheap, ok := s.downgradeModel(); ok {
+			model = cheap
+		} else {
+			log.Println("ClaudeService: Warning: no cheaper model known, not downgrading")
+		}
+	}
+	req := messagesRequest{
+		Model:     model,
+		MaxTokens: s.maxTokensFor(verbosity),
+		System:    buildSystemPrompt(preamble, s.categories, verbosity, lang.tag),
+		Messages:  []message{{Role: "user", Content: userContent(prompt, images)}},
+	}
 
-	// Simulate some basic logic based on input for placeholder behavior
-	if input.UserData == nil && input.SessionData == nil && input.TechnicalData == nil {
-		return nil, errors.New("no data provided for liveness analysis")
+	key, err := s.requestKey(req)
+	if err != nil {
+		return nil, err
 	}
 
-	// Example: if certain technical data is present, assume higher likelihood of liveness
-	isLive := false
-	confidence := 0.3 // Default low confidence
-	reasoning := "Placeholder analysis: Insufficient distinct signals for strong liveness."
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(key); ok {
+			s.cacheHits.Add(1)
+			log.Println("ClaudeService: Serving cached analysis.")
+			return s.finish(cloneResult(cached), templateName, lang, input, band), nil
+		}
+		s.cacheMisses.Add(1)
+	}
 
-	if techVal, ok := input.TechnicalData["captcha_solved"]; ok && techVal == true {
-		isLive = true
-		confidence = 0.7
-		reasoning = "Placeholder analysis: CAPTCHA solved, indicating potential liveness."
+	if s.ruleOnly.Load() || spendMode == SpendRuleOnly {
+		log.Println("ClaudeService: Rule-only mode, skipping Claude.")
+		return s.finish(ruleOnlyResult(evaluateRules(input)), templateName, lang, input, band), nil
 	}
 
-	if userVal, ok := input.UserData["has_recent_activity"]; ok && userVal == true {
-		if isLive { // if captcha also solved
-			confidence = min(0.9, confidence + 0.2)
-		} else {
-			isLive = true
-			confidence = 0.6
+	if s.standby {
+		result, err := s.lookupStored(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return s.finish(result, templateName, lang, input, band), nil
+	}
+
+	// The analysis is shared with concurrent requests for the same key, so
+	// it isn't cancelled with this request but once no request waits for
+	// it, bounded by the analysis timeout; each request stops waiting at
+	// its own deadline.
+	result, err, shared := s.flight.Do(ctx, key, func(ctx context.Context) (*LivenessAnalysisResult, error) {
+		ctx, cancel := context.WithTimeout(ctx, s.analysisTimeout)
+		defer cancel()
+		result, err := s.analyze(ctx, req, input)
+		if err != nil {
+			return nil, err
+		}
+		if s.sampleShadow(prompt) {
+			s.startShadow(ctx, req, result, band)
+		}
+		if verbosity != VerbosityDetailed {
+			result.Factors = nil
 		}
-		reasoning += " Recent user activity noted."
+		if s.cache != nil {
+			s.cache.Set(key, result)
+		}
+		if s.store != nil {
+			if err := s.store.Save(context.WithoutCancel(ctx), key, result); err != nil {
+				log.Printf("ClaudeService: Failed to store analysis result: %v", err)
+			}
+		}
+		return result, nil
+	})
+	if shared {
+		s.coalesced.Add(1)
+	}
+	if err != nil {
+		return nil, err
 	}
+	return s.finish(cloneResult(result), templateName, lang, input, band), nil
+}
 
+// lookupStored serves a decision in standby mode, where Claude is never
+// called: only a previously stored decision for the same input is returned.
+func (s *ClaudeService) lookupStored(ctx context.Context, key string) (*LivenessAnalysisResult, error) {
+	if s.store == nil {
+		return nil, ErrStandbyMiss
+	}
+	result, found, err := s.store.Lookup(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up stored result: %w", err)
+	}
+	if !found {
+		return nil, ErrStandbyMiss
+	}
+	log.Println("ClaudeService: Standby mode, serving stored analysis.")
+	if s.cache != nil {
+		s.cache.Set(key, result)
+	}
+	return cloneResult(result), nil
+}
+
+// analyze performs the Claude call for req and parses the decision.
+func (s *ClaudeService) analyze(ctx context.Context, req messagesRequest, input AnalyzeDataForLivenessInput) (*LivenessAnalysisResult, error) {
+	baseSystem := req.System
+	var result *LivenessAnalysisResult
+	for attempt := 0; ; attempt++ {
+		resp, raw, err := s.createMessageWithRetry(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		cost := s.recordUsage(req.Model, resp.Usage)
+
+		result, err = parseDecision(resp, s.allowedCategories, s.rejectUnknownCategories, s.rejectExtraFields)
+		if err == nil {
+			result.RawResponse = raw
+			result.InputTokens = resp.Usage.InputTokens
+			result.OutputTokens = resp.Usage.OutputTokens
+			result.EstimatedCostUSD = cost
+			result.ParseRetries = attempt
+			break
+		}
+		var ambiguous *AmbiguousResponseError
+		if errors.As(err, &ambiguous) {
+			log.Printf("ClaudeService: Conflicting decisions in response: %q", ambiguous.Blocks)
+		}
+		// ctx is done once every caller waiting for the analysis has left.
+		if attempt >= s.parseRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("ClaudeService: Unusable response (%v), re-requesting with a stricter instruction (%d/%d)", err, attempt+1, s.parseRetries)
+		req.System = baseSystem + "\n\n" + parseRetryInstruction
+	}
+	result.Model = req.Model
+	result.Canary = s.canaryModel != "" && req.Model == s.canaryModel
+	s.mu.Lock()
+	for _, c := range result.Categories {
+		s.categoryCounts[c]++
+	}
+	s.mu.Unlock()
 
-	log.Println("ClaudeService: Placeholder analysis complete.")
-	return &LivenessAnalysisResult{
-		IsLikelyLive: isLive,
-		Confidence:   confidence,
-		Reasoning:    reasoning,
-		RawResponse:  "{\"simulated_claude_response\": true, \"details\": \"This is a mock response.\"}",
-	}, nil
+	if strings.TrimSpace(result.Reasoning) == "" {
+		if s.rejectEmptyReasoning {
+			return nil, fmt.Errorf("%w: empty reasoning", ErrInvalidResponse)
+		}
+		log.Println("ClaudeService: Claude returned an empty reasoning, synthesizing one.")
+		result.Reasoning = synthesizeReasoning(result, evaluateRules(input))
+		result.ReasoningSynthesized = true
+	}
+
+	log.Println("ClaudeService: Analysis complete.")
+	return result, nil
+}
+
+// recordUsage accounts for the tokens billed by one Claude call, including
+// calls whose response turned out unusable, and returns their estimated
+// cost.
+func (s *ClaudeService) recordUsage(model string, u usage) float64 {
+	s.metrics.inputTokens.Observe(float64(u.InputTokens))
+	s.metrics.outputTokens.Observe(float64(u.OutputTokens))
+	var cost float64
+	if pricing, ok := s.catalog.pricing(model); ok {
+		cost = pricing.Cost(u.InputTokens, u.OutputTokens)
+	}
+	s.mu.Lock()
+	s.costUSD += cost
+	s.mu.Unlock()
+	if s.spend != nil {
+		s.spend.record(cost)
+	}
+	return cost
+}
+
+// finish records the prompt template name, reasoning language, risk score,
+// rule evaluation (when included) and the decisive outcome under band on a
+// result about to be returned to the caller, applying session hysteresis
+// when it is enabled. Decisions forced by the allow and deny lists are
+// never smoothed.
+func (s *ClaudeService) finish(result *LivenessAnalysisResult, templateName string, lang language, input AnalyzeDataForLivenessInput, band DecisionBand) *LivenessAnalysisResult {
+	result.PromptTemplate = templateName
+	lang.apply(result)
+	result.RiskScore = s.riskMapping.Score(result.Confidence)
+	if s.includeRuleScore {
+		rules := evaluateRules(input)
+		// Trim floating point noise such as 0.8999999999999999.
+		score := math.Round(rules.Score*1e9) / 1e9
+		result.RuleScore, result.TriggeredRules = &score, rules.Triggered
+	}
+	result.Outcome = band.classify(result.Confidence)
+	if s.hysteresis != nil && result.Override == "" {
+		if id := s.hysteresis.sessionID(input); id != "" {
+			result.Outcome, result.HysteresisApplied = s.smooth(id, result.Confidence, result.Outcome, band)
+			if result.HysteresisApplied {
+				// Keep the verdict in step with the retained outcome.
+				result.IsLikelyLive = result.Outcome == OutcomeLive
+			}
+		}
+	}
+	s.countOutcome(result)
+	return result
+}
+
+// cloneResult returns a copy of r that callers may modify without affecting
+// the cached entry.
+func cloneResult(r *LivenessAnalysisResult) *LivenessAnalysisResult {
+	out := *r
+	out.Categories = append([]string(nil), r.Categories...)
+	out.Factors = append([]string(nil), r.Factors...)
+	return &out
+}
+
+// filterOutbound returns a copy of input holding only the keys permitted to
+// leave the service. Dropped keys are logged by name and counted, as are
+// images when the allowlist has no "images" entry.
+func (s *ClaudeService) filterOutbound(input AnalyzeDataForLivenessInput) AnalyzeDataForLivenessInput {
+	if s.outboundAllowlist == nil {
+		return input
+	}
+	out := AnalyzeDataForLivenessInput{
+		UserData:      s.filterSection("user_data", input.UserData),
+		SessionData:   s.filterSection("session_data", input.SessionData),
+		TechnicalData: s.filterSection("technical_data", input.TechnicalData),
+	}
+	if _, ok := s.outboundAllowlist["images"]; ok {
+		out.Images = input.Images
+	} else if len(input.Images) > 0 {
+		log.Printf("ClaudeService: Dropping %d non-allowlisted images from outbound request", len(input.Images))
+		s.outboundImagesDropped.Add(int64(len(input.Images)))
+	}
+	return out
 }
 
-// Helper function (not exported)
-func min(a, b int) int {
-	if a < b {
-		return a
+func (s *ClaudeService) filterSection(section string, data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		name := section + "." + k
+		if _, ok := s.outboundAllowlist[name]; !ok {
+			log.Printf("ClaudeService: Dropping non-allowlisted key %q from outbound request", name)
+			s.outboundKeysDropped.Add(1)
+			continue
+		}
+		out[k] = v
 	}
-	return b
+	return out
 }
@@ -0,0 +1,194 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboundAllowlistFiltersRequestBody(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Captcha solved."))
+	s := newStubService(t, stub, WithOutboundAllowlist([]string{"technical_data.captcha_solved"}))
+
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	body := stub.lastBody()
+	if !strings.Contains(body, "captcha_solved") {
+		t.Errorf("allowlisted key missing from request body: %s", body)
+	}
+	for _, leaked := range []string{"email", "user@example.com", "session_id"} {
+		if strings.Contains(body, leaked) {
+			t.Errorf("request body contains non-allowlisted %q: %s", leaked, body)
+		}
+	}
+	if got := s.Stats().OutboundKeysDropped; got != 2 {
+		t.Errorf("OutboundKeysDropped = %d, want 2", got)
+	}
+}
+
+func TestCancelledCallerDoesNotAbortSharedAnalysis(t *testing.T) {
+	release := make(chan struct{})
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		<-release
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Consistent signals."))
+	})
+	s := newStubService(t, stub, WithCache(time.Minute, 0))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	first := make(chan error, 1)
+	go func() {
+		_, err := s.AnalyzeDataForLiveness(ctx, testInput())
+		first <- err
+	}()
+	for stub.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	type answer struct {
+		result *LivenessAnalysisResult
+		err    error
+	}
+	second := make(chan answer, 1)
+	go func() {
+		result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+		second <- answer{result, err}
+	}()
+	time.Sleep(50 * time.Millisecond) // The second caller joins the call
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller error = %v, want Canceled", err)
+	}
+
+	// The Claude call outlives the caller that started it, serving the
+	// caller still waiting and, from the cache, the next request.
+	close(release)
+	got := <-second
+	if got.err != nil {
+		t.Fatalf("second caller: %v", got.err)
+	}
+	if !got.result.IsLikelyLive || got.result.Confidence != 0.9 {
+		t.Errorf("second caller result = %+v", got.result)
+	}
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); err != nil {
+		t.Fatalf("third caller: %v", err)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want 1", n)
+	}
+}
+
+func TestSharedAnalysisCancelledWithLastCaller(t *testing.T) {
+	var stub *messagesStub
+	stub = newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		<-stub.requestContext(call).Done()
+	})
+	s := newStubService(t, stub)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.AnalyzeDataForLiveness(ctx, testInput())
+		done <- err
+	}()
+	for stub.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("caller error = %v, want Canceled", err)
+	}
+	select {
+	case <-stub.requestContext(1).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Claude call still running with no caller waiting")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want no retry once abandoned", n)
+	}
+}
+
+func TestParseRetryRecoversFromUnparseableReply(t *testing.T) {
+	var mu sync.Mutex
+	var systems []string
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		mu.Lock()
+		systems = append(systems, req.System)
+		mu.Unlock()
+		if call == 1 {
+			writeMessage(w, req.Model, "Sure! The session looks live to me.")
+			return
+		}
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Consistent signals."))
+	})
+	s := newStubService(t, stub, WithParseRetries(2))
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if !result.IsLikelyLive || result.ParseRetries != 1 {
+		t.Errorf("result live %t, parse_retries %d; want true, 1", result.IsLikelyLive, result.ParseRetries)
+	}
+	if n := stub.calls.Load(); n != 2 {
+		t.Fatalf("Claude calls = %d, want 2", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Contains(systems[0], parseRetryInstruction) || !strings.HasSuffix(systems[1], parseRetryInstruction) {
+		t.Errorf("only the retry should carry the stricter instruction; system prompts:\n%q\n%q", systems[0], systems[1])
+	}
+	if got, want := s.Stats().EstimatedCostUSD, 2*result.EstimatedCostUSD; want == 0 || got != want {
+		t.Errorf("estimated spend = %v, want both calls' %v", got, want)
+	}
+}
+
+func TestParseRetriesExhausted(t *testing.T) {
+	stub := newMessagesStub(t, `{"is_likely_live": "maybe"}`)
+	s := newStubService(t, stub, WithParseRetries(2))
+
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("error = %v, want ErrInvalidResponse", err)
+	}
+	if n := stub.calls.Load(); n != 3 {
+		t.Errorf("Claude calls = %d, want the first and 2 retries", n)
+	}
+}
+
+func TestParseRetryRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	left := make(chan struct{})
+	var stub *messagesStub
+	stub = newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		if call == 1 {
+			// The caller's deadline passes before the reply is read.
+			cancel()
+			<-left
+		}
+		writeMessage(w, req.Model, "Not a decision.")
+	})
+	s := newStubService(t, stub, WithParseRetries(3))
+
+	go func() {
+		defer close(left)
+		if _, err := s.AnalyzeDataForLiveness(ctx, testInput()); !errors.Is(err, context.Canceled) {
+			t.Errorf("AnalyzeDataForLiveness error = %v, want Canceled", err)
+		}
+	}()
+	<-left
+
+	// Wait for the abandoned call to end and any retry to have been sent.
+	select {
+	case <-stub.requestContext(1).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Claude call still running after the caller left")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want no retry past the deadline", n)
+	}
+}
@@ -0,0 +1,174 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// messagesRequest is the body of a Messages API call.
+type messagesRequest struct {
+	Model     string    `json:"model"`
+	MaxTokens int       `json:"max_tokens"`
+	System    string    `json:"system,omitempty"`
+	Messages  []message `json:"messages"`
+	Stream    bool      `json:"stream,omitempty"`
+}
+
+type message struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // A string, or content blocks when images are attached
+}
+
+// messagesResponse is the subset of the Messages API response we consume.
+type messagesResponse struct {
+	ID         string         `json:"id"`
+	Model      string         `json:"model"`
+	StopReason string         `json:"stop_reason"`
+	Content    []contentBlock `json:"content"`
+	Usage      usage          `json:"usage"`
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// APIError is returned when the Claude API responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+	// MidStream marks an error event received partway through a streamed
+	// response whose status was successful.
+	MidStream bool
+}
+
+func (e *APIError) Error() string {
+	if e.MidStream {
+		return fmt.Sprintf("Claude API error mid-stream (%s): %s", e.Type, e.Message)
+	}
+	if e.Type != "" {
+		return fmt.Sprintf("Claude API error (status %d, %s): %s", e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("Claude API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// createMessage calls the Messages API and returns the decoded response along
+// with the raw response body. With streaming enabled the response is
+// streamed, and an error event partway through falls back to one
+// non-streaming call when configured to.
+func (s *ClaudeService) createMessage(ctx context.Context, req messagesRequest) (*messagesResponse, string, error) {
+	if !s.streaming {
+		return s.sendMessage(ctx, req)
+	}
+	streamReq := req
+	streamReq.Stream = true
+	resp, raw, err := s.sendMessage(ctx, streamReq)
+	var apiErr *APIError
+	if err != nil && errors.As(err, &apiErr) && apiErr.MidStream && s.streamFallback && ctx.Err() == nil {
+		log.Printf("ClaudeService: Stream failed with %s, retrying without streaming", apiErr.Type)
+		return s.sendMessage(ctx, req)
+	}
+	return resp, raw, err
+}
+
+// sendMessage performs one Messages API call.
+func (s *ClaudeService) sendMessage(ctx context.Context, req messagesRequest) (*messagesResponse, string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding Claude request: %w", err)
+	}
+
+	s.metrics.promptBytes.Observe(float64(len(body)))
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeoutFor(req.Model))
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.baseURL, "/")+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("creating Claude request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", s.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	start := time.Now()
+	httpResp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("calling Claude API: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	var exemplar map[string]string
+	if traceID, ok := trace.FromContext(ctx); ok {
+		exemplar = map[string]string{"trace_id": traceID}
+	}
+	if req.Stream && httpResp.StatusCode >= 200 && httpResp.StatusCode <= 299 {
+		counted := &countingReader{r: httpResp.Body}
+		resp, err := readStream(counted)
+		s.metrics.latency.ObserveWithExemplar(time.Since(start).Seconds(), exemplar)
+		s.metrics.responseBytes.Observe(float64(counted.n))
+		if err != nil {
+			if apiErr, ok := err.(*APIError); ok {
+				apiErr.StatusCode = httpResp.StatusCode
+			}
+			// The tokens used before the stream failed are billed all the
+			// same, whether or not the call falls back.
+			if resp.Usage != (usage{}) {
+				s.recordUsage(req.Model, resp.Usage)
+			}
+			return nil, "", err
+		}
+		raw, _ := json.Marshal(resp) // plain strings and ints cannot fail
+		return resp, string(raw), nil
+	}
+
+	raw, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading Claude response: %w", err)
+	}
+	s.metrics.latency.ObserveWithExemplar(time.Since(start).Seconds(), exemplar)
+	s.metrics.responseBytes.Observe(float64(len(raw)))
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: httpResp.StatusCode, Message: strings.TrimSpace(string(raw))}
+		if secs, err := strconv.Atoi(httpResp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			apiErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		var envelope struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(raw, &envelope) == nil && envelope.Error.Message != "" {
+			apiErr.Type = envelope.Error.Type
+			apiErr.Message = envelope.Error.Message
+		}
+		return nil, string(raw), apiErr
+	}
+
+	var resp messagesResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, string(raw), fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return &resp, string(raw), nil
+}
@@ -0,0 +1,205 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// decision is the JSON object Claude is instructed to reply with.
+type decision struct {
+	IsLikelyLive *bool    `json:"is_likely_live"`
+	Confidence   *float64 `json:"confidence"`
+	Reasoning    string   `json:"reasoning"`
+	Categories   []string `json:"categories"`
+	Factors      []string `json:"factors"`
+}
+
+// decisionFields are the JSON keys of decision; anything else Claude
+// returns is an extra field.
+var decisionFields = map[string]bool{
+	"is_likely_live": true,
+	"confidence":     true,
+	"reasoning":      true,
+	"categories":     true,
+	"factors":        true,
+}
+
+// AmbiguousResponseError is an ErrAmbiguousResponse carrying the text of
+// the conflicting blocks, in response order.
+type AmbiguousResponseError struct {
+	Blocks []string
+}
+
+func (e *AmbiguousResponseError) Error() string {
+	return fmt.Sprintf("%v: %d text blocks hold conflicting decisions", ErrAmbiguousResponse, len(e.Blocks))
+}
+
+func (e *AmbiguousResponseError) Unwrap() error { return ErrAmbiguousResponse }
+
+// parseDecision extracts the liveness decision from the text content of a
+// Messages API response. Each text block is tried on its own first: when
+// several hold a valid decision they must agree on is_likely_live and
+// confidence, and the last one is used, otherwise the response fails with
+// an *AmbiguousResponseError. A block that is a decision object but fails
+// validation, such as under rejectUnknown or rejectExtra, fails the
+// response rather than being passed over for another block. When no single
+// block is a decision, the blocks are parsed concatenated, for a decision
+// split across them.
+//
+// Category tags outside allowed are dropped, or make the response invalid
+// when rejectUnknown is set. Fields beyond the decision schema are returned
+// in Extra, or make the response invalid when rejectExtra is set.
+func parseDecision(resp *messagesResponse, allowed map[string]struct{}, rejectUnknown, rejectExtra bool) (*LivenessAnalysisResult, error) {
+	var text strings.Builder
+	var blocks []string
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+			if strings.TrimSpace(block.Text) != "" {
+				blocks = append(blocks, block.Text)
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("%w: no text content", ErrInvalidResponse)
+	}
+	if len(blocks) == 1 {
+		return decodeDecision(blocks[0], allowed, rejectUnknown, rejectExtra)
+	}
+
+	var chosen *LivenessAnalysisResult
+	var chosenText string
+	for _, block := range blocks {
+		result, err := decodeDecision(block, allowed, rejectUnknown, rejectExtra)
+		if err != nil {
+			if isDecisionObject(block) {
+				return nil, err
+			}
+			continue
+		}
+		if chosen != nil && (result.IsLikelyLive != chosen.IsLikelyLive || result.Confidence != chosen.Confidence) {
+			return nil, &AmbiguousResponseError{Blocks: []string{chosenText, block}}
+		}
+		chosen, chosenText = result, block
+	}
+	if chosen != nil {
+		return chosen, nil
+	}
+	return decodeDecision(text.String(), allowed, rejectUnknown, rejectExtra)
+}
+
+// decodeDecision parses and validates one decision object.
+func decodeDecision(text string, allowed map[string]struct{}, rejectUnknown, rejectExtra bool) (*LivenessAnalysisResult, error) {
+	body := []byte(strings.TrimSpace(text))
+	var d decision
+	if err := json.Unmarshal(body, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	extra, err := extraFields(body)
+	if err != nil {
+		return nil, err
+	}
+	if rejectExtra && len(extra) > 0 {
+		return nil, fmt.Errorf("%w: unexpected fields %s", ErrInvalidResponse, strings.Join(slices.Sorted(maps.Keys(extra)), ", "))
+	}
+	if d.IsLikelyLive == nil || d.Confidence == nil {
+		return nil, fmt.Errorf("%w: missing is_likely_live or confidence", ErrInvalidResponse)
+	}
+	if *d.Confidence < 0 || *d.Confidence > 1 {
+		return nil, fmt.Errorf("%w: confidence %v out of range", ErrInvalidResponse, *d.Confidence)
+	}
+	if rejectUnknown {
+		for _, tag := range d.Categories {
+			if _, ok := allowed[strings.ToLower(strings.TrimSpace(tag))]; !ok {
+				return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidResponse, tag)
+			}
+		}
+	}
+
+	return &LivenessAnalysisResult{
+		IsLikelyLive: *d.IsLikelyLive,
+		Confidence:   *d.Confidence,
+		Reasoning:    d.Reasoning,
+		Categories:   filterCategories(d.Categories, allowed),
+		Factors:      d.Factors,
+		Extra:        extra,
+	}, nil
+}
+
+// isDecisionObject reports whether text is a JSON object carrying either
+// of the required decision fields, as opposed to prose or a fragment.
+func isDecisionObject(text string) bool {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(strings.TrimSpace(text)), &fields) != nil {
+		return false
+	}
+	_, live := fields["is_likely_live"]
+	_, confidence := fields["confidence"]
+	return live || confidence
+}
+
+// extraFields returns the top-level fields of the decision object body
+// that are not part of the decision schema, or nil if there are none.
+func extraFields(body []byte) (map[string]interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	var extra map[string]interface{}
+	for key, raw := range fields {
+		if decisionFields[key] {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", ErrInvalidResponse, key, err)
+		}
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[key] = v
+	}
+	return extra, nil
+}
+
+// filterCategories normalizes the category tags Claude returned, dropping
+// duplicates and any tag not in allowed.
+func filterCategories(tags []string, allowed map[string]struct{}) []string {
+	var out []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if _, ok := allowed[tag]; !ok {
+			log.Printf("ClaudeService: Dropping unknown category %q from Claude response", tag)
+			continue
+		}
+		out = append(out, tag)
+	}
+	return out
+}
+
+// synthesizeReasoning builds a minimal human-readable reasoning for a
+// decision Claude returned without one, from the decision itself and the
+// strongest local signals.
+func synthesizeReasoning(result *LivenessAnalysisResult, rules ruleOutcome) string {
+	verdict := "not likely live"
+	if result.IsLikelyLive {
+		verdict = "likely live"
+	}
+	reasoning := fmt.Sprintf("Judged %s with confidence %.2f.", verdict, result.Confidence)
+	switch {
+	case len(rules.reasons) > 0:
+		reasoning += " Contributing signals: " + strings.Join(rules.reasons, ", ") + "."
+	case len(result.Categories) > 0:
+		reasoning += " Flagged categories: " + strings.Join(result.Categories, ", ") + "."
+	}
+	return reasoning
+}
@@ -0,0 +1,179 @@
+package claude
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// textResponse returns a Messages API response with one text block per
+// argument.
+func textResponse(blocks ...string) *messagesResponse {
+	resp := &messagesResponse{}
+	for _, b := range blocks {
+		resp.Content = append(resp.Content, contentBlock{Type: "text", Text: b})
+	}
+	return resp
+}
+
+func TestCategoriesTagged(t *testing.T) {
+	stub := newMessagesStub(t, `{"is_likely_live": false, "confidence": 0.1, "reasoning": "Scripted.", "categories": ["Bot", "replay", "bot", "made-up"]}`)
+	s := newStubService(t, stub)
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if want := []string{"bot", "replay"}; !slices.Equal(result.Categories, want) {
+		t.Errorf("Categories = %v, want %v", result.Categories, want)
+	}
+	stats := s.Stats()
+	if stats.Categories["bot"] != 1 || stats.Categories["replay"] != 1 || stats.Categories["made-up"] != 0 {
+		t.Errorf("category counts = %v", stats.Categories)
+	}
+	if body := stub.lastBody(); !strings.Contains(body, "device-mismatch") {
+		t.Errorf("system prompt doesn't list the configured categories: %s", body)
+	}
+}
+
+func TestCategoriesOutOfEnum(t *testing.T) {
+	resp := textResponse(`{"is_likely_live": false, "confidence": 0.2, "categories": ["bot", "emulator"]}`)
+	allowed := map[string]struct{}{"bot": {}}
+
+	result, err := parseDecision(resp, allowed, false, false)
+	if err != nil {
+		t.Fatalf("lenient parseDecision: %v", err)
+	}
+	if !slices.Equal(result.Categories, []string{"bot"}) {
+		t.Errorf("lenient Categories = %v, want [bot]", result.Categories)
+	}
+
+	_, err = parseDecision(resp, allowed, true, false)
+	if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), "emulator") {
+		t.Errorf("strict parseDecision error = %v, want ErrInvalidResponse naming the tag", err)
+	}
+}
+
+func TestEmptyReasoningSynthesized(t *testing.T) {
+	stub := newMessagesStub(t, `{"is_likely_live": true, "confidence": 0.85, "reasoning": "  "}`)
+	s := newStubService(t, stub)
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if !result.ReasoningSynthesized {
+		t.Error("reasoning_synthesized not set")
+	}
+	if !strings.Contains(result.Reasoning, "likely live with confidence 0.85") {
+		t.Errorf("synthesized reasoning = %q", result.Reasoning)
+	}
+}
+
+func TestEmptyReasoningRejected(t *testing.T) {
+	stub := newMessagesStub(t, `{"is_likely_live": true, "confidence": 0.85, "reasoning": ""}`)
+	s := newStubService(t, stub, WithRejectEmptyReasoning(true))
+
+	_, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("error = %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestReasoningKeptWhenPresent(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.85, "Consistent signals."))
+	s := newStubService(t, stub, WithRejectEmptyReasoning(true))
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if result.Reasoning != "Consistent signals." || result.ReasoningSynthesized {
+		t.Errorf("reasoning = %q, synthesized %t", result.Reasoning, result.ReasoningSynthesized)
+	}
+}
+
+func TestExtraFieldsCapturedOrRejected(t *testing.T) {
+	reply := `{"is_likely_live": true, "confidence": 0.9, "reasoning": "Consistent signals.", "risk_label": "low", "signals": {"typing": "steady"}}`
+
+	stub := newMessagesStub(t, reply)
+	result, err := newStubService(t, stub).AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("lenient AnalyzeDataForLiveness: %v", err)
+	}
+	if !result.IsLikelyLive || result.Confidence != 0.9 {
+		t.Errorf("lenient decision = %+v", result)
+	}
+	if got := result.Extra["risk_label"]; got != "low" {
+		t.Errorf("Extra[risk_label] = %v, want low", got)
+	}
+	if got, ok := result.Extra["signals"].(map[string]interface{}); !ok || got["typing"] != "steady" {
+		t.Errorf("Extra[signals] = %v, want the nested object", result.Extra["signals"])
+	}
+	if _, ok := result.Extra["confidence"]; ok || len(result.Extra) != 2 {
+		t.Errorf("Extra = %v, want only the fields beyond the schema", result.Extra)
+	}
+
+	_, err = newStubService(t, stub, WithRejectExtraFields(true)).AnalyzeDataForLiveness(t.Context(), testInput())
+	if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), "risk_label, signals") {
+		t.Errorf("strict error = %v, want ErrInvalidResponse naming the extra fields", err)
+	}
+
+	// Required fields are validated either way.
+	_, err = parseDecision(textResponse(`{"confidence": 0.9, "risk_label": "low"}`), nil, false, false)
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("missing is_likely_live: error = %v, want ErrInvalidResponse", err)
+	}
+	result, err = parseDecision(textResponse(`{"is_likely_live": false, "confidence": 0.2}`), nil, false, true)
+	if err != nil || result.Extra != nil {
+		t.Errorf("strict decision without extras = %+v, %v", result, err)
+	}
+}
+
+func TestDecisionPickedPerBlock(t *testing.T) {
+	allowed := map[string]struct{}{"bot": {}}
+	live := `{"is_likely_live": true, "confidence": 0.9, "reasoning": "First."}`
+	for _, tc := range []struct {
+		name          string
+		blocks        []string
+		rejectUnknown bool
+		rejectExtra   bool
+		want          string // Reasoning of the chosen decision; empty expects an error
+		wantErr       error
+	}{
+		{"single", []string{live}, false, false, "First.", nil},
+		{"prose and a decision", []string{"Here is my analysis:", live}, false, false, "First.", nil},
+		{"consistent", []string{live, `{"is_likely_live": true, "confidence": 0.9, "reasoning": "Second."}`}, false, false, "Second.", nil},
+		{"split across blocks", []string{`{"is_likely_live": true, `, `"confidence": 0.9, "reasoning": "Split."}`}, false, false, "Split.", nil},
+		{"conflicting live", []string{live, `{"is_likely_live": false, "confidence": 0.9}`}, false, false, "", ErrAmbiguousResponse},
+		{"conflicting confidence", []string{live, `{"is_likely_live": true, "confidence": 0.4}`}, false, false, "", ErrAmbiguousResponse},
+		{"no decision", []string{"Sorry,", " I can't."}, false, false, "", ErrInvalidResponse},
+		{"invalid decision beside a valid one", []string{live, `{"is_likely_live": true, "confidence": 1.5}`}, false, false, "", ErrInvalidResponse},
+		{"unknown category, lenient", []string{live, `{"is_likely_live": true, "confidence": 0.9, "reasoning": "Tagged.", "categories": ["emulator"]}`}, false, false, "Tagged.", nil},
+		{"unknown category, strict", []string{live, `{"is_likely_live": true, "confidence": 0.9, "categories": ["emulator"]}`}, true, false, "", ErrInvalidResponse},
+		{"extra field, strict", []string{`{"is_likely_live": true, "confidence": 0.9, "note": "x"}`, live}, false, true, "", ErrInvalidResponse},
+	} {
+		result, err := parseDecision(textResponse(tc.blocks...), allowed, tc.rejectUnknown, tc.rejectExtra)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseDecision: %v", tc.name, err)
+			continue
+		}
+		if result.Reasoning != tc.want {
+			t.Errorf("%s: reasoning = %q, want %q", tc.name, result.Reasoning, tc.want)
+		}
+	}
+
+	conflicting := `{"is_likely_live": false, "confidence": 0.2}`
+	_, err := parseDecision(textResponse(live, "Also:", conflicting), allowed, false, false)
+	var ambiguous *AmbiguousResponseError
+	if !errors.As(err, &ambiguous) || !slices.Equal(ambiguous.Blocks, []string{live, conflicting}) {
+		t.Errorf("error = %v, want an *AmbiguousResponseError holding both decisions", err)
+	}
+}
@@ -0,0 +1,144 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultHedgeMaxInFlight is the number of hedged calls that may run at
+// once when WithHedging is given none.
+const DefaultHedgeMaxInFlight = 8
+
+// hedging sends a second copy of a slow Claude call and takes whichever
+// answers first.
+type hedging struct {
+	delay    time.Duration
+	fraction float64
+	slots    chan struct{}
+}
+
+// WithHedging hedges slow Claude calls: one that hasn't answered after
+// delay, or after fraction (0-1) of the time left before its deadline,
+// whichever is sooner, is sent a second time and the first answer wins.
+// The other call is cancelled. Zero disables either trigger; with both
+// zero hedging is off. Only the first attempt of a call is hedged, never
+// its retries, and at most maxInFlight hedges run at once (below 1,
+// DefaultHedgeMaxInFlight); a slow call finding them all busy waits on its
+// own. A hedged call may be billed twice, so the losing call's usage is
+// added to the spend too.
+func WithHedging(delay time.Duration, fraction float64, maxInFlight int) Option {
+	return func(s *ClaudeService) {
+		if delay <= 0 && fraction <= 0 {
+			s.hedging = nil
+			return
+		}
+		if maxInFlight < 1 {
+			maxInFlight = DefaultHedgeMaxInFlight
+		}
+		s.hedging = &hedging{delay: delay, fraction: fraction, slots: make(chan struct{}, maxInFlight)}
+	}
+}
+
+// ValidateHedgeFraction reports whether fraction is usable as the share of
+// the deadline after which a call is hedged.
+func ValidateHedgeFraction(fraction float64) error {
+	if fraction < 0 || fraction >= 1 {
+		return fmt.Errorf("hedge deadline fraction must be at least 0 and below 1, got %v", fraction)
+	}
+	return nil
+}
+
+// delayFor returns how long to wait before hedging a call made under ctx,
+// and false when it shouldn't be hedged.
+func (h *hedging) delayFor(ctx context.Context) (time.Duration, bool) {
+	delay := h.delay
+	if deadline, ok := ctx.Deadline(); ok && h.fraction > 0 {
+		d := time.Duration(float64(time.Until(deadline)) * h.fraction)
+		if delay <= 0 || d < delay {
+			delay = d
+		}
+	}
+	return delay, delay > 0
+}
+
+type hedgeOutcome struct {
+	resp  *messagesResponse
+	raw   string
+	err   error
+	hedge bool
+}
+
+// createMessageHedged calls createMessage, hedging the call when it is
+// slow; see WithHedging. A failure is returned only once every call sent
+// has failed, as the last one's error. The caller accounts for the usage
+// of the response returned; that of the losing call is recorded here.
+func (s *ClaudeService) createMessageHedged(ctx context.Context, req messagesRequest) (*messagesResponse, string, error) {
+	if s.hedging == nil {
+		return s.createMessage(ctx, req)
+	}
+	delay, ok := s.hedging.delayFor(ctx)
+	if !ok {
+		return s.createMessage(ctx, req)
+	}
+
+	// Cancelling ctx on return stops the losing call.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	outcomes := make(chan hedgeOutcome, 2)
+	call := func(hedge bool) {
+		resp, raw, err := s.createMessage(ctx, req)
+		outcomes <- hedgeOutcome{resp: resp, raw: raw, err: err, hedge: hedge}
+	}
+	go call(false)
+	pending := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedgeTimer := timer.C
+	for {
+		select {
+		case <-hedgeTimer:
+			hedgeTimer = nil
+			select {
+			case s.hedging.slots <- struct{}{}:
+			default:
+				continue // Too many hedges running
+			}
+			s.metrics.hedges.Inc()
+			log.Printf("ClaudeService: No response from %s after %s, sending a hedged request", req.Model, delay)
+			pending++
+			go func() {
+				defer func() { <-s.hedging.slots }()
+				call(true)
+			}()
+		case o := <-outcomes:
+			pending--
+			if o.err == nil && o.hedge {
+				s.metrics.hedgeWins.Inc()
+			}
+			// A call failing before the hedge fires is left to the retry
+			// policy; once hedged, a failure waits for the other call.
+			if o.err == nil || pending == 0 {
+				if pending > 0 {
+					go s.recordLoser(req.Model, outcomes, o.resp.Usage)
+				}
+				return o.resp, o.raw, o.err
+			}
+		}
+	}
+}
+
+// recordLoser accounts for the usage of the call that lost a hedge, once
+// it has returned on outcomes. One cancelled mid-flight reports no usage
+// although its prompt was billed, so it is estimated as the winner's
+// input tokens.
+func (s *ClaudeService) recordLoser(model string, outcomes <-chan hedgeOutcome, winner usage) {
+	o := <-outcomes
+	if o.resp != nil {
+		s.recordUsage(model, o.resp.Usage)
+		return
+	}
+	s.recordUsage(model, usage{InputTokens: winner.InputTokens})
+}
@@ -0,0 +1,154 @@
+package claude
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hedgeStub answers the calls for which slow reports true only once the
+// test ends, and the rest at once.
+func hedgeStub(t *testing.T, slow func(call int64) bool) *messagesStub {
+	release := make(chan struct{})
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		if slow(call) {
+			<-release
+		}
+		writeMessage(w, req.Model, decisionText(true, 0.9, fmt.Sprintf("Call %d.", call)))
+	})
+	t.Cleanup(func() { close(release) }) // Before the stub closes
+	return stub
+}
+
+// waitForCost waits until the estimated spend reaches want.
+func waitForCost(t *testing.T, s *ClaudeService, want float64) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if got := s.Stats().EstimatedCostUSD; math.Abs(got-want) < 1e-12 {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("estimated cost = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHedgeWinsOverSlowFirstCall(t *testing.T) {
+	stub := hedgeStub(t, func(call int64) bool { return call == 1 })
+	s := newStubService(t, stub, WithHedging(20*time.Millisecond, 0, 0))
+
+	start := time.Now()
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("analysis took %s, waiting on the slow call", elapsed)
+	}
+	if result.Reasoning != "Call 2." {
+		t.Errorf("reasoning = %q, want the hedge's answer", result.Reasoning)
+	}
+	if h, w := s.metrics.hedges.Value(), s.metrics.hedgeWins.Value(); h != 1 || w != 1 {
+		t.Errorf("hedges = %v, wins = %v; want 1 and 1", h, w)
+	}
+
+	// The cancelled first call is billed for its prompt.
+	pricing, ok := s.catalog.pricing(DefaultModel)
+	if !ok {
+		t.Fatalf("no pricing for %s", DefaultModel)
+	}
+	waitForCost(t, s, pricing.Cost(100, 20)+pricing.Cost(100, 0))
+}
+
+func TestHedgeLosesToFirstCall(t *testing.T) {
+	// The first call answers after the hedge is sent, the hedge never.
+	var once sync.Once
+	hedgeSent := make(chan struct{})
+	stub := hedgeStub(t, func(call int64) bool {
+		if call == 2 {
+			once.Do(func() { close(hedgeSent) })
+			return true
+		}
+		<-hedgeSent
+		return false
+	})
+	s := newStubService(t, stub, WithHedging(20*time.Millisecond, 0, 0))
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if result.Reasoning != "Call 1." {
+		t.Errorf("reasoning = %q, want the first call's answer", result.Reasoning)
+	}
+	if h, w := s.metrics.hedges.Value(), s.metrics.hedgeWins.Value(); h != 1 || w != 0 {
+		t.Errorf("hedges = %v, wins = %v; want 1 and 0", h, w)
+	}
+	pricing, _ := s.catalog.pricing(DefaultModel)
+	waitForCost(t, s, pricing.Cost(100, 20)+pricing.Cost(100, 0))
+}
+
+func TestHedgeNotSent(t *testing.T) {
+	// A fast call isn't hedged.
+	stub := hedgeStub(t, func(int64) bool { return false })
+	s := newStubService(t, stub, WithHedging(time.Second, 0, 0))
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if n := stub.calls.Load(); n != 1 || s.metrics.hedges.Value() != 0 {
+		t.Errorf("fast call: %d Claude calls, %v hedges; want 1 and 0", n, s.metrics.hedges.Value())
+	}
+
+	// A call failing before the hedge fires is returned at once.
+	failing := newMessagesStubFunc(t, func(w http.ResponseWriter, _ messagesRequest, _ int64) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type": "error", "error": {"type": "invalid_request_error", "message": "bad"}}`)
+	})
+	s = newStubService(t, failing, WithHedging(time.Second, 0, 0))
+	start := time.Now()
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); err == nil {
+		t.Fatal("AnalyzeDataForLiveness succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || s.metrics.hedges.Value() != 0 {
+		t.Errorf("failed call: returned after %s with %v hedges, want at once and none", elapsed, s.metrics.hedges.Value())
+	}
+}
+
+func TestHedgesBoundedByMaxInFlight(t *testing.T) {
+	// Every call hangs until the test has counted the hedges.
+	proceed := make(chan struct{})
+	release := sync.OnceFunc(func() { close(proceed) })
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		<-proceed
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Consistent signals."))
+	})
+	t.Cleanup(release) // Before the stub closes
+	s := newStubService(t, stub, WithHedging(20*time.Millisecond, 0, 1))
+
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			input := testInput()
+			input.SessionData = map[string]interface{}{"session_id": fmt.Sprintf("s%d", i)}
+			if _, err := s.AnalyzeDataForLiveness(t.Context(), input); err != nil {
+				t.Errorf("AnalyzeDataForLiveness: %v", err)
+			}
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); stub.calls.Load() < 4; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d Claude calls, want three and a hedge", stub.calls.Load())
+		}
+	}
+	time.Sleep(100 * time.Millisecond) // Every hedge timer has fired
+	if h, n := s.metrics.hedges.Value(), stub.calls.Load(); h != 1 || n != 4 {
+		t.Errorf("hedges = %v, Claude calls = %d; want 1 and 4 with one hedge slot", h, n)
+	}
+	release()
+	wg.Wait()
+}
@@ -0,0 +1,90 @@
+package claude
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/cache"
+)
+
+// DefaultSessionKey is the session_data field identifying a session for
+// decision hysteresis.
+const DefaultSessionKey = "session_id"
+
+// hysteresis remembers each session's last decisive outcome so that a later
+// borderline query doesn't flip it.
+type hysteresis struct {
+	sessionKey string
+	swing      float64
+	recent     *cache.Cache[Outcome]
+}
+
+// WithHysteresis enables per-session decision hysteresis. Once a session has
+// a live or not_live outcome, for the following window a query only reverses
+// it when its confidence lies at least swing beyond the opposite decision
+// boundary; anything closer keeps the prior outcome. Sessions are identified
+// by the sessionKey field of session_data, and queries without one are
+// unaffected. A non-positive window disables hysteresis.
+//
+// Prior outcomes are kept in memory rather than looked up in the result
+// store or the response cache, so each replica smooths only the queries it
+// served itself and a restart forgets them. A retained outcome also sets
+// IsLikelyLive to match it.
+func WithHysteresis(window time.Duration, swing float64, sessionKey string) Option {
+	return func(s *ClaudeService) {
+		if window <= 0 {
+			s.hysteresis = nil
+			return
+		}
+		if sessionKey == "" {
+			sessionKey = DefaultSessionKey
+		}
+		s.hysteresis = &hysteresis{
+			sessionKey: sessionKey,
+			swing:      swing,
+			recent:     cache.New[Outcome](window, 0),
+		}
+	}
+}
+
+// sessionID returns the session identifier in input, or "" if it has none.
+func (h *hysteresis) sessionID(input AnalyzeDataForLivenessInput) string {
+	return sessionIDFrom(input, h.sessionKey)
+}
+
+// sessionIDFrom returns the key field of input's session_data as a string,
+// or "" if it is absent.
+func sessionIDFrom(input AnalyzeDataForLivenessInput, key string) string {
+	v, ok := input.SessionData[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if id, ok := v.(string); ok {
+		return id
+	}
+	return fmt.Sprint(v)
+}
+
+// smooth returns the outcome to report for a session whose new confidence
+// classifies as computed within band, and whether the prior outcome was
+// retained.
+func (s *ClaudeService) smooth(sessionID string, confidence float64, computed Outcome, band DecisionBand) (Outcome, bool) {
+	h := s.hysteresis
+	final, retained := computed, false
+	if prior, ok := h.recent.Get(sessionID); ok && prior != computed {
+		switch prior {
+		case OutcomeLive:
+			if confidence > band.Threshold-band.Margin-h.swing {
+				final, retained = prior, true
+			}
+		case OutcomeNotLive:
+			if confidence < band.Threshold+band.Margin+h.swing {
+				final, retained = prior, true
+			}
+		}
+	}
+	if final != OutcomeUncertain {
+		h.recent.Set(sessionID, final)
+	}
+	return final, retained
+}
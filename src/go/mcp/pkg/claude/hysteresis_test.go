@@ -0,0 +1,81 @@
+package claude
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// sessionInput returns an input for the session with the given extra
+// session_data fields.
+func sessionInput(session string, extra map[string]interface{}) AnalyzeDataForLivenessInput {
+	input := testInput()
+	input.SessionData = map[string]interface{}{"session_id": session}
+	for k, v := range extra {
+		input.SessionData[k] = v
+	}
+	return input
+}
+
+// confidenceStub answers the nth call with the nth confidence, as live when
+// it is at least 0.5.
+func confidenceStub(t *testing.T, confidences ...float64) *messagesStub {
+	return newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		c := confidences[call-1]
+		writeMessage(w, req.Model, decisionText(c >= 0.5, c, "Signals."))
+	})
+}
+
+func TestHysteresisRetainsPriorDecision(t *testing.T) {
+	stub := confidenceStub(t, 0.8, 0.35, 0.45, 0.25, 0.35)
+	s := newStubService(t, stub, WithDecisionMargin(0.5, 0.1), WithHysteresis(time.Minute, 0.1, ""))
+
+	for i, want := range []struct {
+		outcome  Outcome
+		live     bool
+		retained bool
+	}{
+		{OutcomeLive, true, false},     // 0.8 decides live
+		{OutcomeLive, true, true},      // 0.35 would be not_live, but within the swing
+		{OutcomeLive, true, true},      // 0.45 would be uncertain
+		{OutcomeNotLive, false, false}, // 0.25 is beyond the swing and reverses it
+		{OutcomeNotLive, false, false}, // 0.35 agrees with the new decision
+	} {
+		// Vary the input so each query reaches Claude.
+		result, err := s.AnalyzeDataForLiveness(t.Context(), sessionInput("s1", map[string]interface{}{"query": i}))
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		if result.Outcome != want.outcome || result.IsLikelyLive != want.live || result.HysteresisApplied != want.retained {
+			t.Errorf("query %d: outcome %s, is_likely_live %t, hysteresis_applied %t; want %s, %t, %t",
+				i, result.Outcome, result.IsLikelyLive, result.HysteresisApplied, want.outcome, want.live, want.retained)
+		}
+	}
+
+	// Other sessions are unaffected.
+	stub2 := confidenceStub(t, 0.35)
+	s2 := newStubService(t, stub2, WithDecisionMargin(0.5, 0.1), WithHysteresis(time.Minute, 0.1, ""))
+	if result, err := s2.AnalyzeDataForLiveness(t.Context(), sessionInput("s2", nil)); err != nil || result.Outcome != OutcomeNotLive {
+		t.Errorf("fresh session: result %+v, error %v; want not_live", result, err)
+	}
+}
+
+func TestHysteresisSkipsOverrides(t *testing.T) {
+	stub := confidenceStub(t, 0.8)
+	s := newStubService(t, stub,
+		WithDecisionMargin(0.5, 0.1),
+		// A swing wide enough to retain live even at confidence 0.
+		WithHysteresis(time.Minute, 0.45, ""),
+		WithSessionOverrides(SessionOverrides{Deny: []string{"d1"}, SessionKey: "device_id"}))
+
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), sessionInput("s1", nil)); err != nil {
+		t.Fatalf("first query: %v", err)
+	}
+	result, err := s.AnalyzeDataForLiveness(t.Context(), sessionInput("s1", map[string]interface{}{"device_id": "d1"}))
+	if err != nil {
+		t.Fatalf("denied query: %v", err)
+	}
+	if result.Override != "deny" || result.Outcome != OutcomeNotLive || result.IsLikelyLive || result.HysteresisApplied {
+		t.Errorf("denied query = %+v; the override must not be smoothed", result)
+	}
+}
@@ -0,0 +1,124 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF for image.DecodeConfig
+	_ "image/jpeg" // Register JPEG for image.DecodeConfig
+	_ "image/png"  // Register PNG for image.DecodeConfig
+)
+
+// Image limits applied unless WithImageLimits sets others.
+const (
+	DefaultMaxImages     = 5
+	DefaultMaxImageBytes = 10 << 20 // Total decoded bytes per request
+
+	// maxImageDimension is the largest width or height Claude accepts.
+	maxImageDimension = 8000
+)
+
+var (
+	// ErrTooManyImages and ErrImagesTooLarge are returned when a request's
+	// images exceed the configured count or total size.
+	ErrTooManyImages  = errors.New("too many images")
+	ErrImagesTooLarge = errors.New("images too large")
+	// ErrInvalidImage is returned when an image isn't valid base64 of a
+	// supported format matching its media type.
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// Image is a base64-encoded image attached to an analysis request.
+type Image struct {
+	MediaType string `json:"media_type"` // image/jpeg, image/png or image/gif
+	Data      string `json:"data"`       // Standard base64, no data: URL prefix
+}
+
+// imageFormats maps supported media types to the format name reported by
+// image.DecodeConfig.
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// WithImageLimits bounds the number of images per request and their total
+// decoded size. Zero or less for either disables that limit.
+func WithImageLimits(maxImages, maxTotalBytes int) Option {
+	return func(s *ClaudeService) {
+		s.maxImages = maxImages
+		s.maxImageBytes = maxTotalBytes
+	}
+}
+
+// checkImages enforces the image limits and checks that each image decodes
+// as its declared format within Claude's dimension limits. The size budget
+// is checked from the encoded length before decoding, so an oversized
+// request is rejected without being decoded in full.
+func (s *ClaudeService) checkImages(images []Image) error {
+	if s.maxImages > 0 && len(images) > s.maxImages {
+		return fmt.Errorf("%w: %d images exceed the limit of %d", ErrTooManyImages, len(images), s.maxImages)
+	}
+	total := 0
+	for i, img := range images {
+		total += base64.StdEncoding.DecodedLen(len(img.Data))
+		if s.maxImageBytes > 0 && total > s.maxImageBytes {
+			return fmt.Errorf("%w: images exceed the limit of %d decoded bytes", ErrImagesTooLarge, s.maxImageBytes)
+		}
+		format, ok := imageFormats[img.MediaType]
+		if !ok {
+			return fmt.Errorf("%w: image %d has unsupported media type %q", ErrInvalidImage, i, img.MediaType)
+		}
+		data, err := base64.StdEncoding.DecodeString(img.Data)
+		if err != nil {
+			return fmt.Errorf("%w: image %d is not valid base64", ErrInvalidImage, i)
+		}
+		cfg, got, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: image %d does not decode: %v", ErrInvalidImage, i, err)
+		}
+		if got != format {
+			return fmt.Errorf("%w: image %d is %s, not %s", ErrInvalidImage, i, got, img.MediaType)
+		}
+		if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+			return fmt.Errorf("%w: image %d is %dx%d, larger than %dx%d", ErrInvalidImage, i, cfg.Width, cfg.Height, maxImageDimension, maxImageDimension)
+		}
+	}
+	return nil
+}
+
+// imageBlock is an image content block of a Messages API request.
+type imageBlock struct {
+	Type   string      `json:"type"` // Always "image"
+	Source imageSource `json:"source"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"` // Always "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// textBlock is a text content block of a Messages API request.
+type textBlock struct {
+	Type string `json:"type"` // Always "text"
+	Text string `json:"text"`
+}
+
+// userContent returns the user message content: the prompt alone, or the
+// images followed by the prompt when there are any.
+func userContent(prompt string, images []Image) interface{} {
+	if len(images) == 0 {
+		return prompt
+	}
+	blocks := make([]interface{}, 0, len(images)+1)
+	for _, img := range images {
+		blocks = append(blocks, imageBlock{
+			Type:   "image",
+			Source: imageSource{Type: "base64", MediaType: img.MediaType, Data: img.Data},
+		})
+	}
+	return append(blocks, textBlock{Type: "text", Text: prompt})
+}
@@ -0,0 +1,88 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+// pngImage returns a blank PNG of the given size.
+func pngImage(t *testing.T, width, height int) Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return Image{MediaType: "image/png", Data: base64.StdEncoding.EncodeToString(buf.Bytes())}
+}
+
+func TestOutboundAllowlistGatesImages(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		allowlist []string
+		sent      bool
+	}{
+		{"no allowlist", nil, true},
+		{"images allowlisted", []string{"technical_data.captcha_solved", "images"}, true},
+		{"images not allowlisted", []string{"technical_data.captcha_solved"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var blocks int
+			stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+				if content, ok := req.Messages[0].Content.([]interface{}); ok {
+					blocks = len(content)
+				}
+				writeMessage(w, req.Model, decisionText(true, 0.9, "Consistent signals."))
+			})
+			s := newStubService(t, stub, WithOutboundAllowlist(tc.allowlist))
+
+			input := testInput()
+			input.Images = []Image{pngImage(t, 4, 4), pngImage(t, 8, 8)}
+			if _, err := s.AnalyzeDataForLiveness(t.Context(), input); err != nil {
+				t.Fatalf("AnalyzeDataForLiveness: %v", err)
+			}
+			if sent := blocks == 3; sent != tc.sent {
+				t.Errorf("images sent = %t (%d content blocks), want %t", sent, blocks, tc.sent)
+			}
+			wantDropped := int64(2)
+			if tc.sent {
+				wantDropped = 0
+			}
+			if got := s.Stats().OutboundImagesDropped; got != wantDropped {
+				t.Errorf("OutboundImagesDropped = %d, want %d", got, wantDropped)
+			}
+		})
+	}
+}
+
+func TestImageLimits(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	small := pngImage(t, 4, 4)
+	size := base64.StdEncoding.DecodedLen(len(small.Data))
+	s := newStubService(t, stub, WithImageLimits(3, 2*size))
+
+	for _, tc := range []struct {
+		name   string
+		images []Image
+		want   error
+	}{
+		{"within limits", []Image{small, small}, nil},
+		{"too many", []Image{small, small, small, small}, ErrTooManyImages},
+		{"too large", []Image{small, small, small}, ErrImagesTooLarge},
+		{"wrong media type", []Image{{MediaType: "image/jpeg", Data: small.Data}}, ErrInvalidImage},
+	} {
+		input := testInput()
+		input.Images = tc.images
+		_, err := s.AnalyzeDataForLiveness(t.Context(), input)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want only the request within limits", n)
+	}
+}
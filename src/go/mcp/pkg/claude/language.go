@@ -0,0 +1,85 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultLanguage is the language of reasoning when a request asks for
+// none, and the language of reasoning generated locally.
+const DefaultLanguage = "en"
+
+// language is the reasoning language chosen for a request.
+type language struct {
+	tag string
+	// fallback is set when the request asked for languages, none of which
+	// could be served.
+	fallback bool
+}
+
+// WithLanguages sets the languages reasoning may be requested in and the
+// one used when a request asks for none of them. Tags are BCP 47 (en,
+// pt-BR); the JSON fields and category tags stay in English regardless.
+func WithLanguages(allowed []string, def string) Option {
+	return func(s *ClaudeService) {
+		s.languages = allowed
+		s.defaultLanguage = def
+	}
+}
+
+// ValidateLanguageTag reports whether tag looks like a BCP 47 language tag:
+// hyphen-separated alphanumeric subtags, the first of 2-8 letters.
+func ValidateLanguageTag(tag string) error {
+	for i, sub := range strings.Split(tag, "-") {
+		ok := len(sub) >= 1 && len(sub) <= 8
+		for _, c := range sub {
+			isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+			ok = ok && (isLetter || i > 0 && c >= '0' && c <= '9')
+		}
+		if !ok || i == 0 && len(sub) < 2 {
+			return fmt.Errorf("invalid language tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// resolveLanguage picks the first of the requested tags, in preference
+// order, that is allowed, matching on the primary subtag when there is no
+// exact match (de-AT is served as de). With no usable preference the
+// default is returned, flagged as a fallback if any was requested.
+func (s *ClaudeService) resolveLanguage(requested []string) language {
+	for _, tag := range requested {
+		for _, allowed := range s.languages {
+			if strings.EqualFold(allowed, tag) {
+				return language{tag: allowed}
+			}
+		}
+		base, _, _ := strings.Cut(tag, "-")
+		for _, allowed := range s.languages {
+			if allowedBase, _, _ := strings.Cut(allowed, "-"); strings.EqualFold(allowedBase, base) {
+				return language{tag: allowed}
+			}
+		}
+	}
+	return language{tag: s.defaultLanguage, fallback: len(requested) > 0}
+}
+
+// languageInstruction returns the system prompt addition asking for
+// reasoning in tag, or nothing for DefaultLanguage.
+func languageInstruction(tag string) string {
+	if strings.EqualFold(tag, DefaultLanguage) {
+		return ""
+	}
+	return fmt.Sprintf("\n\nWrite the \"reasoning\" (and any \"factors\") in the language with BCP 47 tag %s. Keep the JSON field names and category tags exactly as given, in English.", tag)
+}
+
+// apply records lang on result. Reasoning written locally rather than by
+// Claude is always in DefaultLanguage.
+func (lang language) apply(result *LivenessAnalysisResult) {
+	tag, fallback := lang.tag, lang.fallback
+	if result.RuleOnly || result.Override != "" || result.ReasoningSynthesized {
+		fallback = fallback || !strings.EqualFold(tag, DefaultLanguage)
+		tag = DefaultLanguage
+	}
+	result.Language, result.LanguageFallback = tag, fallback
+}
@@ -0,0 +1,75 @@
+package claude
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReasoningLanguage(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	s := newStubService(t, stub, WithLanguages([]string{"en", "de", "fr"}, "en"), WithCache(time.Minute, 0))
+
+	for _, tc := range []struct {
+		requested   []string
+		want        string
+		fallback    bool
+		instruction string // Empty when the prompt should ask for no language
+	}{
+		{nil, "en", false, ""},
+		{[]string{"de"}, "de", false, "BCP 47 tag de."},
+		{[]string{"FR-ca", "de"}, "fr", false, "BCP 47 tag fr."},       // Matched by primary subtag
+		{[]string{"ja", "de-AT", "fr"}, "de", false, "BCP 47 tag de."}, // First servable preference wins
+		{[]string{"ja", "pt-BR"}, "en", true, ""},                      // Nothing servable
+	} {
+		calls := stub.calls.Load()
+		result, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{Languages: tc.requested})
+		if err != nil {
+			t.Fatalf("%v: AnalyzeDataForLivenessWithOptions: %v", tc.requested, err)
+		}
+		if result.Language != tc.want || result.LanguageFallback != tc.fallback {
+			t.Errorf("%v: language = %q, fallback %t; want %q, %t", tc.requested, result.Language, result.LanguageFallback, tc.want, tc.fallback)
+		}
+		if stub.calls.Load() == calls {
+			continue // Served from the cache entry of an earlier case in the same language
+		}
+		body := stub.lastBody()
+		if tc.instruction == "" && strings.Contains(body, "BCP 47 tag") {
+			t.Errorf("%v: prompt asks for a language: %s", tc.requested, body)
+		}
+		if tc.instruction != "" && !strings.Contains(body, tc.instruction) {
+			t.Errorf("%v: prompt lacks %q: %s", tc.requested, tc.instruction, body)
+		}
+	}
+	// Each language is cached separately: en, de and fr.
+	if n := stub.calls.Load(); n != 3 {
+		t.Errorf("Claude calls = %d, want one per language", n)
+	}
+}
+
+func TestLocalReasoningIsDefaultLanguage(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	s := newStubService(t, stub, WithLanguages([]string{"en", "de"}, "en"))
+	s.SetRuleOnly(true)
+
+	result, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{Languages: []string{"de"}})
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLivenessWithOptions: %v", err)
+	}
+	if !result.RuleOnly || result.Language != DefaultLanguage || !result.LanguageFallback {
+		t.Errorf("rule-only result = %+v, want English reasoning flagged as a fallback", result)
+	}
+}
+
+func TestValidateLanguageTag(t *testing.T) {
+	for _, tag := range []string{"en", "de-AT", "zh-Hant-TW"} {
+		if err := ValidateLanguageTag(tag); err != nil {
+			t.Errorf("ValidateLanguageTag(%q): %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"", "e", "en_US", "de-", "en-subtagtoolong"} {
+		if ValidateLanguageTag(tag) == nil {
+			t.Errorf("ValidateLanguageTag(%q) succeeded", tag)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package claude
+
+import "github.com/example-user/mcp-go/pkg/metrics"
+
+// serviceMetrics are the Prometheus metrics recorded by ClaudeService.
+type serviceMetrics struct {
+	inputTokens   *metrics.Histogram
+	outputTokens  *metrics.Histogram
+	promptBytes   *metrics.Histogram
+	responseBytes *metrics.Histogram
+	latency       *metrics.Histogram
+
+	shadowEvaluations *metrics.Counter
+	shadowAgreements  *metrics.Counter
+
+	sessionRateLimited *metrics.Counter
+
+	hedges    *metrics.Counter
+	hedgeWins *metrics.Counter
+}
+
+func newServiceMetrics(r *metrics.Registry) *serviceMetrics {
+	tokenBuckets := metrics.ExponentialBuckets(64, 2, 12) // 64 .. 131072 tokens
+	byteBuckets := metrics.ExponentialBuckets(256, 2, 14) // 256 B .. 2 MiB
+	return &serviceMetrics{
+		inputTokens:   r.NewHistogram("mcp_claude_input_tokens", "Input tokens billed per Claude analysis.", tokenBuckets),
+		outputTokens:  r.NewHistogram("mcp_claude_output_tokens", "Output tokens billed per Claude analysis.", tokenBuckets),
+		promptBytes:   r.NewHistogram("mcp_claude_prompt_bytes", "Size in bytes of each Claude request body.", byteBuckets),
+		responseBytes: r.NewHistogram("mcp_claude_response_bytes", "Size in bytes of each Claude response body.", byteBuckets),
+		latency:       r.NewHistogram("mcp_claude_request_duration_seconds", "Latency of each Claude API call.", metrics.ExponentialBuckets(0.1, 2, 10)),
+
+		shadowEvaluations: r.NewCounter("mcp_shadow_evaluations_total", "Sampled requests whose shadow model decision was compared with the served one."),
+		shadowAgreements:  r.NewCounter("mcp_shadow_agreements_total", "Shadow evaluations that agreed with the served decision."),
+
+		sessionRateLimited: r.NewCounter("mcp_session_rate_limited_total", "Analyses rejected because their session exceeded its limit."),
+
+		hedges:    r.NewCounter("mcp_claude_hedged_requests_total", "Hedged Claude requests sent because the first had not answered in time."),
+		hedgeWins: r.NewCounter("mcp_claude_hedge_wins_total", "Hedged Claude requests that answered before the original."),
+	}
+}
+
+// WithMetrics registers the service's metrics in r. Without it the service
+// records into a private registry that is never served.
+func WithMetrics(r *metrics.Registry) Option {
+	return func(s *ClaudeService) { s.registry = r }
+}
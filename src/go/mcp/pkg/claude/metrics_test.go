@@ -0,0 +1,63 @@
+package claude
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+	"github.com/example-user/mcp-go/pkg/trace"
+)
+
+func TestSizeHistogramsObserveAnalysis(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	registry := metrics.NewRegistry()
+	s := newStubService(t, stub, WithMetrics(registry))
+
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	for name, h := range map[string]*metrics.Histogram{
+		"input tokens":   s.metrics.inputTokens,
+		"output tokens":  s.metrics.outputTokens,
+		"prompt bytes":   s.metrics.promptBytes,
+		"response bytes": s.metrics.responseBytes,
+		"latency":        s.metrics.latency,
+	} {
+		if n := h.Count(); n != 1 {
+			t.Errorf("%s histogram observed %d values, want 1", name, n)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	// The stub bills 100 input and 20 output tokens per call.
+	for _, want := range []string{"mcp_claude_input_tokens_sum 100\n", "mcp_claude_output_tokens_sum 20\n", "mcp_claude_prompt_bytes_count 1\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+	if !strings.Contains(body, `mcp_claude_input_tokens_bucket{le="128"} 1`) {
+		t.Errorf("100 input tokens not counted in the 128 bucket:\n%s", body)
+	}
+}
+
+func TestLatencyExemplarCarriesTraceID(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	registry := metrics.NewRegistry()
+	s := newStubService(t, stub, WithMetrics(registry))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	if _, err := s.AnalyzeDataForLiveness(trace.NewContext(t.Context(), traceID), testInput()); err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, req)
+	if want := `# {trace_id="` + traceID + `"}`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("latency histogram lacks exemplar %s:\n%s", want, rec.Body)
+	}
+}
@@ -0,0 +1,237 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelPricing is the price of a model in US dollars per million tokens.
+type ModelPricing struct {
+	InputPerMTok  float64 `json:"input_per_mtok"`
+	OutputPerMTok float64 `json:"output_per_mtok"`
+}
+
+// Cost returns the price of a call that used the given token counts.
+func (p ModelPricing) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.InputPerMTok + float64(outputTokens)*p.OutputPerMTok) / 1e6
+}
+
+// defaultPricing holds built-in list prices keyed by model ID prefix, so that
+// dated snapshots (e.g. claude-sonnet-4-20250514) match their family. The
+// longest matching prefix wins.
+var defaultPricing = map[string]ModelPricing{
+	"claude-opus-4":     {InputPerMTok: 15, OutputPerMTok: 75},
+	"claude-sonnet-4":   {InputPerMTok: 3, OutputPerMTok: 15},
+	"claude-haiku-4":    {InputPerMTok: 1, OutputPerMTok: 5},
+	"claude-3-7-sonnet": {InputPerMTok: 3, OutputPerMTok: 15},
+	"claude-3-5-sonnet": {InputPerMTok: 3, OutputPerMTok: 15},
+	"claude-3-5-haiku":  {InputPerMTok: 0.8, OutputPerMTok: 4},
+	"claude-3-opus":     {InputPerMTok: 15, OutputPerMTok: 75},
+	"claude-3-haiku":    {InputPerMTok: 0.25, OutputPerMTok: 1.25},
+}
+
+// builtinModels are model IDs with built-in pricing that downgrades may
+// pick from before the Models API has been queried.
+var builtinModels = []string{
+	"claude-opus-4-20250514",
+	"claude-sonnet-4-20250514",
+	"claude-3-7-sonnet-20250219",
+	"claude-3-5-sonnet-20241022",
+	"claude-3-5-haiku-20241022",
+	"claude-3-haiku-20240307",
+}
+
+// ModelInfo describes a model returned by the Models API.
+type ModelInfo struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// modelCatalog is the concurrency-safe view of the available models and
+// their prices. Until the Models API has been queried successfully, it only
+// knows the built-in pricing and accepts every model.
+type modelCatalog struct {
+	mu        sync.RWMutex
+	models    map[string]ModelInfo
+	overrides map[string]ModelPricing
+	fetchedAt time.Time
+}
+
+func (c *modelCatalog) pricing(model string) (ModelPricing, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if p, ok := c.overrides[model]; ok {
+		return p, true
+	}
+	return lookupPrefix(defaultPricing, model)
+}
+
+// lookupPrefix returns the entry of table whose key is the longest prefix of
+// model.
+func lookupPrefix[V any](table map[string]V, model string) (V, bool) {
+	var best string
+	for prefix := range table {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	v, ok := table[best]
+	return v, ok
+}
+
+// known reports whether model is available. It returns true when the
+// catalog has not been loaded, since there is nothing to validate against.
+func (c *modelCatalog) known(model string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.models == nil {
+		return true
+	}
+	_, ok := c.models[model]
+	return ok
+}
+
+// cheapest returns the model with the lowest combined input and output
+// price: among the catalog models once the catalog has been loaded, and
+// before that among the built-in models and those with overridden prices.
+func (c *modelCatalog) cheapest() (string, bool) {
+	c.mu.RLock()
+	var ids []string
+	if c.models != nil {
+		for id := range c.models {
+			ids = append(ids, id)
+		}
+	} else {
+		ids = append(ids, builtinModels...)
+		for id := range c.overrides {
+			ids = append(ids, id)
+		}
+	}
+	c.mu.RUnlock()
+
+	var best string
+	bestPrice := 0.0
+	for _, id := range ids {
+		p, ok := c.pricing(id)
+		if !ok {
+			continue
+		}
+		if price := p.InputPerMTok + p.OutputPerMTok; best == "" || price < bestPrice || price == bestPrice && id < best {
+			best, bestPrice = id, price
+		}
+	}
+	return best, best != ""
+}
+
+func (c *modelCatalog) replace(models []ModelInfo) {
+	m := make(map[string]ModelInfo, len(models))
+	for _, info := range models {
+		m[info.ID] = info
+	}
+	c.mu.Lock()
+	c.models = m
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+}
+
+// WithModelPricing overrides the built-in price for the given model IDs.
+func WithModelPricing(pricing map[string]ModelPricing) Option {
+	return func(s *ClaudeService) {
+		s.catalog.mu.Lock()
+		defer s.catalog.mu.Unlock()
+		s.catalog.overrides = make(map[string]ModelPricing, len(pricing))
+		for model, p := range pricing {
+			s.catalog.overrides[model] = p
+		}
+	}
+}
+
+// WarmupModels queries the Models API and caches the available models, then
+// validates the configured model against them. On failure the service keeps
+// running on the built-in defaults and the error is returned for logging.
+func (s *ClaudeService) WarmupModels(ctx context.Context) error {
+	models, err := s.listModels(ctx)
+	if err != nil {
+		return err
+	}
+	s.catalog.replace(models)
+	log.Printf("ClaudeService: Loaded %d models from the Models API", len(models))
+
+	if !s.catalog.known(s.model) {
+		log.Printf("ClaudeService: Warning: configured model %q is not listed by the Models API", s.model)
+	}
+	if _, ok := s.catalog.pricing(s.model); !ok {
+		log.Printf("ClaudeService: Warning: no pricing known for model %q; cost estimates will be zero", s.model)
+	}
+	return nil
+}
+
+// RefreshModels re-runs WarmupModels every interval until ctx is done.
+func (s *ClaudeService) RefreshModels(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.WarmupModels(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("ClaudeService: Model refresh failed, keeping previous catalog: %v", err)
+			}
+		}
+	}
+}
+
+// listModels pages through GET /v1/models.
+func (s *ClaudeService) listModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	afterID := ""
+	for {
+		q := url.Values{"limit": {"1000"}}
+		if afterID != "" {
+			q.Set("after_id", afterID)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(s.baseURL, "/")+"/v1/models?"+q.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating models request: %w", err)
+		}
+		req.Header.Set("x-api-key", s.apiKey)
+		req.Header.Set("anthropic-version", anthropicVersion)
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("listing models: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading models response: %w", err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		}
+
+		var page struct {
+			Data    []ModelInfo `json:"data"`
+			HasMore bool        `json:"has_more"`
+			LastID  string      `json:"last_id"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("decoding models response: %w", err)
+		}
+		models = append(models, page.Data...)
+		if !page.HasMore || page.LastID == "" {
+			return models, nil
+		}
+		afterID = page.LastID
+	}
+}
@@ -0,0 +1,100 @@
+package claude
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// modelsStub serves GET /v1/models one model per page, as the Models API
+// pages with after_id.
+func modelsStub(t *testing.T, ids ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("x-api-key") == "" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		i := 0
+		if after := r.URL.Query().Get("after_id"); after != "" {
+			for i < len(ids) && ids[i] != after {
+				i++
+			}
+			i++
+		}
+		page := map[string]any{"data": []ModelInfo{}, "has_more": false}
+		if i < len(ids) {
+			page = map[string]any{
+				"data":     []ModelInfo{{ID: ids[i], DisplayName: "Model " + strconv.Itoa(i)}},
+				"has_more": i < len(ids)-1,
+				"last_id":  ids[i],
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheapestBeforeCatalogLoads(t *testing.T) {
+	s, err := NewService("test-key")
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if got, ok := s.catalog.cheapest(); !ok || got != "claude-3-haiku-20240307" {
+		t.Errorf("cheapest = %q, %t; want the cheapest built-in model", got, ok)
+	}
+
+	s, err = NewService("test-key", WithModelPricing(map[string]ModelPricing{"custom-mini": {InputPerMTok: 0.1, OutputPerMTok: 0.1}}))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if got, _ := s.catalog.cheapest(); got != "custom-mini" {
+		t.Errorf("cheapest with an override = %q, want custom-mini", got)
+	}
+}
+
+func TestWarmupModelsLoadsCatalog(t *testing.T) {
+	srv := modelsStub(t, "claude-sonnet-4-20250514", "claude-3-5-haiku-20241022", "unpriced-model")
+	s, err := NewService("test-key", WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if err := s.WarmupModels(t.Context()); err != nil {
+		t.Fatalf("WarmupModels: %v", err)
+	}
+	for _, id := range []string{"claude-sonnet-4-20250514", "unpriced-model"} {
+		if !s.catalog.known(id) {
+			t.Errorf("%s not in catalog after paging", id)
+		}
+	}
+	if s.catalog.known("claude-3-haiku-20240307") {
+		t.Error("unlisted model reported as known")
+	}
+	// Only listed models are candidates once the catalog is loaded.
+	if got, _ := s.catalog.cheapest(); got != "claude-3-5-haiku-20241022" {
+		t.Errorf("cheapest = %q, want claude-3-5-haiku-20241022", got)
+	}
+}
+
+func TestWarmupModelsFailureKeepsDefaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	s, err := NewService("test-key", WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if err := s.WarmupModels(t.Context()); err == nil {
+		t.Fatal("WarmupModels succeeded against a failing endpoint")
+	}
+	if !s.catalog.known("anything") {
+		t.Error("an unloaded catalog should accept every model")
+	}
+	if got, _ := s.catalog.cheapest(); got != "claude-3-haiku-20240307" {
+		t.Errorf("cheapest after failed warmup = %q, want the built-in fallback", got)
+	}
+}
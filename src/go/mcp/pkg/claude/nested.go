@@ -0,0 +1,97 @@
+package claude
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+// DefaultNestedJSONDepth is how many layers of string-encoded JSON are
+// decoded when WithNestedJSONKeys doesn't set a depth.
+const DefaultNestedJSONDepth = 2
+
+// WithNestedJSONKeys decodes technical_data values under keys that arrive as
+// string-encoded JSON objects or arrays, as sent by clients that
+// double-encode their probes, so the rules and the prompt see structured
+// data. Strings inside a decoded value are decoded in turn, up to depth
+// layers in total. A value that isn't valid JSON is left as the original
+// string and logged.
+func WithNestedJSONKeys(keys []string, depth int) Option {
+	return func(s *ClaudeService) {
+		if depth <= 0 {
+			depth = DefaultNestedJSONDepth
+		}
+		s.nestedJSONKeys = keys
+		s.nestedJSONDepth = depth
+	}
+}
+
+// decodeNested returns input with the configured technical_data values
+// decoded. The caller's maps are not modified.
+func (s *ClaudeService) decodeNested(input AnalyzeDataForLivenessInput) AnalyzeDataForLivenessInput {
+	if len(s.nestedJSONKeys) == 0 || len(input.TechnicalData) == 0 {
+		return input
+	}
+	var technical map[string]interface{}
+	for _, key := range s.nestedJSONKeys {
+		str, ok := input.TechnicalData[key].(string)
+		if !ok {
+			continue
+		}
+		v, ok := decodeJSONString("technical_data."+key, str, s.nestedJSONDepth)
+		if !ok {
+			continue
+		}
+		if technical == nil {
+			technical = make(map[string]interface{}, len(input.TechnicalData))
+			for k, v := range input.TechnicalData {
+				technical[k] = v
+			}
+		}
+		technical[key] = v
+	}
+	if technical != nil {
+		input.TechnicalData = technical
+	}
+	return input
+}
+
+// decodeJSONString decodes str if it holds a JSON object or array, then
+// decodes strings nested inside the result until depth layers are used up.
+func decodeJSONString(path, str string, depth int) (interface{}, bool) {
+	if depth <= 0 {
+		return nil, false
+	}
+	trimmed := strings.TrimSpace(str)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		log.Printf("ClaudeService: Leaving %s as a string: not valid nested JSON: %v", path, err)
+		return nil, false
+	}
+	return decodeStrings(path, v, depth-1), true
+}
+
+// decodeStrings replaces string-encoded JSON found anywhere inside v.
+func decodeStrings(path string, v interface{}, depth int) interface{} {
+	if depth <= 0 {
+		return v
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			t[k] = decodeStrings(path+"."+k, child, depth)
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = decodeStrings(path, child, depth)
+		}
+	case string:
+		if decoded, ok := decodeJSONString(path, t, depth); ok {
+			return decoded
+		}
+	}
+	return v
+}
@@ -0,0 +1,64 @@
+package claude
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeNestedJSON(t *testing.T) {
+	s := newStubService(t, newMessagesStub(t, decisionText(true, 0.9, "Fine.")), WithNestedJSONKeys([]string{"probe", "plain", "text", "broken", "layered"}, 2))
+	technical := map[string]interface{}{
+		"probe":   `{"webdriver": false, "plugins": [1, 2]}`,
+		"plain":   map[string]interface{}{"webdriver": false},
+		"text":    "not json",
+		"broken":  `{"webdriver": fal`,
+		"layered": `{"inner": "{\"deeper\": \"[1]\"}"}`,
+		"other":   `{"unlisted": true}`,
+	}
+	original := make(map[string]interface{}, len(technical))
+	for k, v := range technical {
+		original[k] = v
+	}
+
+	got := s.decodeNested(AnalyzeDataForLivenessInput{TechnicalData: technical}).TechnicalData
+	want := map[string]interface{}{
+		"probe":  map[string]interface{}{"webdriver": false, "plugins": []interface{}{1.0, 2.0}},
+		"plain":  map[string]interface{}{"webdriver": false},
+		"text":   "not json",
+		"broken": `{"webdriver": fal`,
+		// Two layers are decoded; the third stays a string.
+		"layered": map[string]interface{}{"inner": map[string]interface{}{"deeper": "[1]"}},
+		"other":   `{"unlisted": true}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded technical_data =\n%#v\nwant\n%#v", got, want)
+	}
+	if !reflect.DeepEqual(technical, original) {
+		t.Error("decodeNested modified the caller's map")
+	}
+}
+
+func TestNestedJSONReachesPrompt(t *testing.T) {
+	for _, probe := range []interface{}{
+		`{"webdriver": true}`,                     // Double-encoded
+		map[string]interface{}{"webdriver": true}, // Plain
+	} {
+		stub := newMessagesStub(t, decisionText(true, 0.9, "Fine."))
+		s := newStubService(t, stub, WithNestedJSONKeys([]string{"probe"}, 0))
+		input := testInput()
+		input.TechnicalData = map[string]interface{}{"probe": probe}
+		if _, err := s.AnalyzeDataForLiveness(t.Context(), input); err != nil {
+			t.Fatalf("probe %v: %v", probe, err)
+		}
+		var req messagesRequest
+		if err := json.Unmarshal([]byte(stub.lastBody()), &req); err != nil {
+			t.Fatalf("decoding request: %v", err)
+		}
+		data, _ := json.Marshal(req.Messages[0].Content)
+		if !strings.Contains(string(data), `\"probe\": {\n      \"webdriver\": true\n    }`) {
+			t.Errorf("probe %v: prompt does not hold the structured probe: %s", probe, data)
+		}
+	}
+}
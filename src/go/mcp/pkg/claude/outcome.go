@@ -0,0 +1,78 @@
+package claude
+
+import "fmt"
+
+// Outcome is the decisive verdict derived from a result's confidence.
+type Outcome string
+
+const (
+	OutcomeLive      Outcome = "live"
+	OutcomeNotLive   Outcome = "not_live"
+	OutcomeUncertain Outcome = "uncertain" // Confidence within the margin of the threshold
+)
+
+// ParseOutcome validates an outcome name.
+func ParseOutcome(name string) (Outcome, error) {
+	switch o := Outcome(name); o {
+	case OutcomeLive, OutcomeNotLive, OutcomeUncertain:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown outcome %q: must be %s, %s or %s", name, OutcomeLive, OutcomeNotLive, OutcomeUncertain)
+}
+
+// DefaultDecisionThreshold is the confidence separating live from not-live
+// outcomes when no threshold is configured.
+const DefaultDecisionThreshold = 0.5
+
+// WithDecisionMargin sets the confidence threshold and the symmetric margin
+// around it. A result is live only when its confidence is at least
+// threshold+margin, not live only when it is at most threshold-margin, and
+// uncertain in between, so decisions near the threshold don't flip-flop.
+func WithDecisionMargin(threshold, margin float64) Option {
+	return func(s *ClaudeService) {
+		s.decisionThreshold = threshold
+		s.decisionMargin = margin
+	}
+}
+
+// ValidateDecisionMargin reports whether threshold and margin describe a
+// usable band inside [0, 1].
+func ValidateDecisionMargin(threshold, margin float64) error {
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("decision threshold must be between 0 and 1, got %v", threshold)
+	}
+	if margin < 0 || threshold-margin < 0 || threshold+margin > 1 {
+		return fmt.Errorf("decision margin %v around threshold %v must stay within [0, 1]", margin, threshold)
+	}
+	return nil
+}
+
+// DecisionBand is a confidence threshold and the symmetric margin around it;
+// see WithDecisionMargin.
+type DecisionBand struct {
+	Threshold float64 `json:"threshold"`
+	Margin    float64 `json:"margin"`
+}
+
+// DecisionBand returns the configured threshold and margin.
+func (s *ClaudeService) DecisionBand() DecisionBand {
+	return DecisionBand{Threshold: s.decisionThreshold, Margin: s.decisionMargin}
+}
+
+// Classify returns the outcome confidence maps to under the configured
+// threshold and margin, without session hysteresis.
+func (s *ClaudeService) Classify(confidence float64) Outcome {
+	return s.DecisionBand().classify(confidence)
+}
+
+// classify returns the outcome confidence maps to within the band.
+func (b DecisionBand) classify(confidence float64) Outcome {
+	switch {
+	case confidence >= b.Threshold+b.Margin:
+		return OutcomeLive
+	case confidence <= b.Threshold-b.Margin:
+		return OutcomeNotLive
+	default:
+		return OutcomeUncertain
+	}
+}
@@ -0,0 +1,46 @@
+package claude
+
+import "testing"
+
+func TestDecisionMarginOutcomes(t *testing.T) {
+	for _, tc := range []struct {
+		confidence float64
+		want       Outcome
+	}{
+		{0.71, OutcomeLive},      // Just outside the margin above
+		{0.69, OutcomeUncertain}, // Just inside it
+		{0.6, OutcomeUncertain},  // On the threshold
+		{0.51, OutcomeUncertain}, // Just inside it below
+		{0.49, OutcomeNotLive},   // Just outside it
+	} {
+		stub := newMessagesStub(t, decisionText(tc.confidence >= 0.6, tc.confidence, "Signals."))
+		s := newStubService(t, stub, WithDecisionMargin(0.6, 0.1))
+		if got := s.Classify(tc.confidence); got != tc.want {
+			t.Errorf("Classify(%v) = %s, want %s", tc.confidence, got, tc.want)
+		}
+		result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+		if err != nil {
+			t.Fatalf("confidence %v: %v", tc.confidence, err)
+		}
+		if result.Outcome != tc.want {
+			t.Errorf("confidence %v: result outcome = %s, want %s", tc.confidence, result.Outcome, tc.want)
+		}
+	}
+}
+
+func TestValidateDecisionMargin(t *testing.T) {
+	for _, tc := range []struct {
+		threshold, margin float64
+		ok                bool
+	}{
+		{0.5, 0, true},
+		{0.5, 0.5, true},
+		{0.8, 0.25, false},
+		{0.5, -0.1, false},
+		{1.2, 0, false},
+	} {
+		if err := ValidateDecisionMargin(tc.threshold, tc.margin); (err == nil) != tc.ok {
+			t.Errorf("ValidateDecisionMargin(%v, %v) = %v, want ok=%t", tc.threshold, tc.margin, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package claude
+
+import (
+	"fmt"
+	"log"
+)
+
+// OverridePrecedence decides which list wins for a session that is on both
+// the allowlist and the denylist.
+type OverridePrecedence string
+
+const (
+	DenyWins  OverridePrecedence = "deny"
+	AllowWins OverridePrecedence = "allow"
+)
+
+// ParseOverridePrecedence validates a precedence name. Empty selects
+// DenyWins.
+func ParseOverridePrecedence(s string) (OverridePrecedence, error) {
+	switch p := OverridePrecedence(s); p {
+	case "":
+		return DenyWins, nil
+	case DenyWins, AllowWins:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown override precedence %q (want deny or allow)", s)
+	}
+}
+
+// SessionOverrides force the decision for listed sessions without
+// consulting Claude or the rules. Sessions are identified by the SessionKey
+// field of session_data.
+type SessionOverrides struct {
+	Allow      []string
+	Deny       []string
+	SessionKey string
+	// Precedence applies when a session is on both lists.
+	Precedence OverridePrecedence
+}
+
+// overrides is the lookup form of SessionOverrides.
+type overrides struct {
+	allow, deny map[string]bool
+	sessionKey  string
+	precedence  OverridePrecedence
+}
+
+// WithSessionOverrides enables forced decisions for the sessions on the
+// allow and deny lists. Empty lists disable overrides.
+func WithSessionOverrides(o SessionOverrides) Option {
+	return func(s *ClaudeService) {
+		if len(o.Allow) == 0 && len(o.Deny) == 0 {
+			s.overrides = nil
+			return
+		}
+		ov := &overrides{
+			allow:      make(map[string]bool, len(o.Allow)),
+			deny:       make(map[string]bool, len(o.Deny)),
+			sessionKey: o.SessionKey,
+			precedence: o.Precedence,
+		}
+		if ov.sessionKey == "" {
+			ov.sessionKey = DefaultSessionKey
+		}
+		if ov.precedence == "" {
+			ov.precedence = DenyWins
+		}
+		for _, id := range o.Allow {
+			ov.allow[id] = true
+		}
+		for _, id := range o.Deny {
+			ov.deny[id] = true
+			if ov.allow[id] {
+				log.Printf("ClaudeService: Warning: session %q is on both the allow and deny lists; %s wins", id, ov.precedence)
+			}
+		}
+		s.overrides = ov
+	}
+}
+
+// overrideResult returns the forced decision for input's session, or nil
+// if the session is on neither list.
+func (s *ClaudeService) overrideResult(input AnalyzeDataForLivenessInput) *LivenessAnalysisResult {
+	if s.overrides == nil {
+		return nil
+	}
+	id := sessionIDFrom(input, s.overrides.sessionKey)
+	if id == "" {
+		return nil
+	}
+	allowed, denied := s.overrides.allow[id], s.overrides.deny[id]
+	conflict := allowed && denied
+	if conflict {
+		log.Printf("ClaudeService: Warning: session %q matches both the allow and deny lists; applying %s", id, s.overrides.precedence)
+		allowed = s.overrides.precedence == AllowWins
+		denied = !allowed
+	}
+	switch {
+	case allowed:
+		return &LivenessAnalysisResult{
+			IsLikelyLive:     true,
+			Confidence:       1,
+			Reasoning:        "Session is on the allowlist.",
+			Override:         "allow",
+			OverrideConflict: conflict,
+		}
+	case denied:
+		return &LivenessAnalysisResult{
+			IsLikelyLive:     false,
+			Confidence:       0,
+			Reasoning:        "Session is on the denylist.",
+			Override:         "deny",
+			OverrideConflict: conflict,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package claude
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger to a buffer for the rest of
+// the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestOverrideConflictPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		precedence OverridePrecedence
+		live       bool
+		override   string
+	}{
+		{"", false, "deny"}, // Deny wins by default
+		{DenyWins, false, "deny"},
+		{AllowWins, true, "allow"},
+	} {
+		logs := captureLog(t)
+		stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+		s := newStubService(t, stub, WithSessionOverrides(SessionOverrides{
+			Allow:      []string{"s1", "s2"},
+			Deny:       []string{"s1"},
+			Precedence: tc.precedence,
+		}))
+		if !strings.Contains(logs.String(), `session "s1" is on both the allow and deny lists`) {
+			t.Errorf("precedence %q: conflict not logged at configuration: %s", tc.precedence, logs)
+		}
+
+		logs.Reset()
+		result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+		if err != nil {
+			t.Fatalf("precedence %q: AnalyzeDataForLiveness: %v", tc.precedence, err)
+		}
+		if result.IsLikelyLive != tc.live || result.Override != tc.override || !result.OverrideConflict {
+			t.Errorf("precedence %q: result live %t, override %q, conflict %t; want %t, %q, true",
+				tc.precedence, result.IsLikelyLive, result.Override, result.OverrideConflict, tc.live, tc.override)
+		}
+		if !strings.Contains(logs.String(), `session "s1" matches both the allow and deny lists`) {
+			t.Errorf("precedence %q: conflict not logged for the request: %s", tc.precedence, logs)
+		}
+		if n := stub.calls.Load(); n != 0 {
+			t.Errorf("precedence %q: Claude calls = %d, want 0", tc.precedence, n)
+		}
+
+		// A session on one list only is not a conflict.
+		input := testInput()
+		input.SessionData = map[string]interface{}{"session_id": "s2"}
+		result, err = s.AnalyzeDataForLiveness(t.Context(), input)
+		if err != nil {
+			t.Fatalf("precedence %q: AnalyzeDataForLiveness: %v", tc.precedence, err)
+		}
+		if result.Override != "allow" || result.OverrideConflict {
+			t.Errorf("precedence %q: allowlisted session: override %q, conflict %t", tc.precedence, result.Override, result.OverrideConflict)
+		}
+	}
+
+	if _, err := ParseOverridePrecedence("first"); err == nil {
+		t.Error("ParseOverridePrecedence accepted an unknown precedence")
+	}
+}
@@ -0,0 +1,68 @@
+package claude
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// policy captures every setting that can change the decision for a given
+// input. Its hash is the policy version: deployments with identical
+// policies share cache entries, and any policy change invalidates them.
+type policy struct {
+	Model                   string   `json:"model"`
+	MaxTokens               int      `json:"max_tokens"`
+	SystemPrompt            string   `json:"system_prompt"`
+	Categories              []string `json:"categories"`
+	RejectEmptyReasoning    bool     `json:"reject_empty_reasoning"`
+	RejectUnknownCategories bool     `json:"reject_unknown_categories"`
+	RejectExtraFields       bool     `json:"reject_extra_fields"`
+	Rules                   []string `json:"rules"`
+}
+
+func (s *ClaudeService) computePolicyVersion() string {
+	p := policy{
+		Model:                   s.model,
+		MaxTokens:               s.maxTokens,
+		SystemPrompt:            buildSystemPrompt(s.promptTemplates[DefaultPromptTemplate], s.categories, s.verbosity, s.defaultLanguage),
+		Categories:              s.categories,
+		RejectEmptyReasoning:    s.rejectEmptyReasoning,
+		RejectUnknownCategories: s.rejectUnknownCategories,
+		RejectExtraFields:       s.rejectExtraFields,
+	}
+	for _, r := range livenessRules {
+		p.Rules = append(p.Rules, r.name)
+	}
+	data, _ := json.Marshal(p) // marshalling plain strings, ints and bools cannot fail
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PolicyVersion returns the short hash identifying the active decision policy.
+func (s *ClaudeService) PolicyVersion() string {
+	return s.policyVersion
+}
+
+// WithCacheSalt mixes salt into every cache and store key. Changing it
+// busts the cache without any policy change.
+func WithCacheSalt(salt string) Option {
+	return func(s *ClaudeService) { s.cacheSalt = salt }
+}
+
+// requestKey identifies an outbound request for caching and storage. It
+// covers the cache salt, the policy version and the request itself, so
+// identical requests under an identical policy share a key.
+func (s *ClaudeService) requestKey(req messagesRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("hashing request: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(s.cacheSalt))
+	h.Write([]byte{0})
+	h.Write([]byte(s.policyVersion))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,56 @@
+package claude
+
+import "testing"
+
+func TestRequestKeyCoversPolicyAndSalt(t *testing.T) {
+	req := messagesRequest{
+		Model:     DefaultModel,
+		MaxTokens: defaultMaxTokens,
+		System:    "Decide.",
+		Messages:  []message{{Role: "user", Content: `{"user_data": {"email": "user@example.com"}}`}},
+	}
+	keyOf := func(t *testing.T, opts ...Option) (key, policy string) {
+		t.Helper()
+		s, err := NewService("test-key", opts...)
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+		key, err = s.requestKey(req)
+		if err != nil {
+			t.Fatalf("requestKey: %v", err)
+		}
+		return key, s.PolicyVersion()
+	}
+
+	base, basePolicy := keyOf(t)
+	if same, samePolicy := keyOf(t); same != base || samePolicy != basePolicy {
+		t.Error("identical deployments derive different keys")
+	}
+
+	salted, saltedPolicy := keyOf(t, WithCacheSalt("bust-1"))
+	if salted == base {
+		t.Error("a cache salt does not change the key")
+	}
+	if saltedPolicy != basePolicy {
+		t.Error("a cache salt changed the policy version")
+	}
+	if resalted, _ := keyOf(t, WithCacheSalt("bust-2")); resalted == salted {
+		t.Error("different salts derive the same key")
+	}
+
+	// Policy changes that leave the outbound request itself untouched
+	// still separate the keys.
+	for name, opt := range map[string]Option{
+		"reject extra fields":  WithRejectExtraFields(true),
+		"reject empty reasons": WithRejectEmptyReasoning(true),
+		"categories":           WithCategories([]string{"bot"}),
+	} {
+		key, policy := keyOf(t, opt)
+		if policy == basePolicy {
+			t.Errorf("%s: policy version unchanged", name)
+		}
+		if key == base {
+			t.Errorf("%s: same key for identical input under a different policy", name)
+		}
+	}
+}
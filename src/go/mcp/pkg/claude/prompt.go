@@ -0,0 +1,140 @@
+package claude
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const systemPromptPreamble = `You are a liveness verification analyst. You receive user, session and technical data collected while a user interacted with an application, and you judge whether the interaction came from a genuine, live human rather than a bot or a replay.`
+
+// buildSystemPrompt returns the system prompt: the analysis instructions
+// followed by the decision schema Claude must reply with, including the
+// reasoning detail for the verbosity and the permitted category tags.
+func buildSystemPrompt(preamble string, categories []string, verbosity Verbosity, lang string) string {
+	var b strings.Builder
+	b.WriteString(preamble)
+	b.WriteString("\n\nRespond with a single JSON object and nothing else, using exactly these fields:\n")
+	b.WriteString(`{"is_likely_live": <boolean>, "confidence": <probability between 0.0 and 1.0 that the interaction is live>, `)
+	b.WriteString(reasoningSchema(verbosity))
+	b.WriteString(`, "categories": [<zero or more category tags>]}`)
+	if len(categories) > 0 {
+		b.WriteString("\n\n\"categories\" lists the reasons the interaction may not be live. Use only these tags: ")
+		b.WriteString(strings.Join(categories, ", "))
+		b.WriteString(". Use an empty list when none apply.")
+	}
+	b.WriteString(languageInstruction(lang))
+	return b.String()
+}
+
+// buildUserPrompt renders the analysis input into the user message sent to
+// Claude, as json.MarshalIndent would. Map keys are emitted in sorted order
+// so identical input always produces an identical prompt.
+//
+// Maps and slices are walked with an explicit stack rather than by
+// recursion, so the prompt can be built for input of any depth even with
+// the depth limit disabled; other values are encoded with encoding/json.
+func buildUserPrompt(input AnalyzeDataForLivenessInput) (string, error) {
+	var b strings.Builder
+	b.WriteString("Analyze the following data for liveness:\n\n")
+
+	root := []promptField{
+		{key: "user_data", value: input.UserData},
+		{key: "session_data", value: input.SessionData},
+		{key: "technical_data", value: input.TechnicalData},
+	}
+	if len(input.Images) > 0 {
+		root = append(root, promptField{key: "images", value: input.Images})
+	}
+	b.WriteByte('{')
+	var stack []promptItem
+	stack = pushFields(stack, root, 0)
+
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !item.isValue {
+			b.WriteString(item.literal)
+			continue
+		}
+		switch v := item.value.(type) {
+		case map[string]interface{}:
+			if v == nil {
+				b.WriteString("null")
+				continue
+			}
+			if len(v) == 0 {
+				b.WriteString("{}")
+				continue
+			}
+			fields := make([]promptField, 0, len(v))
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				fields = append(fields, promptField{key: k, value: v[k]})
+			}
+			b.WriteByte('{')
+			stack = pushFields(stack, fields, item.depth)
+		case []interface{}:
+			if v == nil {
+				b.WriteString("null")
+				continue
+			}
+			if len(v) == 0 {
+				b.WriteString("[]")
+				continue
+			}
+			b.WriteByte('[')
+			indent := "\n" + strings.Repeat(promptIndent, item.depth+1)
+			stack = append(stack, promptItem{literal: "\n" + strings.Repeat(promptIndent, item.depth) + "]"})
+			for i := len(v) - 1; i >= 0; i-- {
+				stack = append(stack, promptItem{isValue: true, value: v[i], depth: item.depth + 1})
+				sep := indent
+				if i > 0 {
+					sep = "," + indent
+				}
+				stack = append(stack, promptItem{literal: sep})
+			}
+		default:
+			data, err := json.MarshalIndent(v, strings.Repeat(promptIndent, item.depth), promptIndent)
+			if err != nil {
+				return "", err
+			}
+			b.Write(data)
+		}
+	}
+	return b.String(), nil
+}
+
+const promptIndent = "  "
+
+// promptField is one member of a JSON object in the prompt.
+type promptField struct {
+	key   string
+	value interface{}
+}
+
+// promptItem is pending prompt output: a literal, or a value to encode at
+// the given indentation depth.
+type promptItem struct {
+	literal string
+	isValue bool
+	value   interface{}
+	depth   int
+}
+
+// pushFields schedules the members and closing brace of an object at depth
+// whose opening brace has been written, so that they pop off stack in order.
+func pushFields(stack []promptItem, fields []promptField, depth int) []promptItem {
+	indent := "\n" + strings.Repeat(promptIndent, depth+1)
+	stack = append(stack, promptItem{literal: "\n" + strings.Repeat(promptIndent, depth) + "}"})
+	for i := len(fields) - 1; i >= 0; i-- {
+		stack = append(stack, promptItem{isValue: true, value: fields[i].value, depth: depth + 1})
+		key, _ := json.Marshal(fields[i].key) // strings cannot fail
+		sep := indent
+		if i > 0 {
+			sep = "," + indent
+		}
+		stack = append(stack, promptItem{literal: sep + string(key) + ": "})
+	}
+	return stack
+}
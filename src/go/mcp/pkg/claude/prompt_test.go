@@ -0,0 +1,88 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// nested returns a technical_data value nesting depth maps deep.
+func nested(depth int) map[string]interface{} {
+	v := interface{}("leaf")
+	for i := 0; i < depth; i++ {
+		v = map[string]interface{}{"n": v}
+	}
+	return v.(map[string]interface{})
+}
+
+func TestBuildUserPromptMatchesMarshalIndent(t *testing.T) {
+	for name, input := range map[string]AnalyzeDataForLivenessInput{
+		"minimal": testInput(),
+		"nil and empty sections": {
+			UserData:    map[string]interface{}{},
+			SessionData: nil,
+		},
+		"mixed values": {
+			UserData: map[string]interface{}{
+				"name":    "<Zoë & co>",
+				"scores":  []interface{}{0.5, 1e21, -3, nil, "x", []interface{}{}, map[string]interface{}{}},
+				"nested":  map[string]interface{}{"b": true, "a": []interface{}{map[string]interface{}{"z": 1, "y": "\n"}}},
+				"typed":   map[string]string{"k": "v"},
+				"nothing": nil,
+			},
+			TechnicalData: nested(12),
+		},
+		"images": {
+			UserData: map[string]interface{}{"a": 1},
+			Images:   []Image{{MediaType: "image/png", Data: "aGk="}},
+		},
+	} {
+		data, err := json.MarshalIndent(input, "", "  ")
+		if err != nil {
+			t.Fatalf("%s: MarshalIndent: %v", name, err)
+		}
+		want := "Analyze the following data for liveness:\n\n" + string(data)
+		got, err := buildUserPrompt(input)
+		if err != nil {
+			t.Fatalf("%s: buildUserPrompt: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: prompt differs from json.MarshalIndent:\ngot:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
+func TestBuildUserPromptHandlesDeepInput(t *testing.T) {
+	// Indentation grows the prompt with the square of the depth; 2000
+	// levels already make several megabytes.
+	prompt, err := buildUserPrompt(AnalyzeDataForLivenessInput{TechnicalData: nested(2000)})
+	if err != nil {
+		t.Fatalf("buildUserPrompt: %v", err)
+	}
+	if n := strings.Count(prompt, `"n": {`); n != 1999 {
+		t.Errorf("prompt holds %d nested objects, want 1999", n)
+	}
+}
+
+func TestNestingDepthLimit(t *testing.T) {
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Fine."))
+	})
+	s := newStubService(t, stub, WithMaxNestingDepth(4))
+
+	// technical_data's own entries are at depth 1; nested(3) adds three
+	// more levels below the "deep" key.
+	atLimit := AnalyzeDataForLivenessInput{TechnicalData: map[string]interface{}{"deep": nested(3)}}
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), atLimit); err != nil {
+		t.Errorf("input at the depth limit: %v", err)
+	}
+	overLimit := AnalyzeDataForLivenessInput{TechnicalData: map[string]interface{}{"deep": nested(4)}}
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), overLimit); !errors.Is(err, ErrInputTooDeep) {
+		t.Errorf("input one level over the limit: error = %v, want ErrInputTooDeep", err)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d; the deep input should be rejected before calling", n)
+	}
+}
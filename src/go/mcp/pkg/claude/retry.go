@@ -0,0 +1,109 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrorClass groups Claude API failures that share a retry policy.
+type ErrorClass string
+
+const (
+	ClassRateLimited  ErrorClass = "rate_limited"  // 429: account-level rate limit
+	ClassOverloaded   ErrorClass = "overloaded"    // 529 or overloaded_error: transient capacity shortage
+	ClassServerError  ErrorClass = "server_error"  // 500
+	ClassUnavailable  ErrorClass = "unavailable"   // 502, 503, 504
+	ClassNonRetryable ErrorClass = "non_retryable" // Everything else
+)
+
+// Class classifies the error for retry purposes.
+func (e *APIError) Class() ErrorClass {
+	switch {
+	case e.Type == "overloaded_error" || e.StatusCode == 529:
+		return ClassOverloaded
+	case e.StatusCode == 429:
+		return ClassRateLimited
+	case e.StatusCode == 500:
+		return ClassServerError
+	case e.StatusCode == 502, e.StatusCode == 503, e.StatusCode == 504:
+		return ClassUnavailable
+	default:
+		return ClassNonRetryable
+	}
+}
+
+// BackoffPolicy describes how a class of errors is retried. The n-th retry
+// (starting at zero) waits Initial * 2^n, capped at Max.
+type BackoffPolicy struct {
+	MaxRetries int
+	Initial    time.Duration
+	Max        time.Duration
+}
+
+// Delay returns the wait before the given retry attempt (starting at zero).
+func (p BackoffPolicy) Delay(attempt int) time.Duration {
+	d := p.Initial
+	for i := 0; i < attempt && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// DefaultRetryPolicies are the backoff policies used for classes not
+// overridden with WithRetryPolicy. Overloaded errors back off longer than
+// rate limits because capacity usually takes longer to recover.
+var DefaultRetryPolicies = map[ErrorClass]BackoffPolicy{
+	ClassRateLimited: {MaxRetries: 2, Initial: 1 * time.Second, Max: 5 * time.Second},
+	ClassOverloaded:  {MaxRetries: 3, Initial: 2 * time.Second, Max: 10 * time.Second},
+	ClassServerError: {MaxRetries: 2, Initial: 250 * time.Millisecond, Max: 2 * time.Second},
+	ClassUnavailable: {MaxRetries: 2, Initial: 500 * time.Millisecond, Max: 4 * time.Second},
+}
+
+// WithRetryPolicy overrides the backoff policy for one error class.
+func WithRetryPolicy(class ErrorClass, policy BackoffPolicy) Option {
+	return func(s *ClaudeService) { s.retryPolicies[class] = policy }
+}
+
+// createMessageWithRetry calls createMessage, retrying API errors according
+// to the policy for their class. A retry is skipped when its delay would
+// overrun the context deadline. The first attempt may be hedged; see
+// WithHedging.
+func (s *ClaudeService) createMessageWithRetry(ctx context.Context, req messagesRequest) (*messagesResponse, string, error) {
+	attempts := make(map[ErrorClass]int)
+	send := s.createMessageHedged
+	for {
+		// Never start a call for a request that is already cancelled.
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		resp, raw, err := send(ctx, req)
+		send = s.createMessage
+		var apiErr *APIError
+		if err == nil || !errors.As(err, &apiErr) {
+			return resp, raw, err
+		}
+
+		class := apiErr.Class()
+		policy, ok := s.retryPolicies[class]
+		if !ok || attempts[class] >= policy.MaxRetries {
+			return resp, raw, err
+		}
+		delay := max(policy.Delay(attempts[class]), min(apiErr.RetryAfter, policy.Max))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, raw, fmt.Errorf("not retrying, deadline too close: %w", err)
+		}
+		attempts[class]++
+
+		log.Printf("ClaudeService: %s error (status %d), retry %d/%d in %s", class, apiErr.StatusCode, attempts[class], policy.MaxRetries, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
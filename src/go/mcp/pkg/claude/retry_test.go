@@ -0,0 +1,101 @@
+package claude
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPIErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err  APIError
+		want ErrorClass
+	}{
+		{APIError{StatusCode: 429}, ClassRateLimited},
+		{APIError{StatusCode: 529}, ClassOverloaded},
+		{APIError{StatusCode: 500, Type: "overloaded_error"}, ClassOverloaded},
+		{APIError{StatusCode: 500}, ClassServerError},
+		{APIError{StatusCode: 502}, ClassUnavailable},
+		{APIError{StatusCode: 503}, ClassUnavailable},
+		{APIError{StatusCode: 504}, ClassUnavailable},
+		{APIError{StatusCode: 400}, ClassNonRetryable},
+	} {
+		if got := tc.err.Class(); got != tc.want {
+			t.Errorf("status %d type %q: Class = %s, want %s", tc.err.StatusCode, tc.err.Type, got, tc.want)
+		}
+	}
+}
+
+func TestBackoffPolicyDelay(t *testing.T) {
+	p := BackoffPolicy{MaxRetries: 5, Initial: 100 * time.Millisecond, Max: 350 * time.Millisecond}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 350 * time.Millisecond, 350 * time.Millisecond} {
+		if got := p.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestRetryUsesPolicyOfErrorClass(t *testing.T) {
+	policies := map[ErrorClass]BackoffPolicy{
+		ClassRateLimited: {MaxRetries: 1, Initial: 40 * time.Millisecond, Max: 40 * time.Millisecond},
+		ClassOverloaded:  {MaxRetries: 3, Initial: time.Millisecond, Max: 2 * time.Millisecond},
+		ClassServerError: {MaxRetries: 2, Initial: time.Millisecond, Max: time.Millisecond},
+		ClassUnavailable: {MaxRetries: 0},
+	}
+	for _, tc := range []struct {
+		status    int
+		calls     int64
+		minElapse time.Duration
+	}{
+		{http.StatusTooManyRequests, 2, 40 * time.Millisecond},
+		{529, 4, 0},
+		{http.StatusInternalServerError, 3, 0},
+		{http.StatusServiceUnavailable, 1, 0},
+		{http.StatusBadRequest, 1, 0},
+	} {
+		stub := newMessagesStubFunc(t, func(w http.ResponseWriter, _ messagesRequest, _ int64) {
+			http.Error(w, `{"type": "error", "error": {"type": "test_error", "message": "failing"}}`, tc.status)
+		})
+		var opts []Option
+		for class, p := range policies {
+			opts = append(opts, WithRetryPolicy(class, p))
+		}
+		s := newStubService(t, stub, opts...)
+
+		start := time.Now()
+		_, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+		elapsed := time.Since(start)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.status {
+			t.Errorf("status %d: error = %v", tc.status, err)
+		}
+		if n := stub.calls.Load(); n != tc.calls {
+			t.Errorf("status %d: %d calls, want %d", tc.status, n, tc.calls)
+		}
+		if elapsed < tc.minElapse {
+			t.Errorf("status %d: retried after %s, want at least %s", tc.status, elapsed, tc.minElapse)
+		}
+	}
+}
+
+func TestRetryAfterExtendsDelayUpToMax(t *testing.T) {
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		if call == 1 {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Fine."))
+	})
+	s := newStubService(t, stub, WithRetryPolicy(ClassRateLimited, BackoffPolicy{MaxRetries: 1, Initial: time.Millisecond, Max: 50 * time.Millisecond}))
+
+	start := time.Now()
+	if _, err := s.AnalyzeDataForLiveness(t.Context(), testInput()); err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	// Retry-After asks for 60s; the policy's Max caps the wait.
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("retried after %s, want about the 50ms cap", elapsed)
+	}
+}
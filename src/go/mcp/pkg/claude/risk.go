@@ -0,0 +1,59 @@
+package claude
+
+import (
+	"fmt"
+	"math"
+)
+
+// RiskPoint maps a confidence that the interaction is live to a risk score.
+type RiskPoint struct {
+	Confidence float64
+	Risk       float64
+}
+
+// RiskMapping turns confidence into a 0-100 risk score by linear
+// interpolation between its points, which are ordered by confidence and
+// cover the whole 0-1 range.
+type RiskMapping []RiskPoint
+
+// DefaultRiskMapping scores risk as round((1 - confidence) * 100).
+var DefaultRiskMapping = RiskMapping{{Confidence: 0, Risk: 100}, {Confidence: 1, Risk: 0}}
+
+// Validate reports whether m is a usable mapping: at least two points,
+// confidences strictly increasing from 0 to 1, and risks within 0-100.
+func (m RiskMapping) Validate() error {
+	if len(m) < 2 {
+		return fmt.Errorf("risk mapping needs at least two points")
+	}
+	if m[0].Confidence != 0 || m[len(m)-1].Confidence != 1 {
+		return fmt.Errorf("risk mapping must start at confidence 0 and end at confidence 1")
+	}
+	for i, p := range m {
+		if p.Risk < 0 || p.Risk > 100 {
+			return fmt.Errorf("risk mapping risk %v at confidence %v is outside 0-100", p.Risk, p.Confidence)
+		}
+		if i > 0 && p.Confidence <= m[i-1].Confidence {
+			return fmt.Errorf("risk mapping confidences must be strictly increasing, got %v after %v", p.Confidence, m[i-1].Confidence)
+		}
+	}
+	return nil
+}
+
+// Score returns the risk score for confidence, rounded to an integer.
+func (m RiskMapping) Score(confidence float64) int {
+	confidence = math.Max(0, math.Min(1, confidence))
+	for i := 1; i < len(m); i++ {
+		lo, hi := m[i-1], m[i]
+		if confidence <= hi.Confidence {
+			f := (confidence - lo.Confidence) / (hi.Confidence - lo.Confidence)
+			return int(math.Round(lo.Risk + f*(hi.Risk-lo.Risk)))
+		}
+	}
+	return int(math.Round(m[len(m)-1].Risk))
+}
+
+// WithRiskMapping sets how results' risk_score is derived from their
+// confidence. m must pass Validate.
+func WithRiskMapping(m RiskMapping) Option {
+	return func(s *ClaudeService) { s.riskMapping = m }
+}
@@ -0,0 +1,70 @@
+package claude
+
+import "testing"
+
+func TestRiskMappingScore(t *testing.T) {
+	custom := RiskMapping{{0, 100}, {0.5, 70}, {0.8, 20}, {1, 0}}
+	for _, tc := range []struct {
+		m          RiskMapping
+		confidence float64
+		want       int
+	}{
+		{DefaultRiskMapping, 0, 100},
+		{DefaultRiskMapping, 0.05, 95},
+		{DefaultRiskMapping, 0.5, 50},
+		{DefaultRiskMapping, 0.834, 17}, // Rounded
+		{DefaultRiskMapping, 0.835, 17},
+		{DefaultRiskMapping, 1, 0},
+		{DefaultRiskMapping, -0.2, 100}, // Clamped
+		{DefaultRiskMapping, 1.3, 0},
+		{custom, 0.25, 85},
+		{custom, 0.5, 70}, // Exactly on a point
+		{custom, 0.65, 45},
+		{custom, 0.83, 17},
+		{custom, 0.9, 10},
+		{custom, 1, 0},
+	} {
+		if got := tc.m.Score(tc.confidence); got != tc.want {
+			t.Errorf("%v.Score(%v) = %d, want %d", tc.m, tc.confidence, got, tc.want)
+		}
+	}
+}
+
+func TestRiskMappingValidate(t *testing.T) {
+	if err := DefaultRiskMapping.Validate(); err != nil {
+		t.Errorf("DefaultRiskMapping: %v", err)
+	}
+	for _, m := range []RiskMapping{
+		nil,
+		{{0, 100}},
+		{{0.1, 100}, {1, 0}},                     // Doesn't start at 0
+		{{0, 100}, {0.9, 0}},                     // Doesn't end at 1
+		{{0, 100}, {0.5, 50}, {0.5, 40}, {1, 0}}, // Not strictly increasing
+		{{0, 120}, {1, 0}},                       // Risk out of range
+		{{0, 100}, {1, -1}},
+	} {
+		if m.Validate() == nil {
+			t.Errorf("%v.Validate() succeeded", m)
+		}
+	}
+}
+
+func TestResultsCarryRiskScore(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.65, "Mixed signals."))
+	s := newStubService(t, stub, WithRiskMapping(RiskMapping{{0, 100}, {0.5, 70}, {0.8, 20}, {1, 0}}))
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if result.RiskScore != 45 {
+		t.Errorf("RiskScore = %d, want 45", result.RiskScore)
+	}
+	s.SetRuleOnly(true)
+	if result, err = s.AnalyzeDataForLiveness(t.Context(), testInput()); err != nil {
+		t.Fatalf("rule-only AnalyzeDataForLiveness: %v", err)
+	}
+	if want := s.riskMapping.Score(result.Confidence); result.RiskScore != want {
+		t.Errorf("rule-only RiskScore = %d, want %d for confidence %v", result.RiskScore, want, result.Confidence)
+	}
+}
@@ -0,0 +1,76 @@
+package claude
+
+import "strings"
+
+// rule is a cheap local liveness signal evaluated without calling Claude.
+type rule struct {
+	name  string
+	match func(input AnalyzeDataForLivenessInput) bool
+	// apply adjusts the running score once the rule has matched.
+	apply  func(score float64) float64
+	reason string
+}
+
+// ruleBaseline is the liveness score before any rule matches.
+const ruleBaseline = 0.3
+
+var livenessRules = []rule{
+	{
+		name:   "captcha_solved",
+		match:  func(in AnalyzeDataForLivenessInput) bool { return in.TechnicalData["captcha_solved"] == true },
+		apply:  func(score float64) float64 { return max(score, 0.7) },
+		reason: "CAPTCHA solved",
+	},
+	{
+		name:  "recent_activity",
+		match: func(in AnalyzeDataForLivenessInput) bool { return in.UserData["has_recent_activity"] == true },
+		apply: func(score float64) float64 {
+			if score >= 0.5 {
+				return min(0.9, score+0.2)
+			}
+			return 0.6
+		},
+		reason: "recent user activity",
+	},
+}
+
+// ruleOutcome is the result of evaluating the local rules.
+type ruleOutcome struct {
+	Score     float64
+	Triggered []string
+	reasons   []string
+}
+
+// evaluateRules runs every rule against input in order.
+func evaluateRules(input AnalyzeDataForLivenessInput) ruleOutcome {
+	out := ruleOutcome{Score: ruleBaseline}
+	for _, r := range livenessRules {
+		if r.match(input) {
+			out.Score = r.apply(out.Score)
+			out.Triggered = append(out.Triggered, r.name)
+			out.reasons = append(out.reasons, r.reason)
+		}
+	}
+	return out
+}
+
+// WithRuleScore adds the local rules' score and the names of the rules that
+// matched to every result, including those Claude decided, for comparison.
+func WithRuleScore(include bool) Option {
+	return func(s *ClaudeService) { s.includeRuleScore = include }
+}
+
+// ruleOnlyResult turns a rule outcome into a decision, used when Claude is
+// not consulted.
+func ruleOnlyResult(out ruleOutcome) *LivenessAnalysisResult {
+	reasoning := "Rule-only analysis: no distinct liveness signals."
+	if len(out.reasons) > 0 {
+		reasoning = "Rule-only analysis: " + strings.Join(out.reasons, ", ") + "."
+	}
+	return &LivenessAnalysisResult{
+		IsLikelyLive: out.Score >= 0.5,
+		Confidence:   out.Score,
+		Reasoning:    reasoning,
+		RuleOnly:     true,
+	}
+}
@@ -0,0 +1,76 @@
+package claude
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEvaluateRules(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		technical map[string]interface{}
+		user      map[string]interface{}
+		score     float64
+		triggered []string
+	}{
+		{"none", nil, nil, ruleBaseline, nil},
+		{"captcha", map[string]interface{}{"captcha_solved": true}, nil, 0.7, []string{"captcha_solved"}},
+		{"activity", nil, map[string]interface{}{"has_recent_activity": true}, 0.6, []string{"recent_activity"}},
+		{"both", map[string]interface{}{"captcha_solved": true}, map[string]interface{}{"has_recent_activity": true}, 0.9, []string{"captcha_solved", "recent_activity"}},
+		{"not literally true", map[string]interface{}{"captcha_solved": "yes"}, nil, ruleBaseline, nil},
+	} {
+		out := evaluateRules(AnalyzeDataForLivenessInput{TechnicalData: tc.technical, UserData: tc.user})
+		if math.Abs(out.Score-tc.score) > 1e-9 || !slices.Equal(out.Triggered, tc.triggered) {
+			t.Errorf("%s: score %v, triggered %v; want %v, %v", tc.name, out.Score, out.Triggered, tc.score, tc.triggered)
+		}
+	}
+}
+
+func TestRuleScoreInEveryResult(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(false, 0.2, "Scripted."))
+	s := newStubService(t, stub, WithRuleScore(true), WithCache(time.Minute, 0))
+	input := testInput()
+	input.UserData["has_recent_activity"] = true
+	want := evaluateRules(input)
+
+	check := func(path string, result *LivenessAnalysisResult) {
+		t.Helper()
+		if result.RuleScore == nil || math.Abs(*result.RuleScore-want.Score) > 1e-9 || !slices.Equal(result.TriggeredRules, want.Triggered) {
+			t.Errorf("%s: rule_score %v, triggered %v; want %v, %v", path, result.RuleScore, result.TriggeredRules, want.Score, want.Triggered)
+			return
+		}
+		if *result.RuleScore != 0.9 {
+			t.Errorf("%s: rule_score = %v, want it free of floating point noise", path, *result.RuleScore)
+		}
+	}
+	for _, path := range []string{"claude", "cached"} {
+		result, err := s.AnalyzeDataForLiveness(t.Context(), input)
+		if err != nil {
+			t.Fatalf("%s: AnalyzeDataForLiveness: %v", path, err)
+		}
+		if result.IsLikelyLive || result.Confidence != 0.2 {
+			t.Errorf("%s: result = %+v, want Claude's decision", path, result)
+		}
+		check(path, result)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want the second answer cached", n)
+	}
+	s.SetRuleOnly(true)
+	result, err := s.AnalyzeDataForLiveness(t.Context(), input)
+	if err != nil {
+		t.Fatalf("rule-only AnalyzeDataForLiveness: %v", err)
+	}
+	check("rule-only", result)
+
+	// Without the option results carry neither field.
+	result, err = newStubService(t, stub).AnalyzeDataForLiveness(t.Context(), input)
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if result.RuleScore != nil || result.TriggeredRules != nil {
+		t.Errorf("without WithRuleScore: rule_score %v, triggered %v", result.RuleScore, result.TriggeredRules)
+	}
+}
@@ -0,0 +1,122 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSessionRateLimited is returned when a session has used up its
+// analyses for the current window; the error is a *SessionRateLimitError.
+var ErrSessionRateLimited = errors.New("session analysis limit exceeded")
+
+// SessionRateLimitError reports when the limited session may be analyzed
+// again.
+type SessionRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SessionRateLimitError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrSessionRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *SessionRateLimitError) Unwrap() error { return ErrSessionRateLimited }
+
+// MissingSessionPolicy decides how the session limit treats requests
+// without a session identifier.
+type MissingSessionPolicy string
+
+const (
+	MissingSessionBypass MissingSessionPolicy = "bypass" // Not limited
+	MissingSessionShared MissingSessionPolicy = "shared" // Limited together, as one session
+)
+
+// ParseMissingSessionPolicy validates a missing-session policy name. Empty
+// selects MissingSessionBypass.
+func ParseMissingSessionPolicy(s string) (MissingSessionPolicy, error) {
+	switch p := MissingSessionPolicy(s); p {
+	case "":
+		return MissingSessionBypass, nil
+	case MissingSessionBypass, MissingSessionShared:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown missing-session policy %q (want bypass or shared)", s)
+	}
+}
+
+// SessionLimit caps the analyses of one session, identified by the
+// SessionKey field of session_data, to Max per fixed Window.
+type SessionLimit struct {
+	Max        int
+	Window     time.Duration
+	SessionKey string
+	Missing    MissingSessionPolicy
+}
+
+// sessionWindow counts a session's analyses in the window that started at
+// start.
+type sessionWindow struct {
+	start time.Time
+	count int
+}
+
+// sessionLimiter enforces a SessionLimit.
+type sessionLimiter struct {
+	limit SessionLimit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]sessionWindow
+	sweepSize int
+}
+
+// WithSessionLimit limits how often one session can be analyzed, so a
+// single session can't be used to probe the decision. Every analysis
+// counts, including cached and rule-only ones. A Max below 1 disables the
+// limit.
+func WithSessionLimit(l SessionLimit) Option {
+	return func(s *ClaudeService) {
+		if l.Max < 1 || l.Window <= 0 {
+			s.sessionLimit = nil
+			return
+		}
+		if l.SessionKey == "" {
+			l.SessionKey = DefaultSessionKey
+		}
+		s.sessionLimit = &sessionLimiter{limit: l, now: time.Now, windows: make(map[string]sessionWindow), sweepSize: 64}
+	}
+}
+
+// admit counts an analysis of input's session, or returns a
+// *SessionRateLimitError if the session is over its limit.
+func (l *sessionLimiter) admit(input AnalyzeDataForLivenessInput) error {
+	id := sessionIDFrom(input, l.limit.SessionKey)
+	if id == "" && l.limit.Missing != MissingSessionShared {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	w, ok := l.windows[id]
+	if !ok || !now.Before(w.start.Add(l.limit.Window)) {
+		w = sessionWindow{start: now}
+	}
+	if w.count >= l.limit.Max {
+		return &SessionRateLimitError{RetryAfter: w.start.Add(l.limit.Window).Sub(now)}
+	}
+	w.count++
+	l.windows[id] = w
+
+	// Drop ended windows whenever the map has doubled since the last sweep.
+	if len(l.windows) >= l.sweepSize {
+		for k, w := range l.windows {
+			if !now.Before(w.start.Add(l.limit.Window)) {
+				delete(l.windows, k)
+			}
+		}
+		l.sweepSize = max(64, 2*len(l.windows))
+	}
+	return nil
+}
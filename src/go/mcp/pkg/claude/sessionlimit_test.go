@@ -0,0 +1,70 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSessionLimitWindows(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := &sessionLimiter{
+		limit:     SessionLimit{Max: 2, Window: time.Minute, SessionKey: DefaultSessionKey},
+		now:       func() time.Time { return now },
+		windows:   make(map[string]sessionWindow),
+		sweepSize: 64,
+	}
+	session := func(id string) AnalyzeDataForLivenessInput {
+		return AnalyzeDataForLivenessInput{SessionData: map[string]interface{}{DefaultSessionKey: id}}
+	}
+
+	for i := range 2 {
+		if err := l.admit(session("s1")); err != nil {
+			t.Fatalf("analysis %d: %v", i+1, err)
+		}
+	}
+	now = now.Add(20 * time.Second)
+	err := l.admit(session("s1"))
+	var limited *SessionRateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, ErrSessionRateLimited) {
+		t.Fatalf("third analysis: error = %v, want a *SessionRateLimitError", err)
+	}
+	if limited.RetryAfter != 40*time.Second {
+		t.Errorf("RetryAfter = %s, want the 40s left in the window", limited.RetryAfter)
+	}
+	if err := l.admit(session("s2")); err != nil {
+		t.Errorf("other session limited: %v", err)
+	}
+
+	// A new window starts once the old one ends.
+	now = now.Add(40 * time.Second)
+	if err := l.admit(session("s1")); err != nil {
+		t.Errorf("after the window: %v", err)
+	}
+
+	// Session-less requests bypass the limit unless they share a bucket.
+	for range 5 {
+		if err := l.admit(AnalyzeDataForLivenessInput{}); err != nil {
+			t.Fatalf("bypass: session-less request limited: %v", err)
+		}
+	}
+	l.limit.Missing = MissingSessionShared
+	l.admit(AnalyzeDataForLivenessInput{})
+	l.admit(AnalyzeDataForLivenessInput{})
+	if err := l.admit(AnalyzeDataForLivenessInput{}); !errors.Is(err, ErrSessionRateLimited) {
+		t.Errorf("shared: third session-less request error = %v, want ErrSessionRateLimited", err)
+	}
+
+	// Ended windows are swept once the map grows.
+	for i := range 100 {
+		l.admit(session(fmt.Sprintf("sweep%d", i)))
+	}
+	now = now.Add(2 * time.Minute)
+	for i := range 100 {
+		l.admit(session(fmt.Sprintf("late%d", i)))
+	}
+	if n := len(l.windows); n > 128 {
+		t.Errorf("%d windows kept, want ended ones swept", n)
+	}
+}
@@ -0,0 +1,124 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// shadowMaxInFlight bounds the shadow evaluations running at once; a
+// sampled request finding them all busy is skipped rather than queued.
+const shadowMaxInFlight = 8
+
+// shadow evaluates a sample of requests against a candidate model in the
+// background and tracks how often it agrees with the served decision.
+type shadow struct {
+	model string
+	rate  float64
+	slots chan struct{}
+
+	sampled   atomic.Int64
+	skipped   atomic.Int64
+	failed    atomic.Int64
+	completed atomic.Int64
+	agreed    atomic.Int64
+}
+
+// WithShadow also sends a rate (0-1) sample of the requests analyzed by
+// Claude to model, without serving its decisions, to measure how often it
+// agrees with the served model. Sampling is by a hash of the prompt, so a
+// given input is always or never shadowed. Shadow calls are billed and
+// count toward the spend, but are not retried.
+func WithShadow(model string, rate float64) Option {
+	return func(s *ClaudeService) {
+		if model == "" {
+			return
+		}
+		s.shadow = &shadow{model: model, rate: rate, slots: make(chan struct{}, shadowMaxInFlight)}
+	}
+}
+
+// ValidateShadowRate reports whether rate is usable as a shadow sampling
+// rate.
+func ValidateShadowRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("shadow sample rate must be between 0 and 1, got %v", rate)
+	}
+	return nil
+}
+
+// ShadowStatus describes shadow evaluation. Agreement is counted over the
+// sampled requests whose shadow call completed.
+type ShadowStatus struct {
+	Model         string  `json:"model"`
+	SampleRate    float64 `json:"sample_rate"`
+	Sampled       int64   `json:"sampled"`   // Requests selected for shadowing
+	Skipped       int64   `json:"skipped"`   // Sampled but dropped because shadowMaxInFlight were running
+	Failed        int64   `json:"failed"`    // Shadow calls that errored or returned no usable decision
+	Completed     int64   `json:"completed"` // Shadow decisions compared with the served one
+	Agreed        int64   `json:"agreed"`    // Completed with the same is_likely_live and outcome
+	AgreementRate float64 `json:"agreement_rate"`
+}
+
+func (sh *shadow) status() *ShadowStatus {
+	st := &ShadowStatus{
+		Model:      sh.model,
+		SampleRate: sh.rate,
+		Sampled:    sh.sampled.Load(),
+		Skipped:    sh.skipped.Load(),
+		Failed:     sh.failed.Load(),
+		Completed:  sh.completed.Load(),
+		Agreed:     sh.agreed.Load(),
+	}
+	if st.Completed > 0 {
+		st.AgreementRate = float64(st.Agreed) / float64(st.Completed)
+	}
+	return st
+}
+
+// sampleShadow reports whether the request with the given prompt is
+// shadowed. Its slot is drawn from a separately salted hash so the sample
+// is independent of canary routing.
+func (s *ClaudeService) sampleShadow(prompt string) bool {
+	return s.shadow != nil && float64(promptSlot("shadow", prompt)) < s.shadow.rate*10000
+}
+
+// startShadow runs req against the shadow model in the background and
+// compares its decision with served, which the served model returned for
+// the same request. It never delays or alters served.
+func (s *ClaudeService) startShadow(ctx context.Context, req messagesRequest, served *LivenessAnalysisResult, band DecisionBand) {
+	sh := s.shadow
+	if req.Model == sh.model {
+		return
+	}
+	sh.sampled.Add(1)
+	select {
+	case sh.slots <- struct{}{}:
+	default:
+		sh.skipped.Add(1)
+		return
+	}
+	req.Model = sh.model
+	ctx = context.WithoutCancel(ctx)
+	servedLive, servedOutcome := served.IsLikelyLive, band.classify(served.Confidence)
+	go func() {
+		defer func() { <-sh.slots }()
+		resp, _, err := s.createMessage(ctx, req)
+		if err == nil {
+			s.recordUsage(req.Model, resp.Usage)
+			var result *LivenessAnalysisResult
+			if result, err = parseDecision(resp, s.allowedCategories, false, false); err == nil {
+				sh.completed.Add(1)
+				s.metrics.shadowEvaluations.Inc()
+				if result.IsLikelyLive == servedLive && band.classify(result.Confidence) == servedOutcome {
+					sh.agreed.Add(1)
+					s.metrics.shadowAgreements.Inc()
+				}
+				return
+			}
+		}
+		sh.failed.Add(1)
+		log.Printf("ClaudeService: Shadow evaluation on %s failed: %v", sh.model, err)
+	}()
+}
@@ -0,0 +1,113 @@
+package claude
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const shadowTestModel = "claude-shadow-test"
+
+// waitForShadows waits until every sampled shadow evaluation has finished.
+func waitForShadows(t *testing.T, s *ClaudeService) *ShadowStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		st := s.Stats().Shadow
+		if st.Skipped+st.Failed+st.Completed == st.Sampled {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("shadow evaluations still running: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShadowSampling(t *testing.T) {
+	// The shadow model disagrees on every third call it gets, so its
+	// agreement is known exactly from the calls it answered.
+	var shadowCalls, shadowAgreeing atomic.Int64
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		live := true
+		if req.Model == shadowTestModel {
+			if n := shadowCalls.Add(1); n%3 == 0 {
+				live = false
+			} else {
+				shadowAgreeing.Add(1)
+			}
+		}
+		writeMessage(w, req.Model, decisionText(live, 0.9, "Consistent signals."))
+	})
+	s := newStubService(t, stub, WithShadow(shadowTestModel, 0.2))
+
+	const n = 1000
+	for i := range n {
+		result, err := s.AnalyzeDataForLiveness(t.Context(), canaryInput(i))
+		if err != nil {
+			t.Fatalf("AnalyzeDataForLiveness: %v", err)
+		}
+		if result.Model != DefaultModel || !result.IsLikelyLive {
+			t.Fatalf("served result = %+v, want the stable model's decision", result)
+		}
+	}
+	st := waitForShadows(t, s)
+	if st.Sampled < 150 || st.Sampled > 250 {
+		t.Errorf("sampled %d of %d requests, want about 20%%", st.Sampled, n)
+	}
+	if got := shadowCalls.Load(); got != st.Sampled-st.Skipped {
+		t.Errorf("shadow model got %d calls, want one per sampled request that was not skipped (%d)", got, st.Sampled-st.Skipped)
+	}
+	if st.Failed != 0 || st.Completed != shadowCalls.Load() {
+		t.Errorf("status = %+v, want every shadow call completed", st)
+	}
+	// Agreement covers only the sampled requests, not all n.
+	if st.Agreed != shadowAgreeing.Load() {
+		t.Errorf("agreed = %d, want %d", st.Agreed, shadowAgreeing.Load())
+	}
+	if want := float64(st.Agreed) / float64(st.Completed); st.AgreementRate != want {
+		t.Errorf("agreement rate = %v, want %v", st.AgreementRate, want)
+	}
+	if st.AgreementRate < 0.6 || st.AgreementRate > 0.7 {
+		t.Errorf("agreement rate = %v, want about 2/3", st.AgreementRate)
+	}
+
+	// Sampling is deterministic: repeating the inputs samples the same ones.
+	sampled := st.Sampled
+	for i := range n {
+		if _, err := s.AnalyzeDataForLiveness(t.Context(), canaryInput(i)); err != nil {
+			t.Fatalf("AnalyzeDataForLiveness: %v", err)
+		}
+	}
+	if st := waitForShadows(t, s); st.Sampled != 2*sampled {
+		t.Errorf("second pass sampled %d requests, want %d again", st.Sampled-sampled, sampled)
+	}
+}
+
+func TestShadowSampleRateBounds(t *testing.T) {
+	for _, tc := range []struct {
+		rate float64
+		want int64
+	}{
+		{0, 0},
+		{1, 20},
+	} {
+		stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+		s := newStubService(t, stub, WithShadow(shadowTestModel, tc.rate))
+		for i := range 20 {
+			if _, err := s.AnalyzeDataForLiveness(t.Context(), canaryInput(i)); err != nil {
+				t.Fatalf("AnalyzeDataForLiveness: %v", err)
+			}
+		}
+		if st := waitForShadows(t, s); st.Sampled != tc.want {
+			t.Errorf("rate %v: sampled %d of 20, want %d", tc.rate, st.Sampled, tc.want)
+		}
+	}
+
+	for _, rate := range []float64{-0.1, 1.5} {
+		if ValidateShadowRate(rate) == nil {
+			t.Errorf("ValidateShadowRate(%v) succeeded", rate)
+		}
+	}
+}
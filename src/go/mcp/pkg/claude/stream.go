@@ -0,0 +1,136 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WithStreaming makes Claude calls use the streaming Messages API. With
+// fallback set, a stream cut short by an error event is retried once
+// without streaming before the error is returned.
+func WithStreaming(enabled, fallback bool) Option {
+	return func(s *ClaudeService) {
+		s.streaming = enabled
+		s.streamFallback = fallback
+	}
+}
+
+// streamEvent is the union of the Messages API stream event payloads we
+// consume.
+type streamEvent struct {
+	Type    string           `json:"type"`
+	Message messagesResponse `json:"message"`
+	Index   int              `json:"index"`
+	Block   contentBlock     `json:"content_block"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage usage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readStream assembles a Messages API response from its server-sent event
+// stream. An error event ends the stream with an *APIError marked
+// MidStream; a stream that ends before message_stop is an invalid
+// response. On error the response read so far is returned too, for the
+// usage it reports.
+func readStream(r io.Reader) (*messagesResponse, error) {
+	var resp messagesResponse
+	var event string
+	var data strings.Builder
+	dispatch := func() (bool, error) {
+		defer func() { event = ""; data.Reset() }()
+		if data.Len() == 0 {
+			return false, nil
+		}
+		var ev streamEvent
+		if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+			return false, fmt.Errorf("%w: stream event %q: %v", ErrInvalidResponse, event, err)
+		}
+		if event == "" {
+			event = ev.Type
+		}
+		switch event {
+		case "error":
+			return false, &APIError{Type: ev.Error.Type, Message: ev.Error.Message, MidStream: true}
+		case "message_start":
+			content := resp.Content
+			resp = ev.Message
+			resp.Content = content
+		case "content_block_start":
+			for len(resp.Content) <= ev.Index {
+				resp.Content = append(resp.Content, contentBlock{})
+			}
+			resp.Content[ev.Index] = ev.Block
+		case "content_block_delta":
+			if ev.Index >= len(resp.Content) {
+				return false, fmt.Errorf("%w: delta for unknown content block %d", ErrInvalidResponse, ev.Index)
+			}
+			if ev.Delta.Type == "text_delta" {
+				resp.Content[ev.Index].Text += ev.Delta.Text
+			}
+		case "message_delta":
+			if ev.Delta.StopReason != "" {
+				resp.StopReason = ev.Delta.StopReason
+			}
+			resp.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			return true, nil
+		}
+		return false, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			done, err := dispatch()
+			if err != nil {
+				return &resp, err
+			}
+			if done {
+				return &resp, nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &resp, fmt.Errorf("reading Claude stream: %w", err)
+	}
+	done, err := dispatch()
+	if err != nil {
+		return &resp, err
+	}
+	if !done {
+		return &resp, fmt.Errorf("%w: stream ended before message_stop", ErrInvalidResponse)
+	}
+	return &resp, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
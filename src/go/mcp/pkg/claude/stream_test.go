@@ -0,0 +1,118 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// streamFrames returns a Messages API event stream whose text is split
+// across deltas, optionally cut short by an error event after the first.
+func streamFrames(text string, errorMidway bool) string {
+	var b strings.Builder
+	frame := func(event, data string) { fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", event, data) }
+	frame("message_start", `{"type": "message_start", "message": {"id": "msg_test", "model": "`+DefaultModel+`", "content": [], "usage": {"input_tokens": 100}}}`)
+	frame("content_block_start", `{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`)
+	half := len(text) / 2
+	for i, part := range []string{text[:half], text[half:]} {
+		if i == 1 && errorMidway {
+			frame("error", `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`)
+			return b.String()
+		}
+		frame("content_block_delta", fmt.Sprintf(`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": %q}}`, part))
+	}
+	frame("content_block_stop", `{"type": "content_block_stop", "index": 0}`)
+	frame("message_delta", `{"type": "message_delta", "delta": {"stop_reason": "end_turn"}, "usage": {"output_tokens": 20}}`)
+	frame("message_stop", `{"type": "message_stop"}`)
+	return b.String()
+}
+
+func TestReadStream(t *testing.T) {
+	text := decisionText(true, 0.9, "Consistent signals.")
+	resp, err := readStream(strings.NewReader(streamFrames(text, false)))
+	if err != nil {
+		t.Fatalf("readStream: %v", err)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].Text != text {
+		t.Errorf("content = %+v, want the joined deltas", resp.Content)
+	}
+	if resp.StopReason != "end_turn" || resp.Usage.InputTokens != 100 || resp.Usage.OutputTokens != 20 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	resp, err = readStream(strings.NewReader(streamFrames(text, true)))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.MidStream || apiErr.Type != "overloaded_error" {
+		t.Errorf("mid-stream error: readStream error = %v, want a mid-stream overloaded *APIError", err)
+	}
+	if resp == nil || resp.Usage.InputTokens != 100 {
+		t.Errorf("mid-stream error: partial response = %+v, want its usage", resp)
+	}
+
+	_, err = readStream(strings.NewReader(strings.Split(streamFrames(text, false), "event: message_stop")[0]))
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("truncated stream: readStream error = %v, want ErrInvalidResponse", err)
+	}
+}
+
+// erroringStreamStub answers streaming calls with a stream cut short by an
+// error event, and non-streaming calls with a decision.
+func erroringStreamStub(t *testing.T) *messagesStub {
+	text := decisionText(true, 0.9, "Consistent signals.")
+	return newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		if !req.Stream {
+			writeMessage(w, req.Model, text)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, streamFrames(text, true))
+	})
+}
+
+func TestMidStreamErrorFallsBack(t *testing.T) {
+	stub := erroringStreamStub(t)
+	s := newStubService(t, stub, WithStreaming(true, true))
+
+	result, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	if err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if !result.IsLikelyLive || result.Reasoning != "Consistent signals." {
+		t.Errorf("result = %+v, want the non-streaming decision", result)
+	}
+	if n := stub.calls.Load(); n != 2 {
+		t.Errorf("Claude calls = %d, want the stream and one fallback", n)
+	}
+	if body := stub.lastBody(); strings.Contains(body, `"stream"`) {
+		t.Errorf("fallback call was streamed: %s", body)
+	}
+
+	// The failed stream's prompt is billed along with the fallback.
+	pricing, _ := s.catalog.pricing(DefaultModel)
+	if got, want := s.Stats().EstimatedCostUSD, pricing.Cost(100, 0)+pricing.Cost(100, 20); math.Abs(got-want) > 1e-12 {
+		t.Errorf("estimated cost = %v, want %v", got, want)
+	}
+	if n := s.metrics.inputTokens.Count(); n != 2 {
+		t.Errorf("input token observations = %d, want the stream's and the fallback's", n)
+	}
+}
+
+func TestMidStreamErrorWithoutFallback(t *testing.T) {
+	stub := erroringStreamStub(t)
+	s := newStubService(t, stub, WithStreaming(true, false), WithRetryPolicy(ClassOverloaded, BackoffPolicy{}))
+
+	_, err := s.AnalyzeDataForLiveness(t.Context(), testInput())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.MidStream || apiErr.StatusCode != http.StatusOK {
+		t.Fatalf("error = %v, want a mid-stream *APIError", err)
+	}
+	if apiErr.Class() != ClassOverloaded {
+		t.Errorf("error class = %s, want %s", apiErr.Class(), ClassOverloaded)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("Claude calls = %d, want 1", n)
+	}
+}
@@ -0,0 +1,113 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/metrics"
+)
+
+// messagesStub stands in for the Messages API. Each call is answered by
+// handle, which is given the decoded request and the 1-based call number;
+// the raw bodies and request contexts are kept for inspection.
+type messagesStub struct {
+	*httptest.Server
+	calls atomic.Int64
+
+	mu       sync.Mutex
+	bodies   []string
+	contexts []context.Context
+}
+
+func newMessagesStubFunc(t *testing.T, handle func(w http.ResponseWriter, req messagesRequest, call int64)) *messagesStub {
+	t.Helper()
+	stub := &messagesStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		var req messagesRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.bodies = append(stub.bodies, string(data))
+		stub.contexts = append(stub.contexts, r.Context())
+		call := stub.calls.Add(1)
+		stub.mu.Unlock()
+		handle(w, req, call)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// newMessagesStub returns a stub that answers every call with text.
+func newMessagesStub(t *testing.T, text string) *messagesStub {
+	return newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		writeMessage(w, req.Model, text)
+	})
+}
+
+func (s *messagesStub) lastBody() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) == 0 {
+		return ""
+	}
+	return s.bodies[len(s.bodies)-1]
+}
+
+// requestContext returns the context of the given 1-based call, which is
+// done once the client gives up on it.
+func (s *messagesStub) requestContext(call int64) context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.contexts[call-1]
+}
+
+// writeMessage writes a Messages API response whose only block is text.
+func writeMessage(w http.ResponseWriter, model, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messagesResponse{
+		ID:         "msg_test",
+		Model:      model,
+		StopReason: "end_turn",
+		Content:    []contentBlock{{Type: "text", Text: text}},
+		Usage:      usage{InputTokens: 100, OutputTokens: 20},
+	})
+}
+
+// decisionText returns the text of a Claude decision.
+func decisionText(live bool, confidence float64, reasoning string) string {
+	return fmt.Sprintf(`{"is_likely_live": %t, "confidence": %v, "reasoning": %q}`, live, confidence, reasoning)
+}
+
+// newStubService returns a service that calls stub.
+func newStubService(t *testing.T, stub *messagesStub, opts ...Option) *ClaudeService {
+	t.Helper()
+	opts = append([]Option{WithBaseURL(stub.URL), WithMetrics(metrics.NewRegistry())}, opts...)
+	s, err := NewService("test-key", opts...)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return s
+}
+
+// testInput is a minimal analysis input.
+func testInput() AnalyzeDataForLivenessInput {
+	return AnalyzeDataForLivenessInput{
+		UserData:      map[string]interface{}{"email": "user@example.com"},
+		SessionData:   map[string]interface{}{"session_id": "s1"},
+		TechnicalData: map[string]interface{}{"captcha_solved": true},
+	}
+}
@@ -0,0 +1,259 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// DefaultPromptTemplate is the name of the built-in analysis instructions,
+// used when a request does not select a template.
+const DefaultPromptTemplate = "standard"
+
+// ErrUnknownPromptTemplate is returned when a request selects a prompt
+// template that has not been registered.
+var ErrUnknownPromptTemplate = errors.New("unknown prompt template")
+
+// ErrPromptTemplateMissingKey is returned under MissingKeyError when the
+// selected prompt template references an input key the request lacks.
+var ErrPromptTemplateMissingKey = errors.New("prompt template references a missing input key")
+
+// MissingKeyPolicy decides how a prompt template renders a reference to an
+// input key the request doesn't include.
+type MissingKeyPolicy string
+
+const (
+	MissingKeyEmpty MissingKeyPolicy = "empty" // Render the reference as empty text
+	MissingKeySkip  MissingKeyPolicy = "skip"  // Leave out the paragraph containing the reference
+	MissingKeyError MissingKeyPolicy = "error" // Fail the request with ErrPromptTemplateMissingKey
+)
+
+// ParseMissingKeyPolicy validates a policy name. Empty selects
+// MissingKeyEmpty.
+func ParseMissingKeyPolicy(s string) (MissingKeyPolicy, error) {
+	switch p := MissingKeyPolicy(s); p {
+	case "":
+		return MissingKeyEmpty, nil
+	case MissingKeyEmpty, MissingKeySkip, MissingKeyError:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown missing key policy %q (want empty, skip or error)", s)
+	}
+}
+
+// WithMissingKeyPolicy sets how prompt templates treat references to input
+// keys a request doesn't include.
+func WithMissingKeyPolicy(p MissingKeyPolicy) Option {
+	return func(s *ClaudeService) { s.missingKeyPolicy = p }
+}
+
+// templateFuncs are the helpers available to prompt template authors.
+var templateFuncs = template.FuncMap{
+	// has reports whether the map m has key, e.g. {{if has .session_data "ip"}}.
+	"has": func(m interface{}, key string) bool {
+		v := reflect.ValueOf(m)
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid()
+	},
+	// default returns v, or def when v is missing or empty, e.g.
+	// {{default "unknown" .technical_data.platform}}.
+	"default": func(def, v interface{}) interface{} {
+		if v == nil {
+			return def
+		}
+		if rv := reflect.ValueOf(v); rv.IsZero() || (rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.Len() == 0 {
+			return def
+		}
+		return v
+	},
+}
+
+// promptTemplate is a parsed prompt template. It is split into paragraphs
+// at blank lines so that MissingKeySkip can leave out just the paragraphs
+// whose keys are missing; a template with actions spanning paragraphs is
+// kept whole.
+type promptTemplate struct {
+	name       string
+	paragraphs []*template.Template
+}
+
+// noValue is what text/template prints for a missing map entry.
+const noValue = "<no value>"
+
+func parsePromptTemplate(name, text string) (*promptTemplate, error) {
+	pt := &promptTemplate{name: name}
+	for _, para := range strings.Split(text, "\n\n") {
+		t, err := template.New(name).Funcs(templateFuncs).Parse(para)
+		if err != nil {
+			pt.paragraphs = nil
+			break
+		}
+		pt.paragraphs = append(pt.paragraphs, t)
+	}
+	if pt.paragraphs == nil {
+		t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing prompt template %q: %w", name, err)
+		}
+		pt.paragraphs = []*template.Template{t}
+	}
+	return pt, nil
+}
+
+// render executes the template against the request input. The input's
+// sections are available as .user_data, .session_data and .technical_data.
+// A paragraph has a missing key when it prints a reference to one, or when
+// it reaches through one (.a.b with no .a) and so can't be rendered at all.
+func (pt *promptTemplate) render(input AnalyzeDataForLivenessInput, policy MissingKeyPolicy) (string, error) {
+	data := map[string]interface{}{
+		"user_data":      input.UserData,
+		"session_data":   input.SessionData,
+		"technical_data": input.TechnicalData,
+	}
+	var out []string
+	for i, t := range pt.paragraphs {
+		var b strings.Builder
+		err := t.Execute(&b, data)
+		text := b.String()
+		if err == nil && !strings.Contains(text, noValue) {
+			out = append(out, text)
+			continue
+		}
+		switch {
+		case policy == MissingKeyError:
+			return "", fmt.Errorf("%w: template %q paragraph %d references %s", ErrPromptTemplateMissingKey, pt.name, i+1, strings.Join(missingRefs(t.Tree.Root, data), ", "))
+		case policy == MissingKeySkip:
+			continue
+		case err != nil:
+			log.Printf("ClaudeService: Leaving out prompt template %q paragraph %d: %v", pt.name, i+1, err)
+			continue
+		default:
+			out = append(out, strings.ReplaceAll(text, noValue, ""))
+		}
+	}
+	return strings.Join(out, "\n\n"), nil
+}
+
+// missingRefs lists the field references under node that don't resolve in
+// data, for error messages. Arguments to default, which handles missing
+// values itself, and the bodies of range and with, where dot is rebound,
+// are not checked.
+func missingRefs(node parse.Node, data map[string]interface{}) []string {
+	var refs []string
+	var walk func(parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, c := range n.Nodes {
+					walk(c)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+		case *parse.WithNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, c := range n.Cmds {
+					walk(c)
+				}
+			}
+		case *parse.CommandNode:
+			if len(n.Args) > 0 {
+				if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+					return
+				}
+			}
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.FieldNode:
+			if !resolves(data, n.Ident) {
+				refs = append(refs, "."+strings.Join(n.Ident, "."))
+			}
+		}
+	}
+	walk(node)
+	if len(refs) == 0 {
+		return []string{"a missing key"}
+	}
+	return refs
+}
+
+// resolves reports whether the map path exists in data.
+func resolves(data map[string]interface{}, path []string) bool {
+	var cur interface{} = data
+	for _, key := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if cur, ok = m[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// WithPromptTemplates registers named analysis instructions that requests
+// may select instead of the standard ones. Each template replaces the
+// instruction preamble of the system prompt; the decision schema is always
+// appended, so templates cannot change the response contract. Registering
+// DefaultPromptTemplate replaces the built-in instructions.
+func WithPromptTemplates(templates map[string]string) Option {
+	return func(s *ClaudeService) {
+		for name, text := range templates {
+			s.promptTemplates[name] = text
+		}
+	}
+}
+
+// PromptTemplates returns the names of the registered prompt templates.
+func (s *ClaudeService) PromptTemplates() []string {
+	names := make([]string, 0, len(s.promptTemplates))
+	for name := range s.promptTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsePromptTemplates parses every registered template, so that syntax
+// errors surface at startup rather than on the first request selecting one.
+func (s *ClaudeService) parsePromptTemplates() error {
+	s.parsedTemplates = make(map[string]*promptTemplate, len(s.promptTemplates))
+	for name, text := range s.promptTemplates {
+		pt, err := parsePromptTemplate(name, text)
+		if err != nil {
+			return err
+		}
+		s.parsedTemplates[name] = pt
+	}
+	return nil
+}
+
+// promptTemplate resolves a template name, defaulting to the standard one.
+func (s *ClaudeService) promptTemplate(name string) (*promptTemplate, error) {
+	if name == "" {
+		name = DefaultPromptTemplate
+	}
+	pt, ok := s.parsedTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownPromptTemplate, name)
+	}
+	return pt, nil
+}
@@ -0,0 +1,79 @@
+package claude
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// policyTemplate references one present key, one missing key, and a
+// missing section reached through, each in its own paragraph.
+const policyTemplate = `Email: {{.user_data.email}}.
+
+Platform: {{.technical_data.platform}}.
+
+Carrier: {{.device_data.carrier.name}}.
+
+Locale: {{default "unknown" .session_data.locale}}{{if has .session_data "session_id"}}, session {{.session_data.session_id}}{{end}}.`
+
+func TestPromptTemplateMissingKeyPolicies(t *testing.T) {
+	pt, err := parsePromptTemplate("policy", policyTemplate)
+	if err != nil {
+		t.Fatalf("parsePromptTemplate: %v", err)
+	}
+	input := testInput()
+
+	for _, tc := range []struct {
+		policy MissingKeyPolicy
+		want   string
+	}{
+		{MissingKeyEmpty, "Email: user@example.com.\n\nPlatform: .\n\nCarrier: .\n\nLocale: unknown, session s1."},
+		{MissingKeySkip, "Email: user@example.com.\n\nLocale: unknown, session s1."},
+	} {
+		got, err := pt.render(input, tc.policy)
+		if err != nil {
+			t.Errorf("policy %s: render: %v", tc.policy, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("policy %s: rendered\n%q\nwant\n%q", tc.policy, got, tc.want)
+		}
+	}
+
+	_, err = pt.render(input, MissingKeyError)
+	if !errors.Is(err, ErrPromptTemplateMissingKey) || !strings.Contains(err.Error(), ".technical_data.platform") {
+		t.Errorf("policy error: render error = %v, want ErrPromptTemplateMissingKey naming the key", err)
+	}
+
+	// With every key present, each policy renders the same text.
+	input.TechnicalData["platform"] = "ios"
+	input.SessionData["locale"] = "en-GB"
+	full, err := parsePromptTemplate("full", "Platform: {{.technical_data.platform}}.\n\nLocale: {{default \"unknown\" .session_data.locale}}.")
+	if err != nil {
+		t.Fatalf("parsePromptTemplate: %v", err)
+	}
+	for _, policy := range []MissingKeyPolicy{MissingKeyEmpty, MissingKeySkip, MissingKeyError} {
+		got, err := full.render(input, policy)
+		if want := "Platform: ios.\n\nLocale: en-GB."; err != nil || got != want {
+			t.Errorf("policy %s with keys present: render = %q, %v; want %q", policy, got, err, want)
+		}
+	}
+}
+
+func TestPromptTemplateMissingKeyErrorFailsRequest(t *testing.T) {
+	stub := newMessagesStub(t, decisionText(true, 0.9, "Consistent signals."))
+	s := newStubService(t, stub,
+		WithPromptTemplates(map[string]string{"platform": "Check the {{.technical_data.platform}} client."}),
+		WithMissingKeyPolicy(MissingKeyError))
+
+	_, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{PromptTemplate: "platform"})
+	if !errors.Is(err, ErrPromptTemplateMissingKey) {
+		t.Errorf("error = %v, want ErrPromptTemplateMissingKey", err)
+	}
+	if n := stub.calls.Load(); n != 0 {
+		t.Errorf("Claude calls = %d, want 0", n)
+	}
+	if _, err := ParseMissingKeyPolicy("ignore"); err == nil {
+		t.Error("ParseMissingKeyPolicy accepted an unknown policy")
+	}
+}
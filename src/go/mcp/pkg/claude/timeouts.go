@@ -0,0 +1,44 @@
+package claude
+
+import "time"
+
+// DefaultRequestTimeout bounds a single Claude call when no timeout is
+// configured for its model.
+const DefaultRequestTimeout = 30 * time.Second
+
+// DefaultAnalysisTimeout bounds a whole analysis, across transport and
+// parse retries, when no budget is configured.
+const DefaultAnalysisTimeout = 2 * time.Minute
+
+// WithRequestTimeout sets the per-call timeout for models without a timeout
+// of their own.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *ClaudeService) { s.requestTimeout = d }
+}
+
+// WithAnalysisTimeout sets the budget for a whole analysis: every attempt,
+// the backoff between them and parse retries. Each attempt is still bounded
+// by its model's timeout.
+func WithAnalysisTimeout(d time.Duration) Option {
+	return func(s *ClaudeService) { s.analysisTimeout = d }
+}
+
+// WithModelTimeouts sets per-call timeouts by model. Keys are model names or
+// prefixes such as "claude-3-5-haiku"; the longest matching key wins, as
+// with pricing. Each attempt against a model, including one selected by a
+// spend downgrade, uses that model's timeout.
+func WithModelTimeouts(timeouts map[string]time.Duration) Option {
+	return func(s *ClaudeService) {
+		for model, d := range timeouts {
+			s.modelTimeouts[model] = d
+		}
+	}
+}
+
+// timeoutFor returns the per-call timeout for model.
+func (s *ClaudeService) timeoutFor(model string) time.Duration {
+	if d, ok := lookupPrefix(s.modelTimeouts, model); ok {
+		return d
+	}
+	return s.requestTimeout
+}
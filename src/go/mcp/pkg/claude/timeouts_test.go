@@ -0,0 +1,99 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeoutForModel(t *testing.T) {
+	s := newStubService(t, newMessagesStub(t, decisionText(true, 0.9, "Fine.")),
+		WithRequestTimeout(7*time.Second),
+		WithModelTimeouts(map[string]time.Duration{
+			"claude-3-5-haiku":          2 * time.Second,
+			"claude-3-5-haiku-20241022": time.Second,
+			"claude-sonnet-4":           20 * time.Second,
+		}))
+	for model, want := range map[string]time.Duration{
+		"claude-3-5-haiku-20241022": time.Second,      // Exact key beats the prefix
+		"claude-3-5-haiku-latest":   2 * time.Second,  // Prefix
+		"claude-sonnet-4-20250514":  20 * time.Second, // Prefix
+		"claude-opus-4-20250514":    7 * time.Second,  // Global default
+	} {
+		if got := s.timeoutFor(model); got != want {
+			t.Errorf("timeoutFor(%s) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestEachModelCallUsesItsTimeout(t *testing.T) {
+	const fast = "claude-3-5-haiku-20241022"
+	// Every reply takes 100ms: too long for the fast model's timeout.
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, _ int64) {
+		time.Sleep(100 * time.Millisecond)
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Fine."))
+	})
+	noRetries := BackoffPolicy{}
+	opts := []Option{
+		WithRequestTimeout(5 * time.Second),
+		WithModelTimeouts(map[string]time.Duration{fast: 20 * time.Millisecond}),
+		WithRetryPolicy(ClassUnavailable, noRetries),
+		WithRetryPolicy(ClassServerError, noRetries),
+	}
+	s := newStubService(t, stub, opts...)
+
+	if _, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{Model: DefaultModel}); err != nil {
+		t.Errorf("%s under the global timeout: %v", DefaultModel, err)
+	}
+	start := time.Now()
+	_, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{Model: fast})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("%s under its 20ms timeout: error = %v, want DeadlineExceeded", fast, err)
+	}
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("%s call took %s, want it cut off at its timeout", fast, elapsed)
+	}
+
+	// A spend downgrade to the fast model applies its timeout too.
+	downgraded := newStubService(t, stub, append(opts, WithSpendCap(SpendCap{CapUSD: 1, DowngradeAt: 0.5, Period: SpendDaily, DowngradeModel: fast}))...)
+	downgraded.spend.record(0.6)
+	if _, err := downgraded.AnalyzeDataForLiveness(t.Context(), testInput()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("downgraded call: error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestShortModelTimeoutStillRetries(t *testing.T) {
+	const fast = "claude-3-5-haiku-20241022"
+	stub := newMessagesStubFunc(t, func(w http.ResponseWriter, req messagesRequest, call int64) {
+		if call == 1 {
+			http.Error(w, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`, 529)
+			return
+		}
+		writeMessage(w, req.Model, decisionText(true, 0.9, "Fine."))
+	})
+	// The backoff is longer than one call may take.
+	opts := []Option{
+		WithModelTimeouts(map[string]time.Duration{fast: 50 * time.Millisecond}),
+		WithRetryPolicy(ClassOverloaded, BackoffPolicy{MaxRetries: 1, Initial: 100 * time.Millisecond, Max: 100 * time.Millisecond}),
+	}
+	s := newStubService(t, stub, opts...)
+	if _, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{Model: fast}); err != nil {
+		t.Fatalf("AnalyzeDataForLiveness: %v", err)
+	}
+	if n := stub.calls.Load(); n != 2 {
+		t.Errorf("Claude calls = %d, want the 529 retried", n)
+	}
+
+	// The analysis timeout is what bounds the retries.
+	stub.calls.Store(0)
+	s = newStubService(t, stub, append(opts, WithAnalysisTimeout(80*time.Millisecond))...)
+	var apiErr *APIError
+	if _, err := s.AnalyzeDataForLivenessWithOptions(t.Context(), testInput(), AnalyzeOptions{Model: fast}); !errors.As(err, &apiErr) || apiErr.StatusCode != 529 {
+		t.Errorf("under an 80ms analysis timeout: error = %v, want the 529", err)
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("under an 80ms analysis timeout: Claude calls = %d, want no retry", n)
+	}
+}
@@ -0,0 +1,70 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxNestingDepth is the deepest input accepted unless
+// WithMaxNestingDepth sets another limit.
+const DefaultMaxNestingDepth = 8
+
+// ErrInputTooDeep is returned when an input map nests deeper than allowed.
+var ErrInputTooDeep = errors.New("input nested too deeply")
+
+// WithMaxNestingDepth limits how deeply the input maps may nest. A section
+// map's own entries are at depth 1, and every nested object or array adds a
+// level. Zero or less disables the limit.
+func WithMaxNestingDepth(depth int) Option {
+	return func(s *ClaudeService) { s.maxNestingDepth = depth }
+}
+
+// checkDepth reports an error if any section of input nests deeper than max.
+// It walks the values with an explicit stack, so arbitrarily deep input
+// cannot exhaust the goroutine stack before being rejected.
+func checkDepth(input AnalyzeDataForLivenessInput, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	type frame struct {
+		path  string
+		value interface{}
+		depth int
+	}
+	var stack []frame
+	for _, section := range []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"user_data", input.UserData},
+		{"session_data", input.SessionData},
+		{"technical_data", input.TechnicalData},
+	} {
+		if section.data != nil {
+			stack = append(stack, frame{path: section.name, value: section.data, depth: 0})
+		}
+	}
+
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch v := f.value.(type) {
+		case map[string]interface{}:
+			if f.depth+1 > max && len(v) > 0 {
+				return fmt.Errorf("%w: %s exceeds the maximum depth of %d", ErrInputTooDeep, f.path, max)
+			}
+			for k, child := range v {
+				stack = append(stack, frame{path: f.path + "." + k, value: child, depth: f.depth + 1})
+			}
+		case []interface{}:
+			if f.depth+1 > max && len(v) > 0 {
+				return fmt.Errorf("%w: %s exceeds the maximum depth of %d", ErrInputTooDeep, f.path, max)
+			}
+			for i, child := range v {
+				stack = append(stack, frame{path: fmt.Sprintf("%s[%d]", f.path, i), value: child, depth: f.depth + 1})
+			}
+		}
+	}
+	return nil
+}
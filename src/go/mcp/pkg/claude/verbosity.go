@@ -0,0 +1,62 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verbosity selects how much explanation a decision carries.
+type Verbosity string
+
+const (
+	VerbosityTerse    Verbosity = "terse"    // One-sentence reasoning, with a smaller output token budget
+	VerbosityNormal   Verbosity = "normal"   // A short explanation
+	VerbosityDetailed Verbosity = "detailed" // A paragraph plus the factors that drove the decision
+)
+
+// terseMaxTokens caps output tokens for terse decisions, which need far fewer
+// than the default budget.
+const terseMaxTokens = 256
+
+// ErrUnknownVerbosity is returned when a request names a verbosity level that
+// doesn't exist.
+var ErrUnknownVerbosity = errors.New("unknown verbosity")
+
+// ParseVerbosity validates a verbosity name. Empty selects the service
+// default.
+func ParseVerbosity(name string) (Verbosity, error) {
+	switch v := Verbosity(name); v {
+	case "", VerbosityTerse, VerbosityNormal, VerbosityDetailed:
+		return v, nil
+	}
+	return "", fmt.Errorf("%w %q: must be %s, %s or %s", ErrUnknownVerbosity, name, VerbosityTerse, VerbosityNormal, VerbosityDetailed)
+}
+
+// WithVerbosity sets the verbosity used when a request doesn't choose one.
+func WithVerbosity(v Verbosity) Option {
+	return func(s *ClaudeService) { s.verbosity = v }
+}
+
+// reasoningSchema returns the reasoning part of the decision schema for v.
+func reasoningSchema(v Verbosity) string {
+	switch v {
+	case VerbosityTerse:
+		return `"reasoning": "<one short sentence>"`
+	case VerbosityDetailed:
+		return `"reasoning": "<a paragraph explaining the judgement>", "factors": [<each signal that most influenced the judgement, as a short phrase>]`
+	default:
+		return `"reasoning": "<short explanation>"`
+	}
+}
+
+// maxTokensFor returns the output token budget for v.
+func (s *ClaudeService) maxTokensFor(v Verbosity) int {
+	switch v {
+	case VerbosityTerse:
+		return min(s.maxTokens, terseMaxTokens)
+	case VerbosityDetailed:
+		return 2 * s.maxTokens
+	default:
+		return s.maxTokens
+	}
+}
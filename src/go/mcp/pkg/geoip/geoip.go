@@ -0,0 +1,379 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// maxMetadataSize bounds how far from the end of the file the metadata
+// marker is searched for.
+const maxMetadataSize = 128 << 10
+
+// dataSectionSeparator is the run of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// ErrInvalidDatabase is returned when a file isn't a MaxMind DB this reader
+// understands.
+var ErrInvalidDatabase = errors.New("invalid MaxMind database")
+
+// Record is what a database knows about one address. Country databases
+// fill Country, ASN databases ASN and Organization; City databases fill
+// Country as well.
+type Record struct {
+	Country      string `json:"country,omitempty"` // ISO 3166-1 alpha-2 code
+	ASN          uint64 `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"` // Autonomous system organization
+}
+
+// Reader looks up addresses in a MaxMind DB (.mmdb) file held in memory.
+// It is safe for concurrent use.
+type Reader struct {
+	buf          []byte
+	data         []byte // The data section
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	ipv4Start    uint // Node at which IPv4 lookups start in an IPv6 tree
+}
+
+// Open reads the MaxMind DB at path into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New parses a MaxMind DB held in buf.
+func New(buf []byte) (*Reader, error) {
+	tail := buf
+	if len(tail) > maxMetadataSize {
+		tail = tail[len(tail)-maxMetadataSize:]
+	}
+	i := bytes.LastIndex(tail, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+	metaStart := len(buf) - len(tail) + i + len(metadataMarker)
+	meta, _, err := (decoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	r := &Reader{buf: buf}
+	r.nodeCount, _ = uintField(m, "node_count")
+	r.recordSize, _ = uintField(m, "record_size")
+	r.ipVersion, _ = uintField(m, "ip_version")
+	r.databaseType, _ = m["database_type"].(string)
+	if major, _ := uintField(m, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidDatabase, major)
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidDatabase, r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	dataStart := treeSize + dataSectionSeparator
+	if dataStart > uint(metaStart-len(metadataMarker)) {
+		return nil, fmt.Errorf("%w: search tree exceeds file", ErrInvalidDatabase)
+	}
+	r.data = buf[dataStart : metaStart-len(metadataMarker)]
+
+	if r.ipVersion == 6 {
+		// IPv4 addresses live under ::/96; follow the 96 zero bits once.
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// DatabaseType is the database_type recorded in the metadata, such as
+// "GeoLite2-Country".
+func (r *Reader) DatabaseType() string { return r.databaseType }
+
+// Lookup returns the record for addr, and whether the database has one.
+func (r *Reader) Lookup(addr netip.Addr) (Record, bool, error) {
+	addr = addr.Unmap()
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4() && r.ipVersion == 6:
+		b := addr.As4()
+		ip, node = b[:], r.ipv4Start
+	case addr.Is4():
+		b := addr.As4()
+		ip = b[:]
+	case r.ipVersion == 6:
+		b := addr.As16()
+		ip = b[:]
+	default:
+		return Record{}, false, nil // IPv6 address in an IPv4-only database
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+	if node <= r.nodeCount {
+		return Record{}, false, nil
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return Record{}, false, fmt.Errorf("%w: data offset %d out of range", ErrInvalidDatabase, offset)
+	}
+	v, _, err := (decoder{buf: r.data}).decode(offset)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("%w: %v", ErrInvalidDatabase, err)
+	}
+	m, _ := v.(map[string]any)
+	return recordFrom(m), true, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// recordFrom picks the fields of Record out of a decoded data map, using
+// the layout of the GeoIP2/GeoLite2 Country, City and ASN databases.
+func recordFrom(m map[string]any) Record {
+	var rec Record
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]any); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				rec.Country = code
+				break
+			}
+		}
+	}
+	if asn, ok := uintField(m, "autonomous_system_number"); ok {
+		rec.ASN = uint64(asn)
+	}
+	rec.Organization, _ = m["autonomous_system_organization"].(string)
+	return rec
+}
+
+func uintField(m map[string]any, key string) (uint, bool) {
+	v, ok := m[key].(uint64)
+	return uint(v), ok
+}
+
+// Data section field types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds nesting so a malformed file can't exhaust the stack.
+const maxDepth = 32
+
+// decoder decodes values of the MaxMind DB data format. Pointers are
+// offsets into buf.
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+var errTruncated = errors.New("truncated data")
+
+// decode returns the value at offset and the offset just past it.
+// Unsigned integers decode as uint64, signed as int64 and 128-bit
+// integers as their big-endian bytes.
+func (d decoder) decode(offset uint) (any, uint, error) {
+	if d.depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == typePointer {
+		// A pointer's target is decoded in place of it; decoding then
+		// continues after the pointer itself.
+		d.depth++
+		v, _, err := d.decode(size)
+		return v, offset, err
+	}
+	return d.decodeValue(typ, size, offset)
+}
+
+// control reads the control byte at offset and returns the field's type
+// and size (for pointers, the target offset) and the offset of its payload.
+func (d decoder) control(offset uint) (typ int, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errTruncated
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ = int(ctrl >> 5)
+	if typ == typePointer {
+		n := uint(ctrl>>3)&0x3 + 1
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		b := d.buf[offset : offset+n]
+		var p uint
+		if n < 4 {
+			p = uint(ctrl & 0x7)
+		}
+		for _, c := range b {
+			p = p<<8 | uint(c)
+		}
+		switch n {
+		case 2:
+			p += 2048
+		case 3:
+			p += 526336
+		}
+		return typ, p, offset + n, nil
+	}
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		var v uint
+		for _, c := range d.buf[offset : offset+n] {
+			v = v<<8 | uint(c)
+		}
+		size = []uint{29, 285, 65821}[n-1] + v
+		offset += n
+	}
+	return typ, size, offset, nil
+}
+
+func (d decoder) decodeValue(typ int, size, offset uint) (any, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		child := decoder{buf: d.buf, depth: d.depth + 1}
+		for i := uint(0); i < size; i++ {
+			k, next, err := child.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := child.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], offset = v, next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		child := decoder{buf: d.buf, depth: d.depth + 1}
+		for i := uint(0); i < size; i++ {
+			v, next, err := child.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, v), next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, 0, fmt.Errorf("unexpected field type %d", typ)
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	b, next := d.buf[offset:offset+size], offset+size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return b, next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown field type %d", typ)
+	}
+}
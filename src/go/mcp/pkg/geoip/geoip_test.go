@@ -0,0 +1,299 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata databases")
+
+// Test database values beyond strings, unsigned integers and arrays.
+type (
+	mmdbMap     map[string]any
+	mmdbPointer string // Refers to the shared value with this name
+)
+
+// mmdbWriter builds MaxMind DB files for tests. Networks are inserted into
+// the search tree with their data appended to the data section; shared
+// values are written once and referenced by pointers.
+type mmdbWriter struct {
+	ipVersion  int
+	recordSize int
+	nodes      [][2]int // Child node, or -1 for none; data leaves are in leaves
+	leaves     map[[2]int]int
+	data       bytes.Buffer
+	shared     map[string]int
+}
+
+func newMMDBWriter(ipVersion, recordSize int) *mmdbWriter {
+	return &mmdbWriter{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		nodes:      [][2]int{{-1, -1}},
+		leaves:     make(map[[2]int]int),
+		shared:     make(map[string]int),
+	}
+}
+
+// share writes v to the data section under name, for mmdbPointer.
+func (w *mmdbWriter) share(name string, v any) {
+	w.shared[name] = w.data.Len()
+	w.encode(&w.data, v)
+}
+
+// insert maps the network prefix to data. Networks must not overlap.
+func (w *mmdbWriter) insert(t *testing.T, prefix string, data mmdbMap) {
+	t.Helper()
+	p := netip.MustParsePrefix(prefix)
+	ip, bits := p.Addr().AsSlice(), p.Bits()
+	if w.ipVersion == 6 && p.Addr().Is4() {
+		ip, bits = append(make([]byte, 12), ip...), bits+96
+	}
+	offset := w.data.Len()
+	w.encode(&w.data, data)
+
+	node := 0
+	for i := range bits {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			w.leaves[[2]int{node, bit}] = offset
+			return
+		}
+		if _, ok := w.leaves[[2]int{node, bit}]; ok {
+			t.Fatalf("network %s overlaps another", prefix)
+		}
+		if w.nodes[node][bit] < 0 {
+			w.nodes = append(w.nodes, [2]int{-1, -1})
+			w.nodes[node][bit] = len(w.nodes) - 1
+		}
+		node = w.nodes[node][bit]
+	}
+}
+
+// bytes returns the database.
+func (w *mmdbWriter) bytes(databaseType string) []byte {
+	n := len(w.nodes)
+	var out bytes.Buffer
+	for i, children := range w.nodes {
+		var rec [2]uint32
+		for bit, child := range children {
+			switch offset, leaf := w.leaves[[2]int{i, bit}]; {
+			case leaf:
+				rec[bit] = uint32(n + dataSectionSeparator + offset)
+			case child >= 0:
+				rec[bit] = uint32(child)
+			default:
+				rec[bit] = uint32(n) // No data
+			}
+		}
+		l, r := rec[0], rec[1]
+		switch w.recordSize {
+		case 24:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>24)<<4 | byte(r>>24)&0x0F, byte(r >> 16), byte(r >> 8), byte(r)})
+		default:
+			out.Write(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, l), r))
+		}
+	}
+	out.Write(make([]byte, dataSectionSeparator))
+	out.Write(w.data.Bytes())
+	out.Write(metadataMarker)
+	w.encode(&out, mmdbMap{
+		"node_count":                  uint32(n),
+		"record_size":                 uint16(w.recordSize),
+		"ip_version":                  uint16(w.ipVersion),
+		"database_type":               databaseType,
+		"languages":                   []any{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1_700_000_000),
+		"description":                 mmdbMap{"en": "Test database"},
+	})
+	return out.Bytes()
+}
+
+// encode appends v in the data section format.
+func (w *mmdbWriter) encode(buf *bytes.Buffer, v any) {
+	control := func(typ, size int) {
+		ctrl, ext := byte(0), -1
+		if typ > 7 {
+			ext = typ - 7
+		} else {
+			ctrl = byte(typ) << 5
+		}
+		if size < 29 {
+			buf.WriteByte(ctrl | byte(size))
+		} else {
+			buf.WriteByte(ctrl | 29)
+		}
+		if ext >= 0 {
+			buf.WriteByte(byte(ext))
+		}
+		if size >= 29 {
+			buf.WriteByte(byte(size - 29))
+		}
+	}
+	encodeUint := func(typ int, v uint64) {
+		b := binary.BigEndian.AppendUint64(nil, v)
+		b = bytes.TrimLeft(b, "\x00")
+		control(typ, len(b))
+		buf.Write(b)
+	}
+	switch v := v.(type) {
+	case string:
+		control(typeString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		encodeUint(typeUint16, uint64(v))
+	case uint32:
+		encodeUint(typeUint32, uint64(v))
+	case uint64:
+		encodeUint(typeUint64, v)
+	case []any:
+		control(typeArray, len(v))
+		for _, e := range v {
+			w.encode(buf, e)
+		}
+	case mmdbMap:
+		control(typeMap, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			w.encode(buf, k)
+			w.encode(buf, v[k])
+		}
+	case mmdbPointer:
+		offset := w.shared[string(v)]
+		buf.Write([]byte{typePointer<<5 | byte(offset>>8)&0x7, byte(offset)})
+	default:
+		panic("unsupported test database value")
+	}
+}
+
+// countryDB is a Country-style database. The US country is shared through
+// a pointer; one network only has a registered country.
+func countryDB(t *testing.T, ipVersion, recordSize int) []byte {
+	w := newMMDBWriter(ipVersion, recordSize)
+	w.share("us", mmdbMap{"iso_code": "US", "names": mmdbMap{"en": "United States"}})
+	w.insert(t, "1.2.3.0/24", mmdbMap{"country": mmdbPointer("us")})
+	w.insert(t, "81.2.69.128/26", mmdbMap{"country": mmdbMap{"iso_code": "GB"}})
+	w.insert(t, "89.160.20.112/28", mmdbMap{"registered_country": mmdbMap{"iso_code": "SE"}})
+	if ipVersion == 6 {
+		w.insert(t, "2001:db8::/32", mmdbMap{"country": mmdbPointer("us")})
+		w.insert(t, "2a02:cf40::/29", mmdbMap{"country": mmdbMap{"iso_code": "NO"}})
+	}
+	return w.bytes("Test-Country")
+}
+
+// asnDB is an ASN-style database.
+func asnDB(t *testing.T, ipVersion, recordSize int) []byte {
+	w := newMMDBWriter(ipVersion, recordSize)
+	w.insert(t, "1.2.3.0/24", mmdbMap{"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example Net"})
+	w.insert(t, "81.2.69.0/24", mmdbMap{"autonomous_system_number": uint32(20712), "autonomous_system_organization": "Andrews & Arnold"})
+	if ipVersion == 6 {
+		w.insert(t, "2001:db8::/32", mmdbMap{"autonomous_system_number": uint32(4_200_000_000), "autonomous_system_organization": "Documentation"})
+	}
+	return w.bytes("Test-ASN")
+}
+
+// fixtures are the databases in testdata, shared with the server's tests.
+var fixtures = map[string]func(t *testing.T) []byte{
+	"test-country.mmdb": func(t *testing.T) []byte { return countryDB(t, 6, 28) },
+	"test-asn.mmdb":     func(t *testing.T) []byte { return asnDB(t, 4, 24) },
+}
+
+func TestFixturesUpToDate(t *testing.T) {
+	for name, build := range fixtures {
+		path := filepath.Join("testdata", name)
+		want := build(t)
+		if *update {
+			if err := os.WriteFile(path, want, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading fixture: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is stale; regenerate it with go test -run TestFixturesUpToDate -update", path)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	country, err := Open(filepath.Join("testdata", "test-country.mmdb"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got := country.DatabaseType(); got != "Test-Country" {
+		t.Errorf("DatabaseType = %q", got)
+	}
+
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			for _, db := range []struct {
+				name    string
+				build   func(*testing.T, int, int) []byte
+				want    map[string]Record // Keyed by address
+				missing []string
+			}{
+				{"country", countryDB, map[string]Record{
+					"1.2.3.4":        {Country: "US"}, // Through a pointer
+					"81.2.69.160":    {Country: "GB"}, // In a /26
+					"89.160.20.115":  {Country: "SE"}, // Registered country only
+					"2001:db8::1":    {Country: "US"}, // IPv6, through a pointer
+					"2a02:cf47::":    {Country: "NO"}, // Last /32 of a /29
+					"::ffff:1.2.3.4": {Country: "US"}, // IPv4-mapped
+				}, []string{"1.2.4.0", "81.2.69.127", "89.160.20.128", "10.0.0.1", "2001:db9::1", "2a02:cf48::", "::1"}},
+				{"asn", asnDB, map[string]Record{
+					"1.2.3.255":   {ASN: 64500, Organization: "Example Net"},
+					"81.2.69.1":   {ASN: 20712, Organization: "Andrews & Arnold"},
+					"2001:db8::2": {ASN: 4_200_000_000, Organization: "Documentation"}, // A 32-bit ASN
+				}, []string{"1.2.4.0", "81.2.70.0", "10.0.0.1", "2001:db9::1", "::1"}},
+			} {
+				r, err := New(db.build(t, ipVersion, recordSize))
+				if err != nil {
+					t.Fatalf("%s v%d/%d: New: %v", db.name, ipVersion, recordSize, err)
+				}
+				for addr, want := range db.want {
+					a := netip.MustParseAddr(addr)
+					if a.Unmap().Is6() && ipVersion == 4 {
+						want = Record{} // Not in an IPv4-only database
+					}
+					got, ok, err := r.Lookup(a)
+					if err != nil || ok != (want != Record{}) || got != want {
+						t.Errorf("%s v%d/%d: Lookup(%s) = %+v, %t, %v; want %+v", db.name, ipVersion, recordSize, addr, got, ok, err, want)
+					}
+				}
+				for _, addr := range db.missing {
+					if got, ok, err := r.Lookup(netip.MustParseAddr(addr)); ok || err != nil {
+						t.Errorf("%s v%d/%d: Lookup(%s) = %+v, %t, %v; want no record", db.name, ipVersion, recordSize, addr, got, ok, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	valid := countryDB(t, 6, 24)
+	for name, buf := range map[string][]byte{
+		"empty":           nil,
+		"no metadata":     valid[:bytes.LastIndex(valid, metadataMarker)+4],
+		"truncated tree":  append(append([]byte{}, valid[:20]...), valid[bytes.LastIndex(valid, metadataMarker):]...),
+		"bad record size": bytes.Replace(valid, []byte("record_size\xa1\x18"), []byte("record_size\xa1\x19"), 1),
+	} {
+		if _, err := New(buf); !errors.Is(err, ErrInvalidDatabase) {
+			t.Errorf("%s: New error = %v, want ErrInvalidDatabase", name, err)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exposition formats.
+const (
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// metric is anything that can render itself in the Prometheus text or
+// OpenMetrics format.
+type metric interface {
+	name() string
+	write(w *bufio.Writer, openMetrics bool)
+}
+
+// Registry holds a set of metrics and serves them in the Prometheus text
+// exposition format, or in OpenMetrics (with exemplars) when the scraper asks
+// for it.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.metrics[m.name()]; dup {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	r.metrics[m.name()] = m
+}
+
+// Handler serves the registry's metrics, negotiating the format from the
+// Accept header.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", contentTypeOpenMetrics)
+		} else {
+			w.Header().Set("Content-Type", contentTypeText)
+		}
+		bw := bufio.NewWriter(w)
+		r.WriteTo(bw, openMetrics)
+		bw.Flush()
+	})
+}
+
+// WriteTo writes every metric, sorted by name. OpenMetrics output includes
+// exemplars and the terminating "# EOF" line.
+func (r *Registry) WriteTo(w *bufio.Writer, openMetrics bool) {
+	r.mu.Lock()
+	ms := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		ms = append(ms, m)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name() < ms[j].name() })
+	for _, m := range ms {
+		m.write(w, openMetrics)
+	}
+	if openMetrics {
+		w.WriteString("# EOF\n")
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	metricName, help string
+	bits             atomic.Uint64
+}
+
+// NewCounter creates and registers a counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{metricName: name, help: help}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add adds v, which must not be negative, to the counter.
+func (c *Counter) Add(v float64) {
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Value returns the current count.
+func (c *Counter) Value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+func (c *Counter) name() string { return c.metricName }
+
+func (c *Counter) write(w *bufio.Writer, openMetrics bool) {
+	if openMetrics {
+		// OpenMetrics names the family without the _total suffix and
+		// requires it on the sample.
+		family := strings.TrimSuffix(c.metricName, "_total")
+		writeHeader(w, family, c.help, "counter")
+		fmt.Fprintf(w, "%s_total %s\n", family, formatFloat(c.Value()))
+		return
+	}
+	writeHeader(w, c.metricName, c.help, "counter")
+	fmt.Fprintf(w, "%s %s\n", c.metricName, formatFloat(c.Value()))
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	metricName, help string
+	bits             atomic.Uint64
+}
+
+// NewGauge creates and registers a gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{metricName: name, help: help}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) name() string { return g.metricName }
+
+func (g *Gauge) write(w *bufio.Writer, openMetrics bool) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.Value()))
+}
+
+// GaugeFunc is a gauge whose value is computed when it is scraped.
+type GaugeFunc struct {
+	metricName, help string
+	fn               func() float64
+}
+
+// NewGaugeFunc creates and registers a gauge reporting fn's result.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w *bufio.Writer, openMetrics bool) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	metricName, help string
+	upperBounds      []float64
+
+	mu        sync.Mutex
+	counts    []uint64   // per bucket, non-cumulative; last entry is +Inf
+	exemplars []exemplar // latest exemplar per bucket, if any
+	sum       float64
+	count     uint64
+}
+
+// exemplar links an observation to, typically, the trace that produced it.
+type exemplar struct {
+	labels map[string]string
+	value  float64
+	ts     time.Time
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper
+// bounds, which must be sorted in increasing order.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		metricName:  name,
+		help:        help,
+		upperBounds: append([]float64(nil), buckets...),
+		counts:      make([]uint64, len(buckets)+1),
+		exemplars:   make([]exemplar, len(buckets)+1),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a single value.
+func (h *Histogram) Observe(v float64) {
+	h.ObserveWithExemplar(v, nil)
+}
+
+// ObserveWithExemplar records a value and, when labels is non-empty, keeps it
+// as the exemplar of its bucket (e.g. labels {"trace_id": "..."}). Exemplars
+// are only exposed in the OpenMetrics format.
+func (h *Histogram) ObserveWithExemplar(v float64, labels map[string]string) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	if len(labels) > 0 {
+		h.exemplars[i] = exemplar{labels: labels, value: v, ts: time.Now()}
+	}
+	h.mu.Unlock()
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+func (h *Histogram) write(w *bufio.Writer, openMetrics bool) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	exemplars := append([]exemplar(nil), h.exemplars...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	writeHeader(w, h.metricName, h.help, "histogram")
+	var cumulative uint64
+	for i := range counts {
+		cumulative += counts[i]
+		bound := "+Inf"
+		if i < len(h.upperBounds) {
+			bound = formatFloat(h.upperBounds[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d", h.metricName, bound, cumulative)
+		if openMetrics && exemplars[i].labels != nil {
+			writeExemplar(w, exemplars[i])
+		}
+		w.WriteByte('\n')
+	}
+	fmt.Fprintf(w, "%s_sum %s\n", h.metricName, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.metricName, count)
+}
+
+// writeExemplar appends an OpenMetrics exemplar: # {labels} value timestamp
+func writeExemplar(w *bufio.Writer, e exemplar) {
+	keys := make([]string, 0, len(e.labels))
+	for k := range e.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.WriteString(" # {")
+	for i, k := range keys {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		fmt.Fprintf(w, "%s=%s", k, strconv.Quote(e.labels[k]))
+	}
+	fmt.Fprintf(w, "} %s %s", formatFloat(e.value), strconv.FormatFloat(float64(e.ts.UnixMilli())/1000, 'f', 3, 64))
+}
+
+// ExponentialBuckets returns count bucket bounds starting at start and
+// multiplying by factor each time.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape fetches r's metrics with the given Accept header.
+func scrape(r *Registry, accept string) (contentType, body string) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, req)
+	return rec.Header().Get("Content-Type"), rec.Body.String()
+}
+
+func testRegistry() *Registry {
+	r := NewRegistry()
+	r.NewCounter("requests_total", "Requests served.").Add(3)
+	r.NewGauge("queue_depth", "Queued jobs.").Set(2)
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.ObserveWithExemplar(0.5, map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"})
+	return r
+}
+
+func TestHandlerServesPrometheusTextByDefault(t *testing.T) {
+	for _, accept := range []string{"", "text/plain", "*/*"} {
+		contentType, body := scrape(testRegistry(), accept)
+		if contentType != contentTypeText {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", accept, contentType, contentTypeText)
+		}
+		for _, want := range []string{
+			"# TYPE requests_total counter\nrequests_total 3\n",
+			"queue_depth 2\n",
+			"latency_seconds_bucket{le=\"1\"} 2\n",
+			"latency_seconds_count 2\n",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Accept %q: output lacks %q:\n%s", accept, want, body)
+			}
+		}
+		if strings.Contains(body, "trace_id") || strings.Contains(body, "# EOF") {
+			t.Errorf("Accept %q: classic format carries OpenMetrics-only syntax:\n%s", accept, body)
+		}
+	}
+}
+
+func TestHandlerServesOpenMetricsWithExemplars(t *testing.T) {
+	contentType, body := scrape(testRegistry(), "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	if contentType != contentTypeOpenMetrics {
+		t.Errorf("Content-Type = %q, want %q", contentType, contentTypeOpenMetrics)
+	}
+	for _, want := range []string{
+		"# TYPE requests counter\nrequests_total 3\n",
+		`latency_seconds_bucket{le="1"} 2 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.5 `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("output lacks %q:\n%s", want, body)
+		}
+	}
+	// The bucket without an exemplar has none.
+	if !strings.Contains(body, "latency_seconds_bucket{le=\"0.1\"} 1\n") {
+		t.Errorf("bucket without an exemplar rendered wrongly:\n%s", body)
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("output does not end with # EOF:\n%s", body)
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup_total", "First.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate metric did not panic")
+		}
+	}()
+	r.NewGauge("dup_total", "Second.")
+}
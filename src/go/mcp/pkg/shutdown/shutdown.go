@@ -0,0 +1,111 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Closer is a subsystem that can be shut down within the given context.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// CloserFunc adapts an ordinary function to the Closer interface.
+type CloserFunc func(ctx context.Context) error
+
+// Close calls f(ctx).
+func (f CloserFunc) Close(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Step describes a single subsystem in the shutdown sequence.
+type Step struct {
+	Name    string        // Used in log output
+	Order   int           // Lower values close first; ties keep registration order
+	Timeout time.Duration // Per-step budget; zero means only the overall deadline applies
+	Closer  Closer
+}
+
+// Sequence closes registered subsystems in a defined order.
+// Each step gets its own timeout, and the whole sequence is bounded by an
+// overall deadline. A step that does not return in time is abandoned so the
+// remaining steps still run.
+type Sequence struct {
+	deadline time.Duration
+
+	mu    sync.Mutex
+	steps []Step
+}
+
+// NewSequence creates a shutdown sequence bounded by the given overall deadline.
+// A zero deadline means the sequence is bounded only by the context passed to Run.
+func NewSequence(deadline time.Duration) *Sequence {
+	return &Sequence{deadline: deadline}
+}
+
+// Register adds a step to the sequence.
+func (s *Sequence) Register(step Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, step)
+}
+
+// Run executes all registered steps in order and returns the joined errors of
+// the steps that failed or timed out.
+func (s *Sequence) Run(ctx context.Context) error {
+	s.mu.Lock()
+	steps := make([]Step, len(s.steps))
+	copy(steps, s.steps)
+	s.mu.Unlock()
+
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Order < steps[j].Order })
+
+	if s.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.deadline)
+		defer cancel()
+	}
+
+	var errs []error
+	for _, step := range steps {
+		if err := runStep(ctx, step); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runStep(parent context.Context, step Step) error {
+	ctx := parent
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, step.Timeout)
+		defer cancel()
+	}
+
+	log.Printf("Shutdown: closing %s", step.Name)
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- step.Closer.Close(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Printf("Shutdown: %s failed after %s: %v", step.Name, time.Since(start), err)
+			return fmt.Errorf("%s: %w", step.Name, err)
+		}
+		log.Printf("Shutdown: %s closed in %s", step.Name, time.Since(start))
+		return nil
+	case <-ctx.Done():
+		log.Printf("Shutdown: %s did not close in time, moving on: %v", step.Name, ctx.Err())
+		return fmt.Errorf("%s: %w", step.Name, ctx.Err())
+	}
+}
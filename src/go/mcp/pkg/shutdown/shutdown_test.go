@@ -0,0 +1,92 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the order in which its steps close.
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) step(name string, order int) Step {
+	return Step{Name: name, Order: order, Closer: CloserFunc(func(context.Context) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.order = append(r.order, name)
+		return nil
+	})}
+}
+
+func TestRunClosesInOrder(t *testing.T) {
+	var r recorder
+	seq := NewSequence(time.Second)
+	seq.Register(r.step("store", 10))
+	seq.Register(r.step("server", 0))
+	seq.Register(r.step("events", 10))
+	seq.Register(r.step("jobs", 5))
+
+	if err := seq.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// Ties keep registration order.
+	want := []string{"server", "jobs", "store", "events"}
+	if !slices.Equal(r.order, want) {
+		t.Errorf("close order = %v, want %v", r.order, want)
+	}
+}
+
+func TestRunAbandonsStepAfterItsTimeout(t *testing.T) {
+	var r recorder
+	seq := NewSequence(5 * time.Second)
+	seq.Register(Step{Name: "stuck", Order: 0, Timeout: 20 * time.Millisecond, Closer: CloserFunc(func(context.Context) error {
+		select {} // Ignores its context
+	})})
+	seq.Register(r.step("after", 1))
+
+	start := time.Now()
+	err := seq.Run(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %s; the stuck step should be abandoned after its timeout", elapsed)
+	}
+	if !slices.Equal(r.order, []string{"after"}) {
+		t.Errorf("steps closed after the stuck one = %v, want [after]", r.order)
+	}
+}
+
+func TestRunBoundsStepsByOverallDeadline(t *testing.T) {
+	seq := NewSequence(30 * time.Millisecond)
+	bounded := make(chan bool, 1)
+	seq.Register(Step{Name: "slow", Timeout: time.Hour, Closer: CloserFunc(func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		bounded <- ok && time.Until(deadline) < time.Second
+		<-ctx.Done()
+		return ctx.Err()
+	})})
+	if err := seq.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run error = %v, want DeadlineExceeded", err)
+	}
+	if !<-bounded {
+		t.Error("step context was not bounded by the overall deadline")
+	}
+}
+
+func TestRunJoinsStepErrors(t *testing.T) {
+	errA, errB := errors.New("a failed"), errors.New("b failed")
+	seq := NewSequence(0)
+	seq.Register(Step{Name: "a", Closer: CloserFunc(func(context.Context) error { return errA })})
+	seq.Register(Step{Name: "b", Order: 1, Closer: CloserFunc(func(context.Context) error { return errB })})
+	err := seq.Run(context.Background())
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Run error = %v, want both step errors", err)
+	}
+}
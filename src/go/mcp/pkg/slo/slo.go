@@ -0,0 +1,109 @@
+package slo
+
+import (
+	"sync"
+	"time"
+)
+
+// buckets is how many slices the rolling window is divided into; the
+// window effectively advances one slice at a time.
+const buckets = 60
+
+type bucket struct {
+	start       time.Time
+	good, total int64
+}
+
+// Tracker records request latencies and reports the fraction that met the
+// target within the rolling window.
+type Tracker struct {
+	target    time.Duration
+	objective float64
+	window    time.Duration
+	width     time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets [buckets]bucket
+}
+
+// Option configures optional Tracker behaviour.
+type Option func(*Tracker)
+
+// WithClock replaces time.Now, letting tests control the window.
+func WithClock(now func() time.Time) Option {
+	return func(t *Tracker) { t.now = now }
+}
+
+// New creates a tracker for the objective that a fraction objective (e.g.
+// 0.95) of requests complete within target, measured over window.
+func New(target time.Duration, objective float64, window time.Duration, opts ...Option) *Tracker {
+	t := &Tracker{
+		target:    target,
+		objective: objective,
+		window:    window,
+		width:     max(window/buckets, time.Millisecond),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Observe records one request that took d.
+func (t *Tracker) Observe(d time.Duration) {
+	now := t.now()
+	start := now.Truncate(t.width)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[(start.UnixNano()/int64(t.width))%buckets]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+	b.total++
+	if d <= t.target {
+		b.good++
+	}
+}
+
+// Report is a snapshot of SLO compliance.
+type Report struct {
+	TargetMs   int64   `json:"target_ms"`
+	Objective  float64 `json:"objective"`
+	WindowSecs int64   `json:"window_seconds"`
+	Total      int64   `json:"total"`
+	Good       int64   `json:"good"`
+	// Compliance is the fraction of requests within target; 1 when there
+	// were none.
+	Compliance float64 `json:"compliance"`
+	// BurnRate is how fast the error budget is being spent: 1 spends it
+	// exactly over the window, above 1 exhausts it early.
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// Report summarizes the requests observed within the window.
+func (t *Tracker) Report() Report {
+	cutoff := t.now().Add(-t.window)
+	r := Report{
+		TargetMs:   t.target.Milliseconds(),
+		Objective:  t.objective,
+		WindowSecs: int64(t.window.Seconds()),
+		Compliance: 1,
+	}
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.total > 0 && b.start.After(cutoff) {
+			r.Total += b.total
+			r.Good += b.good
+		}
+	}
+	t.mu.Unlock()
+	if r.Total > 0 {
+		r.Compliance = float64(r.Good) / float64(r.Total)
+	}
+	if budget := 1 - t.objective; budget > 0 {
+		r.BurnRate = (1 - r.Compliance) / budget
+	}
+	return r
+}
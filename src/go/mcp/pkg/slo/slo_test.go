@@ -0,0 +1,75 @@
+package slo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestReportComplianceFraction(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	tr := New(2*time.Second, 0.95, time.Hour, WithClock(clock.now))
+
+	if r := tr.Report(); r.Compliance != 1 || r.BurnRate != 0 || r.Total != 0 {
+		t.Errorf("empty window: report = %+v, want compliance 1 and burn rate 0", r)
+	}
+
+	// 18 of 20 within target; exactly the target counts as meeting it.
+	for range 17 {
+		tr.Observe(500 * time.Millisecond)
+	}
+	tr.Observe(2 * time.Second)
+	tr.Observe(2*time.Second + time.Millisecond)
+	tr.Observe(5 * time.Second)
+
+	r := tr.Report()
+	if r.Total != 20 || r.Good != 18 {
+		t.Fatalf("total/good = %d/%d, want 20/18", r.Total, r.Good)
+	}
+	if r.Compliance != 0.9 {
+		t.Errorf("compliance = %v, want 0.9", r.Compliance)
+	}
+	// 10% bad against a 5% budget spends it twice as fast as allowed.
+	if math.Abs(r.BurnRate-2) > 1e-9 {
+		t.Errorf("burn rate = %v, want 2", r.BurnRate)
+	}
+	if r.TargetMs != 2000 || r.Objective != 0.95 || r.WindowSecs != 3600 {
+		t.Errorf("report settings = %+v", r)
+	}
+}
+
+func TestReportRollsOffOldRequests(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	tr := New(time.Second, 0.99, time.Minute, WithClock(clock.now))
+
+	for range 4 {
+		tr.Observe(3 * time.Second)
+	}
+	clock.advance(30 * time.Second)
+	for range 4 {
+		tr.Observe(100 * time.Millisecond)
+	}
+	if r := tr.Report(); r.Total != 8 || r.Compliance != 0.5 {
+		t.Errorf("within the window: total %d, compliance %v; want 8, 0.5", r.Total, r.Compliance)
+	}
+
+	// The slow requests leave the window; the fast ones remain.
+	clock.advance(40 * time.Second)
+	if r := tr.Report(); r.Total != 4 || r.Compliance != 1 {
+		t.Errorf("after the slow requests expired: total %d, compliance %v; want 4, 1", r.Total, r.Compliance)
+	}
+
+	// A bucket reused a full window later starts from zero.
+	clock.advance(30 * time.Second)
+	tr.Observe(3 * time.Second)
+	if r := tr.Report(); r.Total != 1 || r.Good != 0 {
+		t.Errorf("after the window wrapped: total/good = %d/%d, want 1/0", r.Total, r.Good)
+	}
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Signer signs audit records so that later modification is detectable.
+type Signer interface {
+	// Sign returns the signature of the canonical record bytes.
+	Sign(canonical []byte) string
+	// Verify reports whether sig is a valid signature of canonical.
+	Verify(canonical []byte, sig string) bool
+}
+
+// hmacSigner signs with HMAC-SHA256 under a shared key.
+type hmacSigner struct{ key []byte }
+
+func (h hmacSigner) Sign(canonical []byte) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(canonical)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h hmacSigner) Verify(canonical []byte, sig string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "hmac-sha256:"))
+	if err != nil || !strings.HasPrefix(sig, "hmac-sha256:") {
+		return false
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(canonical)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// ed25519Signer signs with an Ed25519 private key. With only the public
+// key it can verify but not sign.
+type ed25519Signer struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func (e ed25519Signer) Sign(canonical []byte) string {
+	return "ed25519:" + hex.EncodeToString(ed25519.Sign(e.private, canonical))
+}
+
+func (e ed25519Signer) Verify(canonical []byte, sig string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "ed25519:"))
+	if err != nil || !strings.HasPrefix(sig, "ed25519:") {
+		return false
+	}
+	return ed25519.Verify(e.public, canonical, got)
+}
+
+// ParseSigningKey parses an audit signing key of the form hmac:<hex key>,
+// ed25519:<hex 32-byte seed> or, for verification only,
+// ed25519-public:<hex public key>.
+func ParseSigningKey(s string) (Signer, error) {
+	kind, encoded, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, errors.New("audit signing key must be hmac:<hex>, ed25519:<hex seed> or ed25519-public:<hex>")
+	}
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("audit signing key: %s key must be non-empty hex", kind)
+	}
+	switch kind {
+	case "hmac":
+		return hmacSigner{key: key}, nil
+	case "ed25519":
+		if len(key) != ed25519.SeedSize {
+			return nil, fmt.Errorf("audit signing key: ed25519 seed must be %d bytes", ed25519.SeedSize)
+		}
+		private := ed25519.NewKeyFromSeed(key)
+		return ed25519Signer{private: private, public: private.Public().(ed25519.PublicKey)}, nil
+	case "ed25519-public":
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("audit signing key: ed25519 public key must be %d bytes", ed25519.PublicKeySize)
+		}
+		return ed25519Signer{public: key}, nil
+	default:
+		return nil, fmt.Errorf("audit signing key: unknown kind %q", kind)
+	}
+}
+
+// CanSign reports whether signer holds the key needed to sign, rather than
+// only to verify.
+func CanSign(signer Signer) bool {
+	e, ok := signer.(ed25519Signer)
+	return !ok || e.private != nil
+}
+
+// canonicalRecord returns the canonical serialization of an encoded record
+// that a signature covers: compact JSON with object keys sorted, numbers as
+// written, and the signature field removed.
+func canonicalRecord(line []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var v map[string]interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	delete(v, "signature")
+	return json.Marshal(v) // map keys are emitted sorted
+}
+
+// AuditStatus is the verification outcome of one store line.
+type AuditStatus string
+
+const (
+	AuditValid    AuditStatus = "valid"
+	AuditTampered AuditStatus = "tampered" // Signature doesn't match the contents
+	// AuditChainBroken marks a validly signed record that doesn't follow the
+	// signed record before it, because records were removed or reordered.
+	AuditChainBroken AuditStatus = "chain_broken"
+	AuditUnsigned    AuditStatus = "unsigned"
+	AuditCorrupt     AuditStatus = "corrupt" // Not a JSON record
+)
+
+// AuditEntry is the verification outcome of one store line.
+type AuditEntry struct {
+	Line   int
+	Status AuditStatus
+}
+
+// VerifyFile checks the signature of every record in the JSONL store at
+// path against verifier, and that each links to the signed record before
+// it, and returns the outcome per line. Records removed from the end of the
+// file leave no trace in it; compare the last signature with one kept
+// elsewhere to detect that.
+func VerifyFile(path string, verifier Signer) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening result store: %w", err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	var prev string
+	for line := 1; scanner.Scan(); line++ {
+		status, sig := verifyLine(scanner.Bytes(), verifier, prev)
+		if sig != "" {
+			prev = sig
+		}
+		entries = append(entries, AuditEntry{Line: line, Status: status})
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, fmt.Errorf("reading result store: %w", err)
+	}
+	return entries, nil
+}
+
+// verifyLine checks one store line, expected to follow the signed record
+// whose signature is prev, and returns its status and signature.
+func verifyLine(line []byte, verifier Signer, prev string) (AuditStatus, string) {
+	var signed struct {
+		PrevSignature string `json:"prev_signature"`
+		Signature     string `json:"signature"`
+	}
+	if err := json.Unmarshal(line, &signed); err != nil {
+		return AuditCorrupt, ""
+	}
+	if signed.Signature == "" {
+		return AuditUnsigned, ""
+	}
+	canonical, err := canonicalRecord(line)
+	if err != nil {
+		return AuditCorrupt, ""
+	}
+	if !verifier.Verify(canonical, signed.Signature) {
+		return AuditTampered, signed.Signature
+	}
+	if signed.PrevSignature != prev {
+		return AuditChainBroken, signed.Signature
+	}
+	return AuditValid, signed.Signature
+}
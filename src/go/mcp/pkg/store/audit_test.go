@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+const (
+	testHMACKey    = "hmac:00112233445566778899aabbccddeeff"
+	testEd25519Key = "ed25519:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+// signedStore writes n signed decisions to a new store file and returns
+// its path.
+func signedStore(t *testing.T, key string, n int) string {
+	t.Helper()
+	signer, err := ParseSigningKey(key)
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	s, err := OpenJSONL(path, WithSigner(signer))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	defer s.Close(t.Context())
+	for i := range n {
+		result := &claude.LivenessAnalysisResult{IsLikelyLive: true, Confidence: 0.9, Reasoning: "Consistent signals."}
+		if err := s.Save(t.Context(), strings.Repeat("h", i+1), result); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	return path
+}
+
+// verify returns the status of each line of the store at path.
+func verify(t *testing.T, path, key string) []AuditStatus {
+	t.Helper()
+	verifier, err := ParseSigningKey(key)
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	entries, err := VerifyFile(path, verifier)
+	if err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+	var statuses []AuditStatus
+	for i, e := range entries {
+		if e.Line != i+1 {
+			t.Errorf("entry %d reports line %d", i, e.Line)
+		}
+		statuses = append(statuses, e.Status)
+	}
+	return statuses
+}
+
+// editLines rewrites the store at path with edit applied to its lines.
+func editLines(t *testing.T, path string, edit func(lines [][]byte) [][]byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading store: %v", err)
+	}
+	lines := edit(bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")))
+	if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o600); err != nil {
+		t.Fatalf("writing store: %v", err)
+	}
+}
+
+func TestSignedRecordsVerify(t *testing.T) {
+	valid := []AuditStatus{AuditValid, AuditValid, AuditValid}
+	for _, key := range []string{testHMACKey, testEd25519Key} {
+		path := signedStore(t, key, 3)
+		if got := verify(t, path, key); !slices.Equal(got, valid) {
+			t.Errorf("%s: statuses = %v, want all valid", key, got)
+		}
+	}
+
+	// An Ed25519 public key verifies but cannot sign.
+	public, err := ParseSigningKey("ed25519-public:03a107bff3ce10be1d70dd18e74bc09967e4d6309ba50d5f1ddc8664125531b8")
+	if err != nil {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	if CanSign(public) {
+		t.Error("CanSign(public key) = true")
+	}
+	entries, err := VerifyFile(signedStore(t, testEd25519Key, 2), public)
+	if err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+	for _, e := range entries {
+		if e.Status != AuditValid {
+			t.Errorf("public key verification: line %d %s", e.Line, e.Status)
+		}
+	}
+
+	// A different key sees every record as tampered.
+	path := signedStore(t, testHMACKey, 2)
+	if got := verify(t, path, "hmac:ffff"); !slices.Equal(got, []AuditStatus{AuditTampered, AuditTampered}) {
+		t.Errorf("wrong key: statuses = %v, want all tampered", got)
+	}
+}
+
+func TestSignatureChainContinuesAcrossReopen(t *testing.T) {
+	path := signedStore(t, testHMACKey, 2)
+	signer, _ := ParseSigningKey(testHMACKey)
+	s, err := OpenJSONL(path, WithSigner(signer))
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	if err := s.SaveServed(t.Context(), "req-1", &claude.LivenessAnalysisResult{Confidence: 0.2}); err != nil {
+		t.Fatalf("SaveServed: %v", err)
+	}
+	if _, err := s.Label(t.Context(), "req-1", false); err != nil {
+		t.Fatalf("Label: %v", err)
+	}
+	s.Close(t.Context())
+	if got := verify(t, path, testHMACKey); !slices.Equal(got, []AuditStatus{AuditValid, AuditValid, AuditValid, AuditValid}) {
+		t.Errorf("statuses = %v, want all valid", got)
+	}
+}
+
+func TestTamperedRecordsDetected(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		edit func(lines [][]byte) [][]byte
+		want []AuditStatus
+	}{
+		{"modified", func(lines [][]byte) [][]byte {
+			lines[1] = bytes.Replace(lines[1], []byte(`"confidence":0.9`), []byte(`"confidence":0.1`), 1)
+			return lines
+		}, []AuditStatus{AuditValid, AuditTampered, AuditValid, AuditValid}},
+		{"removed", func(lines [][]byte) [][]byte {
+			return slices.Delete(lines, 1, 2)
+		}, []AuditStatus{AuditValid, AuditChainBroken, AuditValid}},
+		{"first removed", func(lines [][]byte) [][]byte {
+			return lines[1:]
+		}, []AuditStatus{AuditChainBroken, AuditValid, AuditValid}},
+		{"reordered", func(lines [][]byte) [][]byte {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, []AuditStatus{AuditValid, AuditChainBroken, AuditChainBroken, AuditChainBroken}},
+		{"unsigned and corrupt lines", func(lines [][]byte) [][]byte {
+			return append(lines, []byte(`{"input_hash": "x", "created_at": "2026-01-01T00:00:00Z"}`), []byte(`{"input_hash": `))
+		}, []AuditStatus{AuditValid, AuditValid, AuditValid, AuditValid, AuditUnsigned, AuditCorrupt}},
+	} {
+		path := signedStore(t, testHMACKey, 4)
+		editLines(t, path, tc.edit)
+		if got := verify(t, path, testHMACKey); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: statuses = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
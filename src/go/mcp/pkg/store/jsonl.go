@@ -0,0 +1,308 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// ErrUnknownRequest is returned when feedback names a request ID with no
+// served decision in the store.
+var ErrUnknownRequest = errors.New("no decision recorded for request ID")
+
+// Record is a single line of the store. A decision saved for an input hash
+// has InputHash set; a decision served to a client has RequestID set; a
+// feedback label has RequestID and ActualLive set and no Result.
+type Record struct {
+	InputHash string                         `json:"input_hash,omitempty"`
+	RequestID string                         `json:"request_id,omitempty"`
+	CreatedAt time.Time                      `json:"created_at"`
+	Result    *claude.LivenessAnalysisResult `json:"result,omitempty"`
+
+	ActualLive *bool      `json:"actual_live,omitempty"` // Ground-truth label from feedback
+	LabeledAt  *time.Time `json:"labeled_at,omitempty"`
+
+	// PrevSignature is the signature of the signed record before this one,
+	// chaining the records so that removing or reordering them is
+	// detectable; empty for the first. Signature covers the canonical
+	// serialization of the rest of the record, PrevSignature included,
+	// when the store signs records; see WithSigner.
+	PrevSignature string `json:"prev_signature,omitempty"`
+	Signature     string `json:"signature,omitempty"`
+}
+
+// JSONLStore is a claude.ResultStore that appends one JSON record per line to
+// a file. The latest record for each input hash is indexed in memory, and
+// every record is kept in write order for history queries.
+type JSONLStore struct {
+	mu      sync.Mutex
+	file    *os.File
+	index   map[string]*Record
+	records []*Record
+	// served maps request IDs to served decisions, with any feedback label
+	// applied.
+	served map[string]*Record
+	// signer, when set, signs each appended record; lastSignature is the
+	// signature of the last signed record, which the next one links to.
+	signer        Signer
+	lastSignature string
+	// strict makes OpenJSONL fail on a corrupted line instead of skipping
+	// it; corrupted holds the line numbers of the lines skipped.
+	strict    bool
+	corrupted []int
+	// needsNewline is set when the file doesn't end in a newline, as after
+	// a torn write, so the next record doesn't run into the partial line.
+	needsNewline bool
+}
+
+// maxCorruptedLines bounds how many corrupted line numbers Health reports.
+const maxCorruptedLines = 100
+
+// Health describes the state of the store file as read at open.
+type Health struct {
+	Records        int   `json:"records"`                   // Decisions held in the history
+	Corrupted      int   `json:"corrupted"`                 // Lines skipped because they couldn't be decoded
+	CorruptedLines []int `json:"corrupted_lines,omitempty"` // The first of those line numbers
+}
+
+// Option configures optional JSONLStore behaviour.
+type Option func(*JSONLStore)
+
+// WithSigner signs every record appended to the store, making later
+// modification detectable with VerifyFile. Each record is chained to the
+// one before it, so records removed from or reordered within the file are
+// detected too; records removed from the end are not, as nothing follows
+// them.
+func WithSigner(signer Signer) Option {
+	return func(s *JSONLStore) { s.signer = signer }
+}
+
+// WithStrictReads makes OpenJSONL fail on a line that can't be decoded
+// instead of logging and skipping it.
+func WithStrictReads(strict bool) Option {
+	return func(s *JSONLStore) { s.strict = strict }
+}
+
+// OpenJSONL opens (creating if needed) the JSONL store at path and indexes
+// the records it already holds. Corrupted lines are skipped and counted in
+// Health, unless WithStrictReads is set.
+func OpenJSONL(path string, opts ...Option) (*JSONLStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening result store: %w", err)
+	}
+
+	s := &JSONLStore{file: f, index: make(map[string]*Record), served: make(map[string]*Record)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			if s.strict {
+				f.Close()
+				return nil, fmt.Errorf("reading result store line %d: %w", line, err)
+			}
+			log.Printf("Result store: skipping corrupted line %d: %v", line, err)
+			s.corrupted = append(s.corrupted, line)
+			continue
+		}
+		if rec.Signature != "" {
+			s.lastSignature = rec.Signature
+		}
+		s.apply(&rec)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading result store: %w", err)
+	}
+	if s.needsNewline, err = endsMidLine(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading result store: %w", err)
+	}
+	return s, nil
+}
+
+// endsMidLine reports whether f is non-empty and its last byte is not a
+// newline.
+func endsMidLine(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil && err != io.EOF {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// Health reports how many records the store holds and which lines were
+// skipped as corrupted when it was opened.
+func (s *JSONLStore) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Health{
+		Records:        len(s.records),
+		Corrupted:      len(s.corrupted),
+		CorruptedLines: slices.Clone(s.corrupted[:min(len(s.corrupted), maxCorruptedLines)]),
+	}
+}
+
+// apply adds rec to the in-memory indexes. Callers hold s.mu or own s.
+func (s *JSONLStore) apply(rec *Record) {
+	switch {
+	case rec.InputHash != "":
+		s.index[rec.InputHash] = rec
+		s.records = append(s.records, rec)
+	case rec.ActualLive != nil:
+		if d, ok := s.served[rec.RequestID]; ok {
+			d.ActualLive, d.LabeledAt = rec.ActualLive, rec.LabeledAt
+		}
+	case rec.RequestID != "":
+		s.served[rec.RequestID] = rec
+	}
+}
+
+// appendRecord writes rec as a new line and indexes it. Callers hold s.mu.
+func (s *JSONLStore) appendRecord(rec *Record) error {
+	if s.signer != nil {
+		rec.PrevSignature = s.lastSignature
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding record: %w", err)
+	}
+	if s.signer != nil {
+		canonical, err := canonicalRecord(data)
+		if err != nil {
+			return fmt.Errorf("canonicalizing record: %w", err)
+		}
+		rec.Signature = s.signer.Sign(canonical)
+		if data, err = json.Marshal(rec); err != nil {
+			return fmt.Errorf("encoding record: %w", err)
+		}
+	}
+	line := append(data, '\n')
+	if s.needsNewline {
+		line = append([]byte{'\n'}, line...)
+	}
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("writing record: %w", err)
+	}
+	s.needsNewline = false
+	if rec.Signature != "" {
+		s.lastSignature = rec.Signature
+	}
+	s.apply(rec)
+	return nil
+}
+
+// Save appends a record for result.
+func (s *JSONLStore) Save(ctx context.Context, inputHash string, result *claude.LivenessAnalysisResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendRecord(&Record{InputHash: inputHash, CreatedAt: time.Now().UTC(), Result: result})
+}
+
+// SaveServed records the decision served to a client under requestID so
+// that feedback can later be matched against it.
+func (s *JSONLStore) SaveServed(ctx context.Context, requestID string, result *claude.LivenessAnalysisResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendRecord(&Record{RequestID: requestID, CreatedAt: time.Now().UTC(), Result: result})
+}
+
+// Label records the ground truth for the decision served under requestID
+// and returns the labeled decision. A later label replaces an earlier one.
+func (s *JSONLStore) Label(ctx context.Context, requestID string, actualLive bool) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.served[requestID]
+	if !ok {
+		return Record{}, fmt.Errorf("%w: %s", ErrUnknownRequest, requestID)
+	}
+	now := time.Now().UTC()
+	if err := s.appendRecord(&Record{RequestID: requestID, CreatedAt: now, ActualLive: &actualLive, LabeledAt: &now}); err != nil {
+		return Record{}, err
+	}
+	return *d, nil
+}
+
+// Accuracy returns the number of labeled decisions and how many of them
+// predicted the label correctly.
+func (s *JSONLStore) Accuracy() (labeled, correct int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.served {
+		if d.ActualLive == nil || d.Result == nil {
+			continue
+		}
+		labeled++
+		if d.Result.IsLikelyLive == *d.ActualLive {
+			correct++
+		}
+	}
+	return labeled, correct
+}
+
+// Lookup returns the most recent decision stored for inputHash.
+func (s *JSONLStore) Lookup(ctx context.Context, inputHash string) (*claude.LivenessAnalysisResult, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.index[inputHash]
+	if !ok {
+		return nil, false, nil
+	}
+	return rec.Result, true, nil
+}
+
+// Query returns the records created in [since, until), newest first, for
+// which match returns true, stopping after limit records. Zero times leave
+// that end of the range open and a nil match accepts every record.
+func (s *JSONLStore) Query(since, until time.Time, match func(*Record) bool, limit int) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Record
+	for i := len(s.records) - 1; i >= 0 && len(out) < limit; i-- {
+		rec := s.records[i]
+		if !since.IsZero() && rec.CreatedAt.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !rec.CreatedAt.Before(until) {
+			continue
+		}
+		if match != nil && !match(rec) {
+			continue
+		}
+		out = append(out, *rec)
+	}
+	return out
+}
+
+// Close flushes and closes the underlying file.
+func (s *JSONLStore) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
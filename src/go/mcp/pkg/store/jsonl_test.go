@@ -0,0 +1,85 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example-user/mcp-go/pkg/claude"
+)
+
+// corruptedStore is a store file with corrupted lines among valid ones,
+// ending in a torn write.
+const corruptedStore = `{"input_hash": "a", "created_at": "2026-01-01T00:00:00Z", "result": {"is_likely_live": true, "confidence": 0.9}}
+{"input_hash": "b", "created_at": "2026-01-01T00:01:00Z", "result": {"is_likely_live": tr
+not json at all
+
+{"input_hash": "c", "created_at": "2026-01-01T00:02:00Z", "result": {"is_likely_live": false, "confidence": 0.1}}
+{"input_hash": "d", "created_at": "2026-01-`
+
+func writeStore(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing store: %v", err)
+	}
+	return path
+}
+
+func TestCorruptedLinesSkipped(t *testing.T) {
+	path := writeStore(t, corruptedStore)
+	s, err := OpenJSONL(path)
+	if err != nil {
+		t.Fatalf("OpenJSONL: %v", err)
+	}
+	h := s.Health()
+	if h.Records != 2 || h.Corrupted != 3 || !slices.Equal(h.CorruptedLines, []int{2, 3, 6}) {
+		t.Errorf("Health = %+v, want 2 records and lines 2, 3 and 6 corrupted", h)
+	}
+	var hashes []string
+	for _, rec := range s.Query(time.Time{}, time.Time{}, nil, 10) {
+		hashes = append(hashes, rec.InputHash)
+	}
+	if !slices.Equal(hashes, []string{"c", "a"}) {
+		t.Errorf("history = %v, want the valid records [c a]", hashes)
+	}
+	if _, ok, _ := s.Lookup(t.Context(), "b"); ok {
+		t.Error("corrupted record b was indexed")
+	}
+
+	// A record appended after the torn write starts on its own line.
+	if err := s.Save(t.Context(), "e", &claude.LivenessAnalysisResult{IsLikelyLive: true, Confidence: 0.8}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	s.Close(t.Context())
+	s, err = OpenJSONL(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer s.Close(t.Context())
+	if _, ok, _ := s.Lookup(t.Context(), "e"); !ok {
+		t.Error("record saved after the torn write was lost")
+	}
+	if h := s.Health(); h.Records != 3 || h.Corrupted != 3 {
+		t.Errorf("Health after reopening = %+v, want 3 records and 3 corrupted", h)
+	}
+}
+
+func TestCorruptedLinesFailStrictOpen(t *testing.T) {
+	_, err := OpenJSONL(writeStore(t, corruptedStore), WithStrictReads(true))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("strict OpenJSONL error = %v, want one naming line 2", err)
+	}
+
+	s, err := OpenJSONL(writeStore(t, strings.SplitAfter(corruptedStore, "\n")[0]), WithStrictReads(true))
+	if err != nil {
+		t.Fatalf("strict OpenJSONL of an intact store: %v", err)
+	}
+	defer s.Close(t.Context())
+	if h := s.Health(); h.Records != 1 || h.Corrupted != 0 {
+		t.Errorf("Health = %+v", h)
+	}
+}
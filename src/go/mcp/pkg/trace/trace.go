@@ -0,0 +1,58 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header used by OpenTelemetry
+// to propagate the trace a request belongs to.
+const TraceparentHeader = "traceparent"
+
+type contextKey struct{}
+
+// ParseTraceparent extracts the trace ID from a W3C traceparent header value
+// ("00-<32 hex trace id>-<16 hex parent id>-<2 hex flags>").
+func ParseTraceparent(v string) (traceID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", false
+	}
+	traceID = strings.ToLower(parts[1])
+	if !isHex(traceID) || !isHex(parts[2]) || strings.Trim(traceID, "0") == "" {
+		return "", false
+	}
+	return traceID, true
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying traceID.
+func NewContext(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, traceID)
+}
+
+// FromContext returns the trace ID carried by ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Middleware stores the trace ID of an incoming traceparent header in the
+// request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			r = r.WithContext(NewContext(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}